@@ -0,0 +1,182 @@
+/*
+ * Copyright 2026 The FileRipper Team
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"fileripper"
+	"fileripper/internal/pfte"
+)
+
+// Benchmark payload: enough files and bytes that worker count and session
+// count actually matter, small enough that the whole matrix stays short.
+const (
+	benchFiles    = 8
+	benchFileSize = 1 << 20 // 1 MiB each
+)
+
+// benchConfig is one cell of the calibration matrix.
+type benchConfig struct {
+	sessions int
+	mode     pfte.TransferMode
+}
+
+func (c benchConfig) String() string {
+	mode := "boost"
+	if c.mode == pfte.ModeConservative {
+		mode = "conservative"
+	}
+	return fmt.Sprintf("%d session(s), %s mode", c.sessions, mode)
+}
+
+// handleBenchmarkCLI implements `fileripper benchmark <host> <port> <user>
+// <pass> [--save <profile>]`: short calibration uploads across a matrix of
+// session counts and concurrency modes, reporting which one this particular
+// link likes best.
+func handleBenchmarkCLI(args []string) {
+	args, saveProfile := extractStringFlag(args, "--save")
+	if len(args) < 6 {
+		fmt.Println("Usage: fileripper benchmark <host> <port> <user> <pass> [--save <profile>]")
+		os.Exit(1)
+	}
+	host, user, password := args[2], args[4], args[5]
+	port, err := strconv.Atoi(args[3])
+	if err != nil {
+		fmt.Println("Error: Invalid port number.")
+		os.Exit(1)
+	}
+
+	// Local payload: random bytes so compression along the path can't flatter
+	// the numbers.
+	localDir, err := os.MkdirTemp("", "fileripper-bench-")
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+	defer os.RemoveAll(localDir)
+	payload := make([]byte, benchFileSize)
+	for i := 0; i < benchFiles; i++ {
+		if _, err := rand.Read(payload); err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+		name := filepath.Join(localDir, fmt.Sprintf("bench-%02d.bin", i))
+		if err := os.WriteFile(name, payload, 0644); err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	// One tunnel per matrix maximum; each run borrows a prefix of the slice.
+	fmt.Printf(">> Benchmark: connecting %d tunnels to %s@%s:%d...\n", SessionCount, user, host, port)
+	var sessions []*fileripper.Session
+	for i := 0; i < SessionCount; i++ {
+		sess := fileripper.NewSession(host, port, user, password)
+		sess.SetConnectRetry(3, 2*time.Second)
+		if err := sess.Connect(); err != nil {
+			fmt.Printf("Error connecting session #%d: %v\n", i+1, err)
+			os.Exit(1)
+		}
+		defer sess.Close()
+		sessions = append(sessions, sess)
+	}
+
+	remoteDir := fmt.Sprintf(".fileripper-bench-%d", time.Now().UnixNano())
+	defer cleanupRemoteDir(sessions[0], remoteDir)
+
+	matrix := []benchConfig{}
+	for n := 1; n <= SessionCount; n++ {
+		matrix = append(matrix,
+			benchConfig{sessions: n, mode: pfte.ModeConservative},
+			benchConfig{sessions: n, mode: pfte.ModeBoost},
+		)
+	}
+
+	totalBytes := float64(benchFiles * benchFileSize)
+	fmt.Printf(">> Benchmark: uploading %s per run, %d runs.\n",
+		formatBytes(int64(totalBytes)), len(matrix))
+
+	best := -1
+	bestRate := 0.0
+	for i, cfg := range matrix {
+		client := fileripper.NewClient()
+		client.SetMode(cfg.mode)
+
+		runDir := fmt.Sprintf("%s/run-%d", remoteDir, i)
+		started := time.Now()
+		err := client.Transfer(context.Background(), sessions[:cfg.sessions],
+			"UPLOAD", localDir+string(os.PathSeparator), runDir)
+		elapsed := time.Since(started)
+		if err != nil {
+			fmt.Printf("   %-32s FAILED: %v\n", cfg, err)
+			continue
+		}
+
+		rate := totalBytes / elapsed.Seconds() / 1024 / 1024
+		fmt.Printf("   %-32s %6.2f MB/s (%s)\n", cfg, rate, elapsed.Round(10*time.Millisecond))
+		if rate > bestRate {
+			bestRate = rate
+			best = i
+		}
+	}
+
+	if best < 0 {
+		fmt.Println(">> Benchmark: every run failed; nothing to recommend.")
+		os.Exit(1)
+	}
+	winner := matrix[best]
+	fmt.Printf(">> Recommendation: %s (%.2f MB/s on this link).\n", winner, bestRate)
+
+	if saveProfile != "" {
+		mode := "boost"
+		if winner.mode == pfte.ModeConservative {
+			mode = "conservative"
+		}
+		path, err := profilesPath()
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+		profiles, err := loadProfiles(path)
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+		profiles[saveProfile] = Profile{
+			Host: host, Port: port, User: user,
+			Sessions: winner.sessions, Mode: mode,
+		}
+		if err := saveProfiles(path, profiles); err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Printf(">> Saved recommendation to profile %q.\n", saveProfile)
+	}
+}
+
+// cleanupRemoteDir removes everything the benchmark wrote: files first, then
+// the directories deepest-first (pkg/sftp's Remove handles empty dirs too).
+func cleanupRemoteDir(sess *fileripper.Session, remoteDir string) {
+	_ = sess.RemoveAll(context.Background(), remoteDir)
+}
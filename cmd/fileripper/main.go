@@ -57,13 +57,95 @@ func main() {
 	case "transfer":
 		handleTransferCLI(os.Args)
 
+	case "profiles":
+		handleProfilesCLI(os.Args)
+
+	case "benchmark":
+		handleBenchmarkCLI(os.Args)
+
 	default:
 		fmt.Printf("Error: %v: %s\n", core.ErrUnknownCommand, command)
 		printUsage()
 	}
 }
 
+// extractDurationFlag pulls "--name <duration>" out of args (if present) and
+// returns the remaining args plus the parsed value. Zero means "not set".
+func extractDurationFlag(args []string, name string) ([]string, time.Duration) {
+	for i, a := range args {
+		if a == name && i+1 < len(args) {
+			d, err := time.ParseDuration(args[i+1])
+			if err != nil {
+				fmt.Printf("Error: invalid value for %s: %s\n", name, args[i+1])
+				os.Exit(1)
+			}
+			rest := append(append([]string{}, args[:i]...), args[i+2:]...)
+			return rest, d
+		}
+	}
+	return args, 0
+}
+
+// extractBoolFlag pulls a bare "--name" out of args and reports whether it
+// was present.
+func extractBoolFlag(args []string, name string) ([]string, bool) {
+	for i, a := range args {
+		if a == name {
+			rest := append(append([]string{}, args[:i]...), args[i+1:]...)
+			return rest, true
+		}
+	}
+	return args, false
+}
+
+// extractStringFlag pulls "--name <value>" out of args (if present) and
+// returns the remaining args plus the raw value. Empty means "not set".
+func extractStringFlag(args []string, name string) ([]string, string) {
+	for i, a := range args {
+		if a == name && i+1 < len(args) {
+			rest := append(append([]string{}, args[:i]...), args[i+2:]...)
+			return rest, args[i+1]
+		}
+	}
+	return args, ""
+}
+
 func handleTransferCLI(args []string) {
+	args, overallTimeout := extractDurationFlag(args, "--timeout")
+	args, fileTimeout := extractDurationFlag(args, "--file-timeout")
+	args, chmodStr := extractStringFlag(args, "--chmod")
+	args, rateConfig := extractStringFlag(args, "--bwlimit-config")
+	args, maxDepthStr := extractStringFlag(args, "--max-depth")
+	args, planJSON := extractBoolFlag(args, "--plan-json")
+	args, dryRun := extractBoolFlag(args, "--dry-run")
+
+	if rateConfig != "" {
+		if err := pfte.LoadRateSchedule(rateConfig); err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	maxDepth := -1
+	if maxDepthStr != "" {
+		parsed, err := strconv.Atoi(maxDepthStr)
+		if err != nil || parsed < 0 {
+			fmt.Printf("Error: invalid --max-depth value %q (expected 0, 1, 2, ...)\n", maxDepthStr)
+			os.Exit(1)
+		}
+		maxDepth = parsed
+	}
+
+	var forceMode os.FileMode
+	if chmodStr != "" {
+		parsed, err := strconv.ParseUint(chmodStr, 8, 32)
+		if err != nil || parsed > 0777 {
+			fmt.Printf("Error: invalid --chmod value %q (expected octal like 644)\n", chmodStr)
+			os.Exit(1)
+		}
+		forceMode = os.FileMode(parsed)
+	}
+
 	if len(args) < 6 {
 		fmt.Println("Error: Missing arguments.")
 		fmt.Println("Usage: fileripper transfer <host> <port> <user> <pass> [--upload <local> <remote_dest> | --download <remote>]")
@@ -77,7 +159,8 @@ func handleTransferCLI(args []string) {
 
 	operation := "DOWNLOAD"
 	sourcePath := "."
-	destPath := "." 
+	destPath := "."
+	toStdout := false
 
 	if len(args) > 6 {
 		mode := strings.ToLower(args[6])
@@ -95,9 +178,17 @@ func handleTransferCLI(args []string) {
 				rawPath := args[7]
 				sourcePath = filepath.ToSlash(rawPath)
 			}
+			if len(args) > 8 && args[8] == "-" {
+				toStdout = true
+			}
 		}
 	}
 
+	// "-" means stdin; combined with toStdout this makes the CLI pipeable
+	// (mysqldump | fileripper transfer ... --upload - /backup.sql).
+	fromStdin := operation == "UPLOAD" && sourcePath == "-"
+	streaming := fromStdin || toStdout
+
 	port, err := strconv.Atoi(portStr)
 	if err != nil {
 		fmt.Println("Error: Invalid port number.")
@@ -115,8 +206,20 @@ func handleTransferCLI(args []string) {
 	var sessions []*fileripper.Session
 	fmt.Printf(">> Network: Establishing %d parallel tunnels...\n", SessionCount)
 
+	bannerShown := false
 	for i := 0; i < SessionCount; i++ {
 		sess := fileripper.NewSession(host, port, user, password)
+		// Busy servers sometimes refuse the 2nd tunnel for a moment;
+		// a couple of retries beats dying on a scheduled job.
+		sess.SetConnectRetry(3, 2*time.Second)
+		sess.SetBannerCallback(func(message string) error {
+			// Only print it once, not per parallel session.
+			if !bannerShown {
+				bannerShown = true
+				fmt.Printf(">> Server banner:\n%s\n", strings.TrimRight(message, "\n"))
+			}
+			return nil
+		})
 		if err := sess.Connect(); err != nil {
 			fmt.Printf("Error connecting session #%d: %v\n", i+1, err)
 			os.Exit(1)
@@ -131,52 +234,155 @@ func handleTransferCLI(args []string) {
 	}()
 
 	client := fileripper.NewClient()
+	client.SetTimeouts(overallTimeout, fileTimeout)
+	if maxDepth >= 0 {
+		client.SetMaxDepth(maxDepth)
+	}
+	if forceMode != 0 {
+		// Same mode for dirs, plus execute where read is set, so forced
+		// 644 files still live in traversable 755 directories.
+		dirMode := forceMode | ((forceMode & 0444) >> 2)
+		client.SetForceModes(forceMode, dirMode)
+	}
 	ctx := context.Background()
 	startTime := time.Now()
 
+	// Plan-only: emit the job list as NDJSON on stdout and stop. Stdout
+	// stays machine-clean; anything human goes to stderr.
+	if planJSON {
+		if err := client.StreamPlan(ctx, sessions[:1], operation, sourcePath, destPath, os.Stdout); err != nil {
+			fmt.Fprintf(os.Stderr, ">> Status: Planning failed: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Fprintf(os.Stderr, ">> Status: Plan written in %s. Nothing was transferred.\n",
+			time.Since(startTime).Round(time.Millisecond))
+		return
+	}
+
+	if dryRun {
+		client.SetDryRun(true)
+		if err := client.Transfer(ctx, sessions[:1], operation, sourcePath, destPath); err != nil {
+			fmt.Fprintf(os.Stderr, ">> Status: Dry run failed: %v\n", err)
+			os.Exit(1)
+		}
+		plan := client.LastPlan()
+		for _, d := range plan.Dirs {
+			fmt.Printf("   mkdir      %s\n", d)
+		}
+		for _, f := range plan.Files {
+			from, to := f.LocalPath, f.RemotePath
+			if operation == "DOWNLOAD" {
+				from, to = f.RemotePath, f.LocalPath
+			}
+			fmt.Printf("   %-10s %s -> %s\n", formatBytes(f.Size), from, to)
+		}
+		fmt.Printf(">> Dry run: %d file(s), %s, %d new director(y/ies). Nothing was transferred.\n",
+			plan.TotalFiles, formatBytes(plan.TotalBytes), plan.TotalDirs)
+		return
+	}
+
 	// --- CLI DASHBOARD GOROUTINE ---
+	// Suppressed when streaming: the dashboard writes to stdout and would
+	// corrupt a piped payload.
 	stopMonitor := make(chan bool)
-	go func() {
-		ticker := time.NewTicker(500 * time.Millisecond)
-		defer ticker.Stop()
-		for {
-			select {
-			case <-stopMonitor:
-				return
-			case <-ticker.C:
-				stats := pfte.GlobalMonitor.GetStats()
-				if stats.IsRunning {
-					elapsed := time.Since(startTime).Round(time.Second)
-					// \r moves cursor to start, \033[K clears the line forward to prevent stuttering
-					fmt.Printf("\r\033[KTransferred: %s / %s, %.0f%%, %.2f MB/s, ETA %s | Files: %d/%d | %s",
-						formatBytes(stats.BytesDone), formatBytes(stats.TotalBytes),
-						stats.ProgressPercent, stats.SpeedMBs,
-						calculateETA(stats.BytesDone, stats.TotalBytes, stats.SpeedMBs),
-						stats.FilesDone, stats.TotalFiles,
-						elapsed)
+	if !streaming {
+		go func() {
+			ticker := time.NewTicker(500 * time.Millisecond)
+			defer ticker.Stop()
+			for {
+				select {
+				case <-stopMonitor:
+					return
+				case <-ticker.C:
+					stats := pfte.GlobalMonitor.GetStats()
+					if stats.IsRunning {
+						elapsed := time.Since(startTime).Round(time.Second)
+						// \r moves cursor to start, \033[K clears the line forward to prevent stuttering
+						fmt.Printf("\r\033[KTransferred: %s / %s, %.0f%%, %.2f MB/s, ETA %s | Files: %d/%d | %s | %s%s",
+							formatBytes(stats.BytesDone), formatBytes(stats.TotalBytes),
+							stats.ProgressPercent, stats.SpeedMBs,
+							calculateETA(stats.BytesDone, stats.TotalBytes, stats.SpeedMBs),
+							stats.FilesDone, stats.TotalFiles,
+							elapsed, stats.Phase, formatRecentFiles(stats.RecentFiles))
+					}
 				}
 			}
-		}
-	}()
+		}()
+	}
 
 	// Execute the Transfer
-	errTransfer := client.Transfer(ctx, sessions, operation, sourcePath, destPath)
+	var errTransfer error
+	switch {
+	case fromStdin:
+		errTransfer = client.UploadStream(ctx, sessions[:1], os.Stdin, destPath)
+	case toStdout:
+		errTransfer = client.DownloadStream(ctx, sessions[:1], sourcePath, os.Stdout)
+	default:
+		errTransfer = client.Transfer(ctx, sessions, operation, sourcePath, destPath)
+	}
 
 	// Stop monitor and wait a bit for the last print
-	stopMonitor <- true
-	time.Sleep(150 * time.Millisecond)
+	if !streaming {
+		stopMonitor <- true
+		time.Sleep(150 * time.Millisecond)
+	}
+
+	if streaming {
+		// Keep stdout clean for piped data; a one-liner on stderr is enough.
+		if errTransfer == nil {
+			fmt.Fprintf(os.Stderr, ">> Status: Finished %s stream in %s.\n",
+				strings.ToLower(operation), time.Since(startTime).Round(time.Second))
+		} else {
+			fmt.Fprintf(os.Stderr, ">> Status: Stream failed: %v\n", errTransfer)
+			os.Exit(1)
+		}
+		return
+	}
 
-	// --- FINAL SUMMARY (Fixes the 2/3 bug and adds Rclone-style finish) ---
+	// --- FINAL SUMMARY (Rclone-style finish) ---
 	stats := pfte.GlobalMonitor.GetStats()
 	totalElapsed := time.Since(startTime).Round(time.Second)
 
 	if errTransfer == nil {
-		// Force the 100% display and correct file count
-		fmt.Printf("\r\033[KTransferred: %s / %s, 100%%, %.2f MB/s, ETA 0s | Files: %d/%d | %s\n",
-			formatBytes(stats.TotalBytes), formatBytes(stats.TotalBytes),
-			stats.SpeedMBs, stats.TotalFiles, stats.TotalFiles, totalElapsed)
-		
+		// Real numbers, not a cosmetic TotalFiles/TotalFiles: with failures
+		// or per-file skips in the batch, "47/50" is the truth the user needs.
+		fmt.Printf("\r\033[KTransferred: %s / %s, %.0f%%, %.2f MB/s, ETA 0s | Files: %d/%d | %s\n",
+			formatBytes(stats.BytesDone), formatBytes(stats.TotalBytes),
+			stats.ProgressPercent, stats.SpeedMBs, stats.FilesDone, stats.TotalFiles, totalElapsed)
+
 		fmt.Printf(">> Status: Finished %s successfully in %s.\n", strings.ToLower(operation), totalElapsed)
+		if failures := client.Failures(); len(failures) > 0 {
+			// Name the casualties — a count alone sends the user diffing
+			// trees to find out what's missing.
+			fmt.Printf(">> Warning: %d file(s) failed:\n", len(failures))
+			shown := 0
+			for _, f := range failures {
+				if shown >= 5 {
+					fmt.Printf("   ... and %d more\n", len(failures)-shown)
+					break
+				}
+				fmt.Printf("   %s: %v\n", f.Path, f.Err)
+				shown++
+			}
+		}
+		if n := len(stats.SkippedByUser); n > 0 {
+			fmt.Printf(">> Note: %d file(s) skipped by user.\n", n)
+		}
+
+		// A clean finish can still hide a flaky link; show who struggled.
+		if retried := pfte.GlobalMonitor.RetriedFiles(); len(retried) > 0 {
+			fmt.Printf(">> Warning: %d file(s) needed retries (%d failed attempts total):\n",
+				len(retried), stats.TotalRetries)
+			shown := 0
+			for file, count := range retried {
+				if shown >= 5 {
+					fmt.Printf("   ... and %d more\n", len(retried)-shown)
+					break
+				}
+				fmt.Printf("   %s (%d failed attempts)\n", file, count)
+				shown++
+			}
+		}
 	} else {
 		fmt.Printf("\n>> Status: Transfer failed after %s: %v\n", totalElapsed, errTransfer)
 	}
@@ -195,6 +401,28 @@ func formatBytes(b int64) string {
 	return fmt.Sprintf("%.2f %cB", float64(b)/float64(div), "KMGTPE"[exp])
 }
 
+// formatRecentFiles renders the newest in-flight filenames so a stall is
+// diagnosable ("which file is stuck?") instead of a frozen percentage.
+func formatRecentFiles(recent []string) string {
+	if len(recent) == 0 {
+		return ""
+	}
+	const show = 2
+	start := len(recent) - show
+	if start < 0 {
+		start = 0
+	}
+	var names []string
+	for _, f := range recent[start:] {
+		name := filepath.Base(f)
+		if len(name) > 28 {
+			name = name[:25] + "..."
+		}
+		names = append(names, name)
+	}
+	return " [" + strings.Join(names, ", ") + "]"
+}
+
 func calculateETA(done, total int64, speedMBs float64) string {
 	if speedMBs <= 0 {
 		return "---"
@@ -214,5 +442,13 @@ Usage: fileripper [command] [args]
 Commands:
   start-server [port]   Start REST API Daemon
   transfer              <host> <port> <user> <pass> [--upload <local> <remote_dest> | --download <remote>]
-`)
+                        a trailing slash on the source means "its contents": --download reports/
+                        lands the files directly in dump/, without the extra reports/ level
+                        [--timeout <dur>] [--file-timeout <dur>] [--chmod <octal>] [--max-depth <n>]
+                        [--plan-json]  print the planned jobs as NDJSON and exit without transferring
+                        [--dry-run]    print each planned action and the total size, transfer nothing
+                      [--bwlimit-config <json>]  throughput schedule, e.g.
+                      {"limit": 0, "windows": [{"start": "09:00", "end": "17:30", "limit": 1048576}]}
+  profiles              <list|test|add|remove> [name]   manage saved connections (~/.fileripper/profiles.json)
+  benchmark             <host> <port> <user> <pass> [--save <profile>]   find the best settings for a link`)
 }
\ No newline at end of file
@@ -0,0 +1,206 @@
+/*
+ * Copyright 2026 The FileRipper Team
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"fileripper"
+)
+
+// Profile is one saved connection. Passwords are deliberately absent: a
+// profile identifies where and who, and the secret is prompted for when it's
+// actually needed.
+type Profile struct {
+	Host string `json:"host"`
+	Port int    `json:"port"`
+	User string `json:"user"`
+
+	// Tuning recommendation, filled in by `fileripper benchmark --save`.
+	Sessions int    `json:"sessions,omitempty"`
+	Mode     string `json:"mode,omitempty"` // "boost" or "conservative"
+}
+
+// profilesPath is where the profile store lives: ~/.fileripper/profiles.json.
+func profilesPath() (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("cannot locate home directory: %v", err)
+	}
+	return filepath.Join(home, ".fileripper", "profiles.json"), nil
+}
+
+// loadProfiles reads the store; a missing file is just an empty store.
+func loadProfiles(path string) (map[string]Profile, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return map[string]Profile{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	profiles := map[string]Profile{}
+	if err := json.Unmarshal(data, &profiles); err != nil {
+		return nil, fmt.Errorf("invalid profile store %s: %v", path, err)
+	}
+	return profiles, nil
+}
+
+func saveProfiles(path string, profiles map[string]Profile) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(profiles, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0600)
+}
+
+// handleProfilesCLI implements `fileripper profiles list|test|add|remove`.
+func handleProfilesCLI(args []string) {
+	if len(args) < 3 {
+		fmt.Println("Usage: fileripper profiles <list|test|add|remove> [name]")
+		os.Exit(1)
+	}
+
+	path, err := profilesPath()
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+	profiles, err := loadProfiles(path)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	switch args[2] {
+	case "list":
+		if len(profiles) == 0 {
+			fmt.Println("No profiles saved. Create one with: fileripper profiles add <name>")
+			return
+		}
+		names := make([]string, 0, len(profiles))
+		for name := range profiles {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			p := profiles[name]
+			fmt.Printf("  %-20s %s@%s:%d\n", name, p.User, p.Host, p.Port)
+		}
+
+	case "test":
+		name := requireProfileName(args)
+		p, ok := profiles[name]
+		if !ok {
+			fmt.Printf("Error: no profile named %q\n", name)
+			os.Exit(1)
+		}
+		password := promptLine(fmt.Sprintf("Password for %s@%s: ", p.User, p.Host))
+		session := fileripper.NewSession(p.Host, p.Port, p.User, password)
+		result := session.TestConnection(context.Background())
+		fmt.Printf("  Reachable:     %v (%d ms)\n", result.Reachable, result.LatencyMs)
+		fmt.Printf("  Authenticated: %v\n", result.Authenticated)
+		if result.AuthMethod != "" {
+			fmt.Printf("  Auth method:   %s\n", result.AuthMethod)
+		}
+		if result.HostKey != "" {
+			fmt.Printf("  Host key:      %s\n", result.HostKey)
+		}
+		if result.Error != "" {
+			fmt.Printf("  Error:         %s\n", result.Error)
+		}
+		if !result.Authenticated {
+			os.Exit(1)
+		}
+
+	case "add":
+		name := requireProfileName(args)
+		if _, exists := profiles[name]; exists {
+			fmt.Printf("Error: profile %q already exists (remove it first)\n", name)
+			os.Exit(1)
+		}
+		host := promptLine("Host: ")
+		if host == "" {
+			fmt.Println("Error: host is required")
+			os.Exit(1)
+		}
+		portStr := promptLine("Port [22]: ")
+		port := 22
+		if portStr != "" {
+			port, err = strconv.Atoi(portStr)
+			if err != nil || port < 1 || port > 65535 {
+				fmt.Printf("Error: invalid port %q\n", portStr)
+				os.Exit(1)
+			}
+		}
+		user := promptLine("User: ")
+		if user == "" {
+			fmt.Println("Error: user is required")
+			os.Exit(1)
+		}
+		profiles[name] = Profile{Host: host, Port: port, User: user}
+		if err := saveProfiles(path, profiles); err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Printf("Saved profile %q. Passwords are never stored; you'll be asked when connecting.\n", name)
+
+	case "remove":
+		name := requireProfileName(args)
+		if _, ok := profiles[name]; !ok {
+			fmt.Printf("Error: no profile named %q\n", name)
+			os.Exit(1)
+		}
+		delete(profiles, name)
+		if err := saveProfiles(path, profiles); err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Printf("Removed profile %q.\n", name)
+
+	default:
+		fmt.Printf("Error: unknown profiles subcommand %q\n", args[2])
+		fmt.Println("Usage: fileripper profiles <list|test|add|remove> [name]")
+		os.Exit(1)
+	}
+}
+
+func requireProfileName(args []string) string {
+	if len(args) < 4 || args[3] == "" {
+		fmt.Println("Error: profile name required")
+		os.Exit(1)
+	}
+	return args[3]
+}
+
+// promptLine asks on stdout and reads one trimmed line from stdin.
+func promptLine(prompt string) string {
+	fmt.Print(prompt)
+	line, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+	return strings.TrimSpace(line)
+}
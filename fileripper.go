@@ -1,88 +1,866 @@
-/*
- * Copyright 2026 The FileRipper Team
- *
- * Licensed under the Apache License, Version 2.0 (the "License");
- * you may not use this file except in compliance with the License.
- * You may obtain a copy of the License at
- *
- *     http://www.apache.org/licenses/LICENSE-2.0
- *
- * Unless required by applicable law or agreed to in writing, software
- * distributed under the License is distributed on an "AS IS" BASIS,
- * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
- * See the License for the specific language governing permissions and
- * limitations under the License.
- */
-
-package fileripper
-
-import (
-	"context"
-	"fileripper/internal/network"
-	"fileripper/internal/pfte"
-)
-
-// Client is the main interface for the library
-type Client struct {
-	engine *pfte.Engine
-}
-
-// NewClient creates a new FileRipper instance
-func NewClient() *Client {
-	return &Client{
-		engine: pfte.NewEngine(),
-	}
-}
-
-// Session represents a connection to a remote server
-type Session struct {
-	inner *network.SftpSession
-}
-
-// NewSession prepares a new connection (it doesn't connect yet)
-func NewSession(host string, port int, user, password string) *Session {
-	return &Session{
-		inner: network.NewSession(host, port, user, password),
-	}
-}
-
-// Connect opens the SSH tunnel and SFTP subsystem
-func (s *Session) Connect() error {
-	if err := s.inner.Connect(); err != nil {
-		return err
-	}
-	return s.inner.OpenSFTP()
-}
-
-// Close shuts down the connection
-func (s *Session) Close() {
-	s.inner.Close()
-}
-
-func (c *Client) Transfer(ctx context.Context, sessions []*Session, operation, source, dest string) error {
-	sftpSessions := make([]*network.SftpSession, len(sessions))
-	for i, s := range sessions {
-		sftpSessions[i] = s.inner
-	}
-	return c.engine.StartTransfer(ctx, sftpSessions, operation, source, dest)
-}
-
-func (c *Client) UploadFile(ctx context.Context, sessions []*Session, local, remote string) error {
-	s := make([]*network.SftpSession, len(sessions))
-	for i, sess := range sessions {
-		s[i] = sess.inner
-	}
-	return c.engine.UploadSpecificFile(ctx, s, local, remote)
-}
-
-func (c *Client) DownloadFile(ctx context.Context, sessions []*Session, remote, local string) error {
-	s := make([]*network.SftpSession, len(sessions))
-	for i, sess := range sessions {
-		s[i] = sess.inner
-	}
-	return c.engine.DownloadSpecificFile(ctx, s, remote, local)
-}
-
-func (c *Client) SetMode(mode pfte.TransferMode) {
-	c.engine.Mode = mode
-}
+/*
+ * Copyright 2026 The FileRipper Team
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package fileripper
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"time"
+
+	"github.com/kr/fs"
+
+	"fileripper/internal/core"
+	"fileripper/internal/network"
+	"fileripper/internal/pfte"
+)
+
+// Client is the main interface for the library
+type Client struct {
+	engine *pfte.Engine
+}
+
+// Option tweaks a Client at construction time; see the With* functions.
+type Option func(*Client)
+
+// WithMode picks the concurrency profile up front, same as calling SetMode
+// before the first transfer.
+func WithMode(mode pfte.TransferMode) Option {
+	return func(c *Client) { c.engine.Mode = mode }
+}
+
+// WithConcurrency pins the worker count exactly, overriding whatever the
+// mode would have chosen.
+func WithConcurrency(n int) Option {
+	return func(c *Client) { c.engine.Concurrency = n }
+}
+
+// WithBufferSize sets the copy buffer for streamed transfers. The buffers
+// live in the shared transfer path, so this is process-wide, not per-client.
+func WithBufferSize(n int) Option {
+	return func(c *Client) {
+		if n > 0 {
+			pfte.BufferSize = n
+		}
+	}
+}
+
+// WithMultipartThreshold sets the file size above which transfers split
+// into parallel chunks. Process-wide, like WithBufferSize.
+func WithMultipartThreshold(bytes int64) Option {
+	return func(c *Client) {
+		if bytes > 0 {
+			pfte.MultipartThreshold = bytes
+		}
+	}
+}
+
+// WithAdaptiveBuffers toggles per-stream buffer growth on fast links and
+// caps how large the buffers may get (0 keeps the current cap).
+// Process-wide, like the other buffer knobs.
+func WithAdaptiveBuffers(enabled bool, max int) Option {
+	return func(c *Client) {
+		pfte.AdaptiveBuffers = enabled
+		if max > 0 {
+			pfte.MaxBufferSize = max
+		}
+	}
+}
+
+// NewClient creates a new FileRipper instance
+func NewClient(opts ...Option) *Client {
+	c := &Client{
+		engine: pfte.NewEngine(),
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// Session represents a connection to a remote server
+type Session struct {
+	inner *network.SftpSession
+}
+
+// NewSession prepares a new connection (it doesn't connect yet)
+func NewSession(host string, port int, user, password string) *Session {
+	return &Session{
+		inner: network.NewSession(host, port, user, password),
+	}
+}
+
+// NewSessionWithKey prepares a connection that authenticates with an
+// in-memory private key (PEM bytes, passphrase for encrypted keys) instead
+// of a password — for servers that have password auth disabled, or callers
+// that keep keys out of the filesystem entirely.
+func NewSessionWithKey(host string, port int, user string, pemBytes []byte, passphrase string) *Session {
+	return &Session{
+		inner: network.NewSessionWithKey(host, port, user, pemBytes, passphrase),
+	}
+}
+
+// NewSessionThroughJump prepares a connection that reaches its target
+// through jump, an already-connected bastion session — for servers only
+// reachable via a jump host (the ssh ProxyJump pattern). Closing the
+// returned session does not touch the bastion.
+func NewSessionThroughJump(jump *Session, host string, port int, user, password string) *Session {
+	return &Session{
+		inner: network.NewSessionThroughJump(jump.inner, host, port, user, password),
+	}
+}
+
+// SetTuning adjusts SFTP protocol parameters for this session. Must be
+// called before Connect to take effect.
+func (s *Session) SetTuning(t network.SftpTuning) {
+	s.inner.Tuning = &t
+}
+
+// TestConnection checks reachability and credentials without opening the
+// SFTP subsystem. The context is accepted for API symmetry; internally the
+// probe is bounded by dial/handshake timeouts.
+func (s *Session) TestConnection(ctx context.Context) network.TestResult {
+	return s.inner.TestConnection()
+}
+
+// SetKeyAuth offers the private key at keyPath for public-key auth, with an
+// optional passphrase for encrypted keys. The key is tried before the agent
+// and the password; whichever method the server accepts is reported by
+// AuthMethod after connecting.
+func (s *Session) SetKeyAuth(keyPath, passphrase string) {
+	s.inner.KeyPath = keyPath
+	s.inner.KeyPassphrase = passphrase
+}
+
+// SetPinnedFingerprint pins the server's host key: Connect only succeeds
+// when the presented key's SHA-256 fingerprint matches (ssh-keygen's
+// "SHA256:..." form or the bare base64 digest). For single-server deploys
+// where a known_hosts file is more trouble than it's worth.
+func (s *Session) SetPinnedFingerprint(fingerprint string) {
+	s.inner.PinnedFingerprint = fingerprint
+}
+
+// AuthMethod names the auth method the server accepted on the last
+// successful Connect: "key", "agent", "keyboard-interactive" or "password".
+// Empty before connecting.
+func (s *Session) AuthMethod() string {
+	return s.inner.AuthMethodUsed
+}
+
+// SetSubsystem changes how the SFTP channel is requested after connecting.
+// Locked-down appliances sometimes register SFTP under a non-standard
+// subsystem name, or only expose the server binary itself — pass
+// isCommand=true for the latter (e.g. "/usr/libexec/sftp-server"). Empty
+// name keeps the standard "sftp" subsystem request.
+func (s *Session) SetSubsystem(name string, isCommand bool) {
+	s.inner.Subsystem = name
+	s.inner.SubsystemIsCommand = isCommand
+}
+
+// SetBannerCallback registers a handler for the server's pre-auth banner.
+// Returning an error from the callback aborts the connection.
+func (s *Session) SetBannerCallback(cb func(message string) error) {
+	s.inner.Banner = cb
+}
+
+// SetResolvedAddress overrides where the TCP connection is dialed ("10.0.0.5",
+// "fd00::5", or host:port) while the session's hostname stays what it was —
+// the name shown in stats and checked against the host key. Useful behind
+// split-horizon DNS or custom resolvers.
+func (s *Session) SetResolvedAddress(addr string) {
+	s.inner.ResolvedAddr = addr
+}
+
+// SetProxy routes this session's TCP connection through a proxy before the
+// SSH handshake: "socks5://host:1080" or "http://host:3128" (CONNECT),
+// credentials in the URL if needed. Unset, the ALL_PROXY environment
+// variable applies; without either the dial is direct.
+func (s *Session) SetProxy(proxyURL string) {
+	s.inner.ProxyURL = proxyURL
+}
+
+// SetDialTimeout bounds the TCP dial and SSH handshake (default 10s).
+func (s *Session) SetDialTimeout(d time.Duration) {
+	s.inner.DialTimeout = d
+}
+
+// SetKeepalive sends an SSH keepalive every interval while connected, so
+// idle stretches of a long batch don't get the tunnel dropped by a NAT or
+// VPN middlebox. Zero (the default) sends none. Call before Connect.
+func (s *Session) SetKeepalive(interval time.Duration) {
+	s.inner.KeepaliveInterval = interval
+}
+
+// SetConnectRetry makes Connect survive transient network failures: up to
+// retries extra attempts, waiting delay before the first (doubling after).
+// Auth failures are never retried.
+func (s *Session) SetConnectRetry(retries int, delay time.Duration) {
+	s.inner.ConnectRetries = retries
+	s.inner.ConnectBackoff = delay
+}
+
+// Connect opens the SSH tunnel and SFTP subsystem
+func (s *Session) Connect() error {
+	return s.ConnectContext(context.Background())
+}
+
+// ConnectContext is Connect with cancellation over the retry waits.
+func (s *Session) ConnectContext(ctx context.Context) error {
+	if err := s.inner.ConnectWithRetry(ctx); err != nil {
+		return err
+	}
+	return s.inner.OpenSFTP()
+}
+
+// SetWorkDir sets the session's client-side working directory: relative
+// remote paths in any later call resolve under it, absolute paths bypass it.
+// Set it to "" to go back to the server's default.
+func (s *Session) SetWorkDir(dir string) {
+	s.inner.WorkDir = dir
+}
+
+// Walk returns a remote tree walker rooted at root, for callers that need
+// to look around without starting a transfer.
+func (s *Session) Walk(root string) *fs.Walker {
+	return s.inner.Walk(root)
+}
+
+// -- Remote file management --
+//
+// Thin wrappers over the session's SFTP client, so Go callers can manage
+// remote files without the HTTP daemon. Each takes a context for
+// consistency with Transfer; "not found" comes back wrapping the same
+// source_not_found sentinel the engine uses.
+
+// Stat returns the metadata of a remote path.
+func (s *Session) Stat(ctx context.Context, remotePath string) (os.FileInfo, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	st, err := s.inner.Stat(remotePath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, fmt.Errorf("%w: %s", core.ErrSourceNotFound, remotePath)
+		}
+		return nil, err
+	}
+	return st, nil
+}
+
+// Mkdir creates one remote directory, this level only: a missing parent is
+// an error, like mkdir without -p.
+func (s *Session) Mkdir(ctx context.Context, remotePath string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if parent := path.Dir(remotePath); parent != "." && parent != "/" {
+		if st, err := s.inner.Stat(parent); err != nil || !st.IsDir() {
+			return fmt.Errorf("%w: parent %s does not exist", core.ErrSourceNotFound, parent)
+		}
+	}
+	if _, err := s.inner.Stat(remotePath); err == nil {
+		return fmt.Errorf("mkdir %s: %w", remotePath, os.ErrExist)
+	}
+	// The parent exists and the target doesn't, so this creates exactly
+	// one level.
+	return s.inner.MkdirAll(remotePath)
+}
+
+// MkdirAll creates a remote directory and any missing parents; one that
+// already exists is a success, like mkdir -p.
+func (s *Session) MkdirAll(ctx context.Context, remotePath string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return s.inner.MkdirAll(remotePath)
+}
+
+// Remove deletes a remote file (or empty directory).
+func (s *Session) Remove(ctx context.Context, remotePath string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if err := s.inner.Remove(remotePath); err != nil {
+		if os.IsNotExist(err) {
+			return fmt.Errorf("%w: %s", core.ErrSourceNotFound, remotePath)
+		}
+		return err
+	}
+	return nil
+}
+
+// RemoveAll deletes a remote path and, when it's a directory, everything
+// under it. A path that's already gone is a success, like os.RemoveAll.
+func (s *Session) RemoveAll(ctx context.Context, remotePath string) error {
+	return s.inner.RemoveAll(ctx, remotePath)
+}
+
+// Rename moves a remote file or directory to a new name.
+func (s *Session) Rename(ctx context.Context, oldPath, newPath string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if err := s.inner.Rename(oldPath, newPath); err != nil {
+		if os.IsNotExist(err) {
+			return fmt.Errorf("%w: %s", core.ErrSourceNotFound, oldPath)
+		}
+		return err
+	}
+	return nil
+}
+
+// monitoredStream counts bytes through the global monitor, so streamed IO
+// shows up on the same progress counters as a regular transfer.
+type monitoredStream struct {
+	inner network.RemoteFile
+}
+
+func (m *monitoredStream) Read(p []byte) (int, error) {
+	n, err := m.inner.Read(p)
+	if n > 0 {
+		pfte.GlobalMonitor.AddBytes(int64(n))
+	}
+	return n, err
+}
+
+func (m *monitoredStream) Write(p []byte) (int, error) {
+	n, err := m.inner.Write(p)
+	if n > 0 {
+		pfte.GlobalMonitor.AddBytes(int64(n))
+	}
+	return n, err
+}
+
+func (m *monitoredStream) Close() error { return m.inner.Close() }
+
+// OpenReader opens a remote file for streaming reads — pipe remote logs
+// straight into gzip, an HTTP response, whatever — without staging anything
+// under dump/. The caller owns the Close.
+func (s *Session) OpenReader(remotePath string) (io.ReadCloser, error) {
+	f, err := s.inner.Open(remotePath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, fmt.Errorf("%w: %s", core.ErrSourceNotFound, remotePath)
+		}
+		return nil, err
+	}
+	return &monitoredStream{inner: f}, nil
+}
+
+// OpenWriter creates (or truncates) a remote file for streaming writes, the
+// push twin of OpenReader. Missing parent directories are created, matching
+// how uploads behave. The bytes only become durable on Close.
+func (s *Session) OpenWriter(remotePath string) (io.WriteCloser, error) {
+	if dir := path.Dir(remotePath); dir != "." && dir != "/" {
+		_ = s.inner.MkdirAll(dir)
+	}
+	f, err := s.inner.Create(remotePath)
+	if err != nil {
+		return nil, err
+	}
+	return &monitoredStream{inner: f}, nil
+}
+
+// Close shuts down the connection
+func (s *Session) Close() {
+	s.inner.Close()
+}
+
+func (c *Client) Transfer(ctx context.Context, sessions []*Session, operation, source, dest string) error {
+	sftpSessions := make([]*network.SftpSession, len(sessions))
+	for i, s := range sessions {
+		sftpSessions[i] = s.inner
+	}
+	return c.engine.StartTransfer(ctx, sftpSessions, operation, source, dest)
+}
+
+// FileEntry is one row of a directory listing, the library-level twin of
+// what the daemon's /api/files hands to the UI.
+type FileEntry struct {
+	Name      string
+	Size      int64
+	Mode      os.FileMode
+	ModTime   time.Time
+	IsDir     bool
+	IsSymlink bool
+	Target    string // symlink target, when readable
+}
+
+// List returns the entries of a remote directory, streamed rather than
+// slurped, so a huge directory stops costing anything the moment ctx is
+// cancelled. Use "." for the session's working directory.
+func (c *Client) List(ctx context.Context, session *Session, dirPath string) ([]FileEntry, error) {
+	stream, err := session.inner.ReadDirStream(dirPath)
+	if err != nil {
+		return nil, err
+	}
+	defer stream.Close()
+
+	var entries []FileEntry
+	for {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		f, err := stream.Next()
+		if err == io.EOF {
+			return entries, nil
+		}
+		if err != nil {
+			return entries, err
+		}
+
+		entry := FileEntry{
+			Name:    f.Name(),
+			Size:    f.Size(),
+			Mode:    f.Mode(),
+			ModTime: f.ModTime(),
+			IsDir:   f.IsDir(),
+		}
+		if f.Mode()&os.ModeSymlink != 0 {
+			entry.IsSymlink = true
+			if target, err := session.inner.ReadLink(path.Join(dirPath, f.Name())); err == nil {
+				entry.Target = target
+			}
+		}
+		entries = append(entries, entry)
+	}
+}
+
+// TransferBetween copies srcPath on one server straight to dstPath on
+// another, streaming through this process without staging on local disk.
+// Directories come over tree-and-all; progress, retries, and Failures()
+// behave like any other transfer.
+func (c *Client) TransferBetween(ctx context.Context, src, dst *Session, srcPath, dstPath string) error {
+	return c.engine.TransferBetween(ctx, src.inner, dst.inner, srcPath, dstPath)
+}
+
+func (c *Client) UploadFile(ctx context.Context, sessions []*Session, local, remote string) error {
+	s := make([]*network.SftpSession, len(sessions))
+	for i, sess := range sessions {
+		s[i] = sess.inner
+	}
+	return c.engine.UploadSpecificFile(ctx, s, local, remote)
+}
+
+// TouchSync walks both trees and, for files whose content matches but whose
+// remote mtime drifted, fixes just the timestamp via Chtimes — no data moves.
+// Returns how many timestamps were corrected.
+func (c *Client) TouchSync(ctx context.Context, sessions []*Session, local, remote string) (int, error) {
+	s := make([]*network.SftpSession, len(sessions))
+	for i, sess := range sessions {
+		s[i] = sess.inner
+	}
+	return c.engine.TouchSync(ctx, s, local, remote)
+}
+
+// AppendFile ships only the local bytes beyond the remote file's current
+// size, opening the remote with O_APPEND — made for continuously shipping a
+// growing log. A remote file larger than the local one (rotation) is an
+// error, not a guess.
+func (c *Client) AppendFile(ctx context.Context, sessions []*Session, local, remote string) error {
+	s := make([]*network.SftpSession, len(sessions))
+	for i, sess := range sessions {
+		s[i] = sess.inner
+	}
+	return c.engine.AppendFile(ctx, s, local, remote)
+}
+
+func (c *Client) DownloadFile(ctx context.Context, sessions []*Session, remote, local string) error {
+	s := make([]*network.SftpSession, len(sessions))
+	for i, sess := range sessions {
+		s[i] = sess.inner
+	}
+	return c.engine.DownloadSpecificFile(ctx, s, remote, local)
+}
+
+// UploadStream sends bytes from r (e.g. os.Stdin) to a remote file.
+// Multipart and resume are unavailable for non-seekable sources.
+func (c *Client) UploadStream(ctx context.Context, sessions []*Session, r io.Reader, remote string) error {
+	s := make([]*network.SftpSession, len(sessions))
+	for i, sess := range sessions {
+		s[i] = sess.inner
+	}
+	return c.engine.UploadStream(ctx, s, r, remote)
+}
+
+// DownloadStream writes a remote file to w (e.g. os.Stdout).
+func (c *Client) DownloadStream(ctx context.Context, sessions []*Session, remote string, w io.Writer) error {
+	s := make([]*network.SftpSession, len(sessions))
+	for i, sess := range sessions {
+		s[i] = sess.inner
+	}
+	return c.engine.DownloadStream(ctx, s, remote, w)
+}
+
+// DownloadRange writes just the bytes [start, end) of a remote file to w —
+// "show me the last megabyte of that log" without pulling the other forty.
+// end <= 0 means through end-of-file.
+func (c *Client) DownloadRange(ctx context.Context, sessions []*Session, remote string, start, end int64, w io.Writer) error {
+	s := make([]*network.SftpSession, len(sessions))
+	for i, sess := range sessions {
+		s[i] = sess.inner
+	}
+	return c.engine.DownloadRange(ctx, s, remote, start, end, w)
+}
+
+// Compare audits a local tree against a remote one without transferring:
+// per file it reports identical, modified, or missing on either side. With
+// checksum on, equality means byte content (CRC32) instead of size+mtime.
+func (c *Client) Compare(ctx context.Context, sessions []*Session, local, remote string, checksum bool) (*pfte.CompareReport, error) {
+	s := make([]*network.SftpSession, len(sessions))
+	for i, sess := range sessions {
+		s[i] = sess.inner
+	}
+	return c.engine.Compare(ctx, s, local, remote, checksum)
+}
+
+// Estimate sizes up a transfer before committing to it: total files, bytes
+// and dirs from a dry-run enumeration, plus — with probe on — a measured
+// throughput sample and the ETA it implies.
+func (c *Client) Estimate(ctx context.Context, sessions []*Session, operation, source, dest string, probe bool) (*pfte.TransferEstimate, error) {
+	s := make([]*network.SftpSession, len(sessions))
+	for i, sess := range sessions {
+		s[i] = sess.inner
+	}
+	return c.engine.Estimate(ctx, s, operation, source, dest, probe)
+}
+
+// RemoteManifest hashes every file under a remote path without downloading
+// anything, returning relative path -> hex digest. Supported algorithms:
+// pfte.AlgoCRC32 (default), AlgoMD5, AlgoSHA256. The manifest is the
+// baseline for later integrity audits.
+func (c *Client) RemoteManifest(ctx context.Context, sessions []*Session, root string, algo pfte.ManifestAlgo) (map[string]string, error) {
+	s := make([]*network.SftpSession, len(sessions))
+	for i, sess := range sessions {
+		s[i] = sess.inner
+	}
+	return c.engine.RemoteManifest(ctx, s, root, algo)
+}
+
+// SessionPool keeps warm, authenticated sessions between transfers so
+// back-to-back work skips the SSH handshake. Borrowed sessions are
+// health-checked; idle ones beyond the minimum are closed after the idle
+// timeout.
+type SessionPool struct {
+	inner *network.SessionPool
+}
+
+// NewSessionPool builds a pool over factory (which must Connect and open
+// SFTP on the session it returns). min sessions stay warm, at most max are
+// ever alive, and idle sessions past idleTimeout are reaped (0 keeps them
+// forever).
+func NewSessionPool(factory func() (*Session, error), min, max int, idleTimeout time.Duration) *SessionPool {
+	return &SessionPool{inner: network.NewSessionPool(func() (*network.SftpSession, error) {
+		s, err := factory()
+		if err != nil {
+			return nil, err
+		}
+		return s.inner, nil
+	}, min, max, idleTimeout)}
+}
+
+// Borrow hands out a healthy session, blocking while max are already out.
+func (p *SessionPool) Borrow(ctx context.Context) (*Session, error) {
+	s, err := p.inner.Borrow(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &Session{inner: s}, nil
+}
+
+// Return puts a borrowed session back for the next transfer.
+func (p *SessionPool) Return(s *Session) {
+	p.inner.Return(s.inner)
+}
+
+// Stats reports warm and borrowed session counts.
+func (p *SessionPool) Stats() (idle, inUse int) {
+	return p.inner.Stats()
+}
+
+// Close shuts the pool and its idle sessions.
+func (p *SessionPool) Close() {
+	p.inner.Close()
+}
+
+// Repair heals a possibly-corrupt local copy: every remote file is
+// checksummed against its local counterpart and only the damaged or missing
+// ones are re-downloaded — good files stay untouched. The report lists what
+// was repaired. Use it after a crash or a suspected disk problem; it's
+// stronger than a sync, which trusts size and mtime.
+func (c *Client) Repair(ctx context.Context, sessions []*Session, local, remote string) (*pfte.RepairReport, error) {
+	s := make([]*network.SftpSession, len(sessions))
+	for i, sess := range sessions {
+		s[i] = sess.inner
+	}
+	return c.engine.Repair(ctx, s, local, remote)
+}
+
+// StreamPlan writes the concrete planned job list to w as NDJSON — one
+// record per file, directory to create, or filtered-out entry (with the
+// reason) — then returns without transferring anything. The machine-readable
+// sibling of Estimate: feed it to approval tooling or an external mover.
+func (c *Client) StreamPlan(ctx context.Context, sessions []*Session, operation, source, dest string, w io.Writer) error {
+	s := make([]*network.SftpSession, len(sessions))
+	for i, sess := range sessions {
+		s[i] = sess.inner
+	}
+	return c.engine.StreamPlan(ctx, s, operation, source, dest, w)
+}
+
+// TransferList moves an explicit list of files (e.g. from a manifest),
+// preserving the given layout, without walking any source path.
+func (c *Client) TransferList(ctx context.Context, sessions []*Session, operation string, specs []pfte.FileSpec) error {
+	s := make([]*network.SftpSession, len(sessions))
+	for i, sess := range sessions {
+		s[i] = sess.inner
+	}
+	return c.engine.TransferList(ctx, s, operation, specs)
+}
+
+// SkipFile cancels just the in-flight transfer of remotePath — the batch
+// keeps running. Returns false when no worker is currently on that file.
+// Skipped files land in the stats under "skipped_by_user".
+func (c *Client) SkipFile(remotePath string) bool {
+	return pfte.CancelFile(remotePath)
+}
+
+// SetMode selects the concurrency profile. It takes effect when the next
+// transfer starts; use ScaleWorkers to adjust one already in flight.
+func (c *Client) SetMode(mode pfte.TransferMode) {
+	c.engine.Mode = mode
+}
+
+// ScaleWorkers changes the worker count of the transfer running right now —
+// dial it down when the server is struggling, back up when it recovers —
+// without aborting anything in flight. Returns false when no transfer is
+// active.
+func (c *Client) ScaleWorkers(n int) bool {
+	return pfte.ScaleWorkers(n)
+}
+
+// SetResume enables resumable transfers: interrupted multipart uploads
+// restart from their per-chunk journal, and interrupted downloads append to
+// their .fr-part partial, instead of starting over from byte zero.
+func (c *Client) SetResume(resume bool) {
+	c.engine.Resume = resume
+}
+
+// SetMaxOpenFiles caps how many files the engine holds open at once,
+// independent of worker count. n <= 0 restores the OS-derived default.
+// Call before starting a transfer.
+func (c *Client) SetMaxOpenFiles(n int) {
+	pfte.SetOpenFileLimit(n)
+}
+
+// SetVerification enables post-download checksum verification and selects
+// what to do when a file fails it (default: retry, then fail).
+func (c *Client) SetVerification(verify bool, policy pfte.MismatchPolicy) {
+	c.engine.VerifyDownloads = verify
+	c.engine.MismatchPolicy = policy
+}
+
+// SetContentsOnly controls whether uploads include the source's top-level
+// directory in the remote layout (false, default) or place its contents
+// directly under the destination (true).
+func (c *Client) SetContentsOnly(contentsOnly bool) {
+	c.engine.ContentsOnly = contentsOnly
+}
+
+// SetDirModePolicy controls permissions on created directories: preserve
+// copies the source directory's mode, otherwise defaultMode is applied
+// (0 keeps the target's defaults).
+func (c *Client) SetDirModePolicy(preserve bool, defaultMode os.FileMode) {
+	c.engine.PreserveDirModes = preserve
+	c.engine.DefaultDirMode = defaultMode
+}
+
+// SetFileModePolicy controls permissions on downloaded files: preserve
+// copies the remote file's mode (keeping executable bits and tight perms),
+// otherwise defaultMode is applied (0 keeps os.Create's umask-derived mode).
+func (c *Client) SetFileModePolicy(preserve bool, defaultMode os.FileMode) {
+	c.engine.PreserveFileModes = preserve
+	c.engine.DefaultFileMode = defaultMode
+}
+
+// SetRetryRounds gives files that failed all their inline attempts up to n
+// whole extra passes once the rest of the batch has drained — good against
+// transient server-side locks. Zero (the default) keeps the single pass.
+func (c *Client) SetRetryRounds(n int) {
+	c.engine.MaxRetryRounds = n
+}
+
+// SetRateLimit caps total throughput at bytesPerSec across every worker —
+// one shared budget, not one per worker — so a big batch stops saturating
+// shared links. Zero (the default) means unlimited; safe to change
+// mid-transfer.
+func (c *Client) SetRateLimit(bytesPerSec int64) {
+	pfte.SetRateLimit(bytesPerSec)
+}
+
+// SetPreserveXattrs carries extended attributes across transfers via
+// .fr-xattr sidecar files next to each remote file (SFTP has no xattr
+// slot of its own). Attributes that can't be preserved or restored show
+// up in Warnings() rather than failing the transfer.
+func (c *Client) SetPreserveXattrs(enabled bool) {
+	c.engine.PreserveXattrs = enabled
+}
+
+// SetRelativeBase pins the local directory used to compute remote layouts.
+// Uploading /a/b/c/d with base /a/b produces c/d under the destination;
+// with base /a/b/c just d. Empty (default) keeps the source's parent.
+func (c *Client) SetRelativeBase(base string) {
+	c.engine.RelativeBase = base
+}
+
+// SetFuzzySearch re-enables the legacy fallback of hunting a missing
+// download target by name a few levels deep. Off by default, because a typo
+// quietly matching the wrong directory is worse than an error.
+func (c *Client) SetFuzzySearch(enabled bool) {
+	c.engine.FuzzySearch = enabled
+}
+
+// SetPauseOnDisconnect makes batch transfers survive a dead network (laptop
+// sleep, wifi drop): instead of failing everything left in the queue, the
+// pool pauses, probes connectivity, and picks the batch back up when the
+// link returns. deadline caps one continuous pause (0 = wait forever).
+func (c *Client) SetPauseOnDisconnect(enabled bool, deadline time.Duration) {
+	c.engine.PauseOnDisconnect = enabled
+	c.engine.PauseDeadline = deadline
+}
+
+// SetMaxDepth caps recursion during enumeration on both upload and download:
+// 0 transfers only the source's immediate entries, 1 goes one level deeper,
+// and so on. Negative (the default) means the whole tree.
+func (c *Client) SetMaxDepth(depth int) {
+	c.engine.MaxDepth = depth
+}
+
+// SetHashMode picks how the streamed checksum is computed: inline in the
+// copy loop (default), in a separate goroutine so fast links never wait on
+// hashing, or not at all. Off also disables streamed verification — there's
+// nothing left to compare.
+func (c *Client) SetHashMode(mode pfte.HashMode) {
+	pfte.SetHashMode(mode)
+}
+
+// SetCollisionPolicy decides what happens when two download jobs in the same
+// batch target the same local path (easy to do with flatten mode):
+// pfte.CollisionOverwrite (atomic last-writer-wins, the default),
+// CollisionError, CollisionRename ("name (1).ext"), or CollisionSkip.
+func (c *Client) SetCollisionPolicy(policy pfte.CollisionPolicy) {
+	pfte.SetCollisionPolicy(policy)
+}
+
+// SetKeepPartials chooses what happens to a failed download's bytes:
+// parked at "<name>.part" (true) or deleted (false, default). The real
+// destination name never ends up holding a truncated file.
+func (c *Client) SetKeepPartials(keep bool) {
+	c.engine.KeepPartials = keep
+}
+
+// SetSkipExisting makes transfers skip files whose destination copy already
+// matches the source (size + mtime), in both directions, so re-running an
+// interrupted tree transfer only moves what's missing. Skips show up in the
+// stats as skipped_files.
+func (c *Client) SetSkipExisting(skip bool) {
+	c.engine.SkipExisting = skip
+}
+
+// SetDryRun makes the next Transfer stop after enumeration: nothing is
+// created or moved, and LastPlan holds what would have happened.
+func (c *Client) SetDryRun(enabled bool) {
+	c.engine.DryRun = enabled
+}
+
+// LastPlan reports what the most recent dry-run Transfer would have done.
+func (c *Client) LastPlan() *pfte.TransferPlan {
+	return c.engine.LastPlan
+}
+
+// SetExcludes installs glob patterns (path.Match syntax, plus "**" to span
+// directories) that filter uploads and downloads alike. Patterns match base
+// names and root-relative paths; an excluded directory is pruned without
+// ever being enumerated.
+func (c *Client) SetExcludes(patterns []string) {
+	c.engine.Excludes = patterns
+}
+
+// SetIncludes is the admit side of SetExcludes: when non-empty, only files
+// matching at least one pattern transfer. Directories are still walked —
+// "**/*.go" has to be able to find the .go files under a non-matching dir.
+func (c *Client) SetIncludes(patterns []string) {
+	c.engine.Includes = patterns
+}
+
+// SetStrictWalk makes an upload fail outright when its source walk couldn't
+// read everything, instead of transferring what it found and recording the
+// rest as warnings.
+func (c *Client) SetStrictWalk(strict bool) {
+	c.engine.StrictWalk = strict
+}
+
+// SetFailOnSpecial makes the enumeration error out on fifos, devices and
+// sockets instead of skipping them. The skips are always visible either way
+// via SkippedSpecial.
+func (c *Client) SetFailOnSpecial(fail bool) {
+	c.engine.FailOnSpecial = fail
+}
+
+// SkippedSpecial returns the non-regular files (fifos, devices, sockets) the
+// last transfer's enumeration skipped rather than hang or copy garbage.
+func (c *Client) SkippedSpecial() []string {
+	return append([]string(nil), c.engine.SkippedSpecial...)
+}
+
+// Failures lists which files from the last batch failed and why. A transfer
+// can finish "successfully" with individual files missing; check this (or
+// the stats' files_failed) before trusting the result.
+func (c *Client) Failures() []pfte.TransferError {
+	return c.engine.Failures()
+}
+
+// Warnings lists the paths the most recent upload walk had to skip
+// (unreadable directories, vanished files, broken symlinks), so callers can
+// tell a complete backup from one with silent holes.
+func (c *Client) Warnings() []string {
+	return c.engine.Warnings
+}
+
+// SetForceModes stamps fixed permissions onto everything uploaded: fileMode
+// on files (after transfer), dirMode on created directories — overriding the
+// source modes and any preserve policy. 0 leaves the respective kind alone.
+func (c *Client) SetForceModes(fileMode, dirMode os.FileMode) {
+	c.engine.ForceFileMode = fileMode
+	c.engine.ForceDirMode = dirMode
+}
+
+// SetFollowSymlinks controls whether remote symlinks are resolved during a
+// download walk. Off by default so a hostile/accidental link can't explode
+// the transfer; skipped links are recorded for the caller.
+func (c *Client) SetFollowSymlinks(follow bool) {
+	c.engine.FollowRemoteSymlinks = follow
+}
+
+// SetTimeouts configures hard deadlines: overall bounds the entire transfer,
+// perFile bounds each individual file (retries included). Zero disables.
+func (c *Client) SetTimeouts(overall, perFile time.Duration) {
+	c.engine.OverallTimeout = overall
+	c.engine.FileTimeout = perFile
+}
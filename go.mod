@@ -1,13 +1,12 @@
 module fileripper
 
-go 1.24.0
+go 1.25.0
 
 require (
+	github.com/kr/fs v0.1.0
 	github.com/pkg/sftp v1.13.10
-	golang.org/x/crypto v0.46.0
+	golang.org/x/crypto v0.55.0
+	golang.org/x/net v0.58.0
 )
 
-require (
-	github.com/kr/fs v0.1.0 // indirect
-	golang.org/x/sys v0.39.0 // indirect
-)
+require golang.org/x/sys v0.47.0 // indirect
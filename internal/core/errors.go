@@ -27,7 +27,11 @@ var (
 	ErrAuthFailed       = errors.New("authentication_failed")
 
 	// PFTE specific
-	ErrPipelineStalled = errors.New("pipeline_stalled")
+	ErrSourceNotFound   = errors.New("source_not_found")
+	ErrPipelineStalled  = errors.New("pipeline_stalled")
+	ErrChecksumMismatch = errors.New("checksum_mismatch")
+	ErrQuotaExceeded    = errors.New("quota_exceeded")
+	ErrLocalDiskFull    = errors.New("local_disk_full")
 
 	// System
 	ErrUnknownCommand = errors.New("unknown_command")
@@ -0,0 +1,217 @@
+/*
+ * Copyright 2026 The FileRipper Team
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package network
+
+import (
+	"context"
+	"io"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/kr/fs"
+	"github.com/pkg/sftp"
+)
+
+// RemoteFile is an open file on the remote side. *sftp.File satisfies it.
+type RemoteFile interface {
+	io.Reader
+	io.Writer
+	io.Seeker
+	io.Closer
+	Stat() (os.FileInfo, error)
+}
+
+// RemoteFS is the slice of remote-filesystem behaviour the transfer engine
+// actually needs. The live implementation is backed by *sftp.Client; tests
+// inject an in-memory fake, and a future non-SFTP backend only has to cover
+// this surface. The extra methods beyond the classic file ops (RealPath,
+// ReadLink, Getwd, OpenFile) exist because the engine's walk and multipart
+// paths use them.
+type RemoteFS interface {
+	Open(path string) (RemoteFile, error)
+	OpenFile(path string, flags int) (RemoteFile, error)
+	Create(path string) (RemoteFile, error)
+	Stat(path string) (os.FileInfo, error)
+	ReadDir(path string) ([]os.FileInfo, error)
+	MkdirAll(path string) error
+	Walk(root string) *fs.Walker
+	Rename(oldname, newname string) error
+	Remove(path string) error
+	Chtimes(path string, atime, mtime time.Time) error
+	Chmod(path string, mode os.FileMode) error
+	RealPath(path string) (string, error)
+	ReadLink(path string) (string, error)
+	Getwd() (string, error)
+}
+
+// SftpSession exposes the whole RemoteFS surface itself, so the engine never
+// has to reach into SftpClient directly.
+var _ RemoteFS = (*SftpSession)(nil)
+
+// sftpFS adapts *sftp.Client to RemoteFS. Most methods delegate untouched;
+// the open/create ones exist only to convert *sftp.File to the interface.
+type sftpFS struct {
+	client *sftp.Client
+}
+
+func (f sftpFS) Open(path string) (RemoteFile, error)   { return f.client.Open(path) }
+func (f sftpFS) Create(path string) (RemoteFile, error) { return f.client.Create(path) }
+func (f sftpFS) OpenFile(path string, flags int) (RemoteFile, error) {
+	return f.client.OpenFile(path, flags)
+}
+func (f sftpFS) Stat(path string) (os.FileInfo, error)      { return f.client.Stat(path) }
+func (f sftpFS) ReadDir(path string) ([]os.FileInfo, error) { return f.client.ReadDir(path) }
+func (f sftpFS) MkdirAll(path string) error                 { return f.client.MkdirAll(path) }
+func (f sftpFS) Walk(root string) *fs.Walker                { return f.client.Walk(root) }
+func (f sftpFS) Rename(oldname, newname string) error       { return f.client.Rename(oldname, newname) }
+func (f sftpFS) Remove(path string) error                   { return f.client.Remove(path) }
+func (f sftpFS) Chtimes(path string, atime, mtime time.Time) error {
+	return f.client.Chtimes(path, atime, mtime)
+}
+func (f sftpFS) Chmod(path string, mode os.FileMode) error { return f.client.Chmod(path, mode) }
+func (f sftpFS) RealPath(path string) (string, error)      { return f.client.RealPath(path) }
+func (f sftpFS) ReadLink(path string) (string, error)      { return f.client.ReadLink(path) }
+func (f sftpFS) Getwd() (string, error)                    { return f.client.Getwd() }
+
+// fs picks the injected backend when one is set, the live client otherwise.
+func (s *SftpSession) fs() RemoteFS {
+	if s.FS != nil {
+		return s.FS
+	}
+	return sftpFS{s.SftpClient}
+}
+
+// resolve joins a relative remote path onto the session's working directory.
+// SFTP has no real cwd, so this is purely client-side bookkeeping: absolute
+// paths pass through untouched, and with no WorkDir set nothing changes.
+func (s *SftpSession) resolve(p string) string {
+	if s.WorkDir == "" || strings.HasPrefix(p, "/") {
+		return p
+	}
+	return path.Join(s.WorkDir, p)
+}
+
+// Ready reports whether the session has a usable filesystem behind it —
+// either a live SFTP client or an injected backend.
+func (s *SftpSession) Ready() bool {
+	return s.FS != nil || s.SftpClient != nil
+}
+
+func (s *SftpSession) Open(path string) (RemoteFile, error)   { return s.fs().Open(s.resolve(path)) }
+func (s *SftpSession) Create(path string) (RemoteFile, error) { return s.fs().Create(s.resolve(path)) }
+func (s *SftpSession) OpenFile(path string, flags int) (RemoteFile, error) {
+	return s.fs().OpenFile(s.resolve(path), flags)
+}
+func (s *SftpSession) Stat(path string) (os.FileInfo, error) { return s.fs().Stat(s.resolve(path)) }
+func (s *SftpSession) ReadDir(path string) ([]os.FileInfo, error) {
+	return s.fs().ReadDir(s.resolve(path))
+}
+func (s *SftpSession) MkdirAll(path string) error  { return s.fs().MkdirAll(s.resolve(path)) }
+func (s *SftpSession) Walk(root string) *fs.Walker { return s.fs().Walk(s.resolve(root)) }
+func (s *SftpSession) Rename(oldname, newname string) error {
+	return s.fs().Rename(s.resolve(oldname), s.resolve(newname))
+}
+func (s *SftpSession) Remove(path string) error { return s.fs().Remove(s.resolve(path)) }
+
+// RemoveAll deletes a path and, when it's a directory, everything under it
+// — the remote twin of os.RemoveAll. A path that's already gone is a
+// success. The context is checked between entries so a huge tree can be
+// abandoned mid-delete.
+func (s *SftpSession) RemoveAll(ctx context.Context, p string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	st, err := s.Stat(p)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	if !st.IsDir() {
+		return s.Remove(p)
+	}
+	entries, err := s.ReadDir(p)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		if err := s.RemoveAll(ctx, path.Join(p, entry.Name())); err != nil {
+			return err
+		}
+	}
+	return s.Remove(p)
+}
+func (s *SftpSession) Chtimes(path string, atime, mtime time.Time) error {
+	return s.fs().Chtimes(s.resolve(path), atime, mtime)
+}
+func (s *SftpSession) Chmod(path string, mode os.FileMode) error {
+	return s.fs().Chmod(s.resolve(path), mode)
+}
+func (s *SftpSession) RealPath(path string) (string, error) { return s.fs().RealPath(s.resolve(path)) }
+func (s *SftpSession) ReadLink(path string) (string, error) { return s.fs().ReadLink(s.resolve(path)) }
+func (s *SftpSession) Getwd() (string, error)               { return s.fs().Getwd() }
+
+// DirStream yields directory entries one at a time (io.EOF at the end), so
+// a directory with millions of entries never has to exist in memory at once
+// on our side. Stop early by just not calling Next again and Closing.
+type DirStream interface {
+	Next() (os.FileInfo, error)
+	Close() error
+}
+
+// DirStreamer is the optional interface a backend implements when it can
+// list a directory incrementally. Backends without it get the slurp-once
+// fallback in ReadDirStream.
+type DirStreamer interface {
+	ReadDirStream(dir string) (DirStream, error)
+}
+
+// ReadDirStream lists a directory incrementally. When the backend can't
+// page natively — pkg/sftp only offers the all-at-once ReadDir — the full
+// listing is fetched once and then fed out entry by entry, which still
+// bounds everything downstream of this call.
+func (s *SftpSession) ReadDirStream(dir string) (DirStream, error) {
+	backend := s.fs()
+	if ds, ok := backend.(DirStreamer); ok {
+		return ds.ReadDirStream(s.resolve(dir))
+	}
+	infos, err := backend.ReadDir(s.resolve(dir))
+	if err != nil {
+		return nil, err
+	}
+	return &sliceDirStream{infos: infos}, nil
+}
+
+// sliceDirStream feeds a pre-fetched listing out incrementally.
+type sliceDirStream struct {
+	infos []os.FileInfo
+	next  int
+}
+
+func (d *sliceDirStream) Next() (os.FileInfo, error) {
+	if d.next >= len(d.infos) {
+		return nil, io.EOF
+	}
+	info := d.infos[d.next]
+	d.next++
+	return info, nil
+}
+
+func (d *sliceDirStream) Close() error { return nil }
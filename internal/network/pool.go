@@ -0,0 +1,236 @@
+/*
+ * Copyright 2026 The FileRipper Team
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package network
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// SessionPool keeps warm, authenticated SFTP sessions around between
+// transfers. The SSH handshake is the expensive part of a short transfer;
+// for a daemon doing back-to-back work, borrowing a warm session beats
+// dialing a fresh one every time. Borrowed sessions are health-checked, so
+// a connection the server dropped overnight never reaches the engine.
+type SessionPool struct {
+	// Factory dials and fully opens one session (Connect + OpenSFTP).
+	Factory func() (*SftpSession, error)
+
+	// Min is how many warm sessions the janitor keeps around even when
+	// idle; Max caps the total (borrowed + idle). Borrow blocks when Max
+	// are out.
+	Min, Max int
+
+	// IdleTimeout is how long a returned session may sit unused before the
+	// janitor closes it (down to Min). Zero means idle sessions live forever.
+	IdleTimeout time.Duration
+
+	mu     sync.Mutex
+	cond   *sync.Cond
+	idle   []pooledSession
+	inUse  int
+	closed bool
+	stop   chan struct{}
+}
+
+// pooledSession remembers when a session went idle, for the reaper.
+type pooledSession struct {
+	sess      *SftpSession
+	idleSince time.Time
+}
+
+// NewSessionPool builds a pool and pre-warms Min sessions (best-effort: a
+// server refusing the warm-up doesn't fail construction, the next Borrow
+// will surface the real error).
+func NewSessionPool(factory func() (*SftpSession, error), min, max int, idleTimeout time.Duration) *SessionPool {
+	if max < 1 {
+		max = 1
+	}
+	if min < 0 {
+		min = 0
+	}
+	if min > max {
+		min = max
+	}
+	p := &SessionPool{
+		Factory:     factory,
+		Min:         min,
+		Max:         max,
+		IdleTimeout: idleTimeout,
+		stop:        make(chan struct{}),
+	}
+	p.cond = sync.NewCond(&p.mu)
+
+	for i := 0; i < min; i++ {
+		if sess, err := factory(); err == nil {
+			p.mu.Lock()
+			p.idle = append(p.idle, pooledSession{sess: sess, idleSince: time.Now()})
+			p.mu.Unlock()
+		}
+	}
+
+	if idleTimeout > 0 {
+		go p.janitor()
+	}
+	return p
+}
+
+// Borrow hands out a healthy session, reusing a warm one when possible and
+// dialing fresh only when the idle shelf is empty. Blocks when Max sessions
+// are already out, until one comes back or ctx ends.
+func (p *SessionPool) Borrow(ctx context.Context) (*SftpSession, error) {
+	// The cond var can't watch ctx, so a canceled context pokes the wait
+	// loop awake instead.
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			p.cond.Broadcast()
+		case <-done:
+		}
+	}()
+
+	p.mu.Lock()
+	for {
+		if p.closed {
+			p.mu.Unlock()
+			return nil, fmt.Errorf("pool_closed")
+		}
+		if err := ctx.Err(); err != nil {
+			p.mu.Unlock()
+			return nil, err
+		}
+
+		// Prefer the most recently used session — it's the most likely to
+		// still be alive.
+		for len(p.idle) > 0 {
+			last := len(p.idle) - 1
+			candidate := p.idle[last].sess
+			p.idle = p.idle[:last]
+			p.inUse++
+			p.mu.Unlock()
+
+			// Health check on borrow: a dead session is closed and the next
+			// candidate gets its chance.
+			if _, err := candidate.Getwd(); err == nil {
+				return candidate, nil
+			}
+			candidate.Close()
+
+			p.mu.Lock()
+			p.inUse--
+		}
+
+		if p.inUse < p.Max {
+			p.inUse++
+			p.mu.Unlock()
+			sess, err := p.Factory()
+			if err != nil {
+				p.mu.Lock()
+				p.inUse--
+				p.cond.Signal()
+				p.mu.Unlock()
+				return nil, err
+			}
+			return sess, nil
+		}
+
+		p.cond.Wait()
+	}
+}
+
+// Return puts a borrowed session back on the warm shelf. Hand back broken
+// sessions too — the borrow-side health check sorts them out.
+func (p *SessionPool) Return(sess *SftpSession) {
+	if sess == nil {
+		return
+	}
+	p.mu.Lock()
+	p.inUse--
+	if p.closed {
+		p.mu.Unlock()
+		sess.Close()
+		return
+	}
+	p.idle = append(p.idle, pooledSession{sess: sess, idleSince: time.Now()})
+	p.cond.Signal()
+	p.mu.Unlock()
+}
+
+// Close shuts the pool and every idle session. Borrowed sessions are closed
+// as they come back.
+func (p *SessionPool) Close() {
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		return
+	}
+	p.closed = true
+	idle := p.idle
+	p.idle = nil
+	close(p.stop)
+	p.cond.Broadcast()
+	p.mu.Unlock()
+
+	for _, ps := range idle {
+		ps.sess.Close()
+	}
+}
+
+// Stats reports the pool's current shape: warm sessions on the shelf and
+// sessions currently out.
+func (p *SessionPool) Stats() (idle, inUse int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return len(p.idle), p.inUse
+}
+
+// janitor reaps sessions that sat idle past IdleTimeout, never going below
+// Min warm ones.
+func (p *SessionPool) janitor() {
+	interval := p.IdleTimeout / 2
+	if interval < time.Second {
+		interval = p.IdleTimeout
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-p.stop:
+			return
+		case <-ticker.C:
+		}
+
+		var expired []*SftpSession
+		p.mu.Lock()
+		for len(p.idle) > p.Min && time.Since(p.idle[0].idleSince) > p.IdleTimeout {
+			// Oldest first: idle[] is append-on-return, so index 0 has been
+			// cold the longest.
+			expired = append(expired, p.idle[0].sess)
+			p.idle = p.idle[1:]
+		}
+		p.mu.Unlock()
+
+		for _, sess := range expired {
+			sess.Close()
+		}
+	}
+}
@@ -0,0 +1,195 @@
+/*
+ * Copyright 2026 The FileRipper Team
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package network
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"fileripper/internal/sftptest"
+)
+
+// poolFactory dials the test server and counts how often it was asked to.
+func poolFactory(t *testing.T, srv *sftptest.Server, dials *int32) func() (*SftpSession, error) {
+	t.Helper()
+	return func() (*SftpSession, error) {
+		atomic.AddInt32(dials, 1)
+		sess := NewSession("127.0.0.1", srv.Port, sftptest.User, sftptest.Password)
+		sess.ResolvedAddr = srv.Host
+		if err := sess.Connect(); err != nil {
+			return nil, err
+		}
+		if err := sess.OpenSFTP(); err != nil {
+			sess.Close()
+			return nil, err
+		}
+		return sess, nil
+	}
+}
+
+func TestPoolReusesWarmSessions(t *testing.T) {
+	srv, err := sftptest.Start(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Close()
+
+	var dials int32
+	pool := NewSessionPool(poolFactory(t, srv, &dials), 0, 2, 0)
+	defer pool.Close()
+
+	ctx := context.Background()
+	sess, err := pool.Borrow(ctx)
+	if err != nil {
+		t.Fatalf("borrow: %v", err)
+	}
+	pool.Return(sess)
+
+	// Back-to-back borrows must reuse the warm session, not redial.
+	again, err := pool.Borrow(ctx)
+	if err != nil {
+		t.Fatalf("second borrow: %v", err)
+	}
+	pool.Return(again)
+	if n := atomic.LoadInt32(&dials); n != 1 {
+		t.Errorf("dials = %d, want 1 (warm reuse)", n)
+	}
+	if sess != again {
+		t.Error("expected the same warm session back")
+	}
+}
+
+func TestPoolDiscardsDeadSessionsOnBorrow(t *testing.T) {
+	srv, err := sftptest.Start(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Close()
+
+	var dials int32
+	pool := NewSessionPool(poolFactory(t, srv, &dials), 0, 2, 0)
+	defer pool.Close()
+
+	ctx := context.Background()
+	sess, err := pool.Borrow(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Kill the connection before handing it back: the next borrow must
+	// detect the corpse and dial fresh instead of returning it.
+	sess.Close()
+	pool.Return(sess)
+
+	fresh, err := pool.Borrow(ctx)
+	if err != nil {
+		t.Fatalf("borrow after dead return: %v", err)
+	}
+	defer pool.Return(fresh)
+	if fresh == sess {
+		t.Error("the dead session was handed out again")
+	}
+	if _, err := fresh.Getwd(); err != nil {
+		t.Errorf("replacement session is not healthy: %v", err)
+	}
+	if n := atomic.LoadInt32(&dials); n != 2 {
+		t.Errorf("dials = %d, want 2 (one original, one replacement)", n)
+	}
+}
+
+func TestPoolBlocksAtMaxUntilReturn(t *testing.T) {
+	srv, err := sftptest.Start(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Close()
+
+	var dials int32
+	pool := NewSessionPool(poolFactory(t, srv, &dials), 0, 1, 0)
+	defer pool.Close()
+
+	ctx := context.Background()
+	sess, err := pool.Borrow(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := make(chan *SftpSession)
+	go func() {
+		s, err := pool.Borrow(ctx)
+		if err != nil {
+			t.Errorf("blocked borrow: %v", err)
+		}
+		got <- s
+	}()
+
+	select {
+	case <-got:
+		t.Fatal("borrow should block while max sessions are out")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	pool.Return(sess)
+	select {
+	case s := <-got:
+		pool.Return(s)
+	case <-time.After(2 * time.Second):
+		t.Fatal("returning a session should unblock the waiter")
+	}
+
+	// And a canceled context frees a blocked borrower too.
+	hold, _ := pool.Borrow(ctx)
+	shortCtx, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+	defer cancel()
+	if _, err := pool.Borrow(shortCtx); err == nil {
+		t.Error("borrow with expired context should fail")
+	}
+	pool.Return(hold)
+}
+
+func TestPoolJanitorReapsIdleSessions(t *testing.T) {
+	srv, err := sftptest.Start(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Close()
+
+	var dials int32
+	pool := NewSessionPool(poolFactory(t, srv, &dials), 1, 3, 100*time.Millisecond)
+	defer pool.Close()
+
+	ctx := context.Background()
+	a, _ := pool.Borrow(ctx)
+	b, _ := pool.Borrow(ctx)
+	c, _ := pool.Borrow(ctx)
+	pool.Return(a)
+	pool.Return(b)
+	pool.Return(c)
+
+	deadline := time.Now().Add(3 * time.Second)
+	for {
+		idle, _ := pool.Stats()
+		if idle == 1 {
+			break // reaped down to Min
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("idle = %d, want 1 after the idle timeout", idle)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
@@ -17,14 +17,27 @@
 package network
 
 import (
+	"bufio"
+	"context"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
 	"fmt"
+	"io"
 	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"syscall"
 	"time"
 
 	"fileripper/internal/core"
 
 	"github.com/pkg/sftp"
 	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+	"golang.org/x/net/proxy"
 )
 
 // SftpSession holds the SSH connection state and the SFTP subsystem.
@@ -35,6 +48,123 @@ type SftpSession struct {
 	Password   string
 	SshClient  *ssh.Client  // The tunnel
 	SftpClient *sftp.Client // The file protocol wrapper
+
+	// Banner, when set, receives the server's pre-auth banner message.
+	// Some enterprise servers require the client to handle this handshake;
+	// returning an error aborts the connection.
+	Banner ssh.BannerCallback
+
+	// Tuning adjusts the SFTP client for the link; nil keeps library defaults.
+	Tuning *SftpTuning
+
+	// FS, when set, replaces the live SFTP client as the session's
+	// filesystem backend. Tests use it to run the engine against a fake
+	// without a server; it's also the seam for non-SFTP backends.
+	FS RemoteFS
+
+	// ProxyURL routes the TCP connection through a proxy before the SSH
+	// handshake: "socks5://host:1080" or "http://host:3128" (CONNECT), with
+	// optional user:pass in the URL. Empty falls back to the standard
+	// ALL_PROXY environment variable; empty both means a direct dial.
+	ProxyURL string
+
+	// ResolvedAddr, when set, is the address actually dialed (host:port or
+	// bare host/IP) while Hostname keeps being the name presented for host
+	// key verification. Covers split-horizon DNS and test setups where the
+	// dial target and the verified name must differ.
+	ResolvedAddr string
+
+	// KeyPath points at a private key file to offer for public-key auth;
+	// KeyPEM carries the same key as in-memory PEM bytes for callers that
+	// never want it touching disk (KeyPEM wins when both are set).
+	// KeyPassphrase decrypts the key when it's encrypted. Neither set
+	// skips the method entirely.
+	KeyPath       string
+	KeyPEM        []byte
+	KeyPassphrase string
+
+	// JumpHost, when set, is an already-connected session acting as a
+	// bastion: this session's TCP connection is tunneled through it
+	// instead of dialed directly (the ProxyJump pattern). The bastion's
+	// lifetime is the caller's business — Close here leaves it up.
+	JumpHost *SftpSession
+
+	// DialTimeout bounds the TCP dial and SSH handshake. Zero keeps the
+	// historic 10 seconds.
+	DialTimeout time.Duration
+
+	// KeepaliveInterval, when positive, sends an SSH-level keepalive
+	// ("keepalive@openssh.com") on that interval for as long as the
+	// connection is up — stops middleboxes from silently dropping idle
+	// tunnels mid-batch. Zero sends none. Set before Connect.
+	KeepaliveInterval time.Duration
+	keepaliveStop     chan struct{}
+
+	// PinnedFingerprint, when set, is the only host key Connect will
+	// accept: the server's SHA-256 fingerprint must match it or the
+	// handshake fails. Accepts the ssh-keygen form ("SHA256:..." with or
+	// without base64 padding) or the bare base64 digest. For pinning a
+	// single known server in automation without a known_hosts file.
+	PinnedFingerprint string
+
+	// HostKeyCheck, when set, decides whether to trust the server's host
+	// key: it gets the hostname and the key's SHA-256 fingerprint, and any
+	// returned error aborts the handshake and comes back from Connect
+	// verbatim. Nil keeps the historic accept-anything behavior.
+	HostKeyCheck func(hostname, fingerprint string) error
+
+	// Subsystem overrides how the SFTP channel is requested. Empty asks for
+	// the standard "sftp" subsystem; any other name requests that subsystem
+	// instead; SubsystemIsCommand makes it an exec request (e.g.
+	// "/usr/libexec/sftp-server") for appliances that don't register a
+	// subsystem at all.
+	Subsystem          string
+	SubsystemIsCommand bool
+
+	// AuthMethodUsed, after a successful Connect, names the method the
+	// server actually accepted: "key", "agent", "keyboard-interactive" or
+	// "password". Handy for diagnostics and profile auto-configuration.
+	AuthMethodUsed string
+
+	// WorkDir is the client-side working directory: relative remote paths
+	// are resolved under it, absolute ones ignore it. SFTP has no real cwd,
+	// so this never touches the server — it's for callers (and UIs) that
+	// keep a "current directory" and don't want to re-prefix every path.
+	WorkDir string
+
+	// ConnectRetries is how many extra attempts ConnectWithRetry makes after
+	// a failed connect; ConnectBackoff is the wait before the first retry
+	// (doubling each attempt, 0 = 2s). Auth failures are never retried —
+	// the password won't fix itself.
+	ConnectRetries int
+	ConnectBackoff time.Duration
+}
+
+// SftpTuning maps to pkg/sftp client options. On high-latency links,
+// concurrent reads/writes and a bigger packet size can multiply throughput.
+type SftpTuning struct {
+	UseConcurrentReads           bool
+	UseConcurrentWrites          bool
+	MaxPacket                    int // bytes per SFTP packet, 0 = default
+	MaxConcurrentRequestsPerFile int // 0 = default
+}
+
+// options renders the tuning into pkg/sftp's functional options.
+func (t *SftpTuning) options() []sftp.ClientOption {
+	var opts []sftp.ClientOption
+	if t.UseConcurrentReads {
+		opts = append(opts, sftp.UseConcurrentReads(true))
+	}
+	if t.UseConcurrentWrites {
+		opts = append(opts, sftp.UseConcurrentWrites(true))
+	}
+	if t.MaxPacket > 0 {
+		opts = append(opts, sftp.MaxPacketUnchecked(t.MaxPacket))
+	}
+	if t.MaxConcurrentRequestsPerFile > 0 {
+		opts = append(opts, sftp.MaxConcurrentRequestsPerFile(t.MaxConcurrentRequestsPerFile))
+	}
+	return opts
 }
 
 func NewSession(host string, port int, user, password string) *SftpSession {
@@ -46,15 +176,169 @@ func NewSession(host string, port int, user, password string) *SftpSession {
 	}
 }
 
+// NewSessionThroughJump prepares a session whose connection goes through
+// jump — an already-connected bastion session — rather than dialing the
+// target directly. Closing the returned session leaves the bastion up;
+// tearing that down too is the caller's job.
+func NewSessionThroughJump(jump *SftpSession, host string, port int, user, password string) *SftpSession {
+	return &SftpSession{
+		Hostname: host,
+		Port:     port,
+		User:     user,
+		Password: password,
+		JumpHost: jump,
+	}
+}
+
+// NewSessionWithKey prepares a session that authenticates with the given
+// private key (PEM bytes, passphrase for encrypted keys). Set Password too
+// and it stays available as a fallback when the server rejects the key.
+func NewSessionWithKey(host string, port int, user string, pemBytes []byte, passphrase string) *SftpSession {
+	return &SftpSession{
+		Hostname:      host,
+		Port:          port,
+		User:          user,
+		KeyPEM:        pemBytes,
+		KeyPassphrase: passphrase,
+	}
+}
+
+// parseAuthKey turns PEM bytes into a signer, keeping "your passphrase is
+// wrong" and "your key is broken" distinguishable — the daemon surfaces
+// these differently. label names the key in errors (a path, or "inline").
+func parseAuthKey(data []byte, passphrase, label string) (ssh.Signer, error) {
+	if passphrase == "" {
+		signer, err := ssh.ParsePrivateKey(data)
+		if _, missing := err.(*ssh.PassphraseMissingError); missing {
+			return nil, fmt.Errorf("auth key %s: encrypted, passphrase required", label)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("auth key %s: %v", label, err)
+		}
+		return signer, nil
+	}
+	signer, err := ssh.ParsePrivateKeyWithPassphrase(data, []byte(passphrase))
+	if err != nil {
+		if errors.Is(err, x509.IncorrectPasswordError) ||
+			strings.Contains(err.Error(), "incorrect") {
+			return nil, fmt.Errorf("auth key %s: incorrect passphrase", label)
+		}
+		return nil, fmt.Errorf("auth key %s: %v", label, err)
+	}
+	return signer, nil
+}
+
+// normalizeFingerprint lets pinned fingerprints match regardless of cosmetic
+// form: "SHA256:" prefix and base64 padding both come off before comparing.
+func normalizeFingerprint(fp string) string {
+	fp = strings.TrimPrefix(strings.TrimSpace(fp), "SHA256:")
+	return strings.TrimRight(fp, "=")
+}
+
+// dialAddress is the endpoint the TCP connection actually goes to.
+func (s *SftpSession) dialAddress() string {
+	if s.ResolvedAddr == "" {
+		return fmt.Sprintf("%s:%d", s.Hostname, s.Port)
+	}
+	if _, _, err := net.SplitHostPort(s.ResolvedAddr); err == nil {
+		return s.ResolvedAddr
+	}
+	// Bare host or IP (including IPv6 literals): attach the session port.
+	return net.JoinHostPort(s.ResolvedAddr, fmt.Sprintf("%d", s.Port))
+}
+
+// connectAuth builds the ssh auth slice from everything the session has
+// configured, in preference order: key file, ssh-agent, keyboard-interactive,
+// password. Every method goes through a callback that records its name in
+// *tried, so after a successful handshake *tried names the method the server
+// actually accepted.
+func (s *SftpSession) connectAuth() (methods []ssh.AuthMethod, names []string, tried *string, err error) {
+	tried = new(string)
+
+	if len(s.KeyPEM) > 0 || s.KeyPath != "" {
+		data, label := s.KeyPEM, "inline"
+		if len(data) == 0 {
+			var err error
+			data, err = os.ReadFile(s.KeyPath)
+			if err != nil {
+				return nil, nil, nil, fmt.Errorf("auth key %s: %v", s.KeyPath, err)
+			}
+			label = s.KeyPath
+		}
+		signer, err := parseAuthKey(data, s.KeyPassphrase, label)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		methods = append(methods, ssh.PublicKeysCallback(func() ([]ssh.Signer, error) {
+			*tried = "key"
+			return []ssh.Signer{signer}, nil
+		}))
+		names = append(names, "key")
+	}
+
+	// A running ssh-agent is as good as configured: offer whatever it holds.
+	if sock := os.Getenv("SSH_AUTH_SOCK"); sock != "" {
+		if conn, err := net.Dial("unix", sock); err == nil {
+			ag := agent.NewClient(conn)
+			methods = append(methods, ssh.PublicKeysCallback(func() ([]ssh.Signer, error) {
+				*tried = "agent"
+				return ag.Signers()
+			}))
+			names = append(names, "agent")
+		}
+	}
+
+	if s.Password != "" {
+		// Some servers only do keyboard-interactive even for plain password
+		// logins; answer every prompt with the password.
+		methods = append(methods, ssh.KeyboardInteractive(func(name, instruction string, questions []string, echos []bool) ([]string, error) {
+			*tried = "keyboard-interactive"
+			answers := make([]string, len(questions))
+			for i := range answers {
+				answers[i] = s.Password
+			}
+			return answers, nil
+		}))
+		names = append(names, "keyboard-interactive")
+	}
+
+	// Password goes last, and stays in even when empty so a server that
+	// accepts anonymous logins still gets its chance.
+	methods = append(methods, ssh.PasswordCallback(func() (string, error) {
+		*tried = "password"
+		return s.Password, nil
+	}))
+	names = append(names, "password")
+
+	return methods, names, tried, nil
+}
+
 // Connect establishes the secure SSH tunnel.
 func (s *SftpSession) Connect() error {
-	address := fmt.Sprintf("%s:%d", s.Hostname, s.Port)
+	address := s.dialAddress()
 
-	authMethods := []ssh.AuthMethod{
-		ssh.Password(s.Password),
+	authMethods, authNames, tried, err := s.connectAuth()
+	if err != nil {
+		return err
 	}
 
+	var hostKeyErr error
 	hostKeyCallback := func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+		presented := ssh.FingerprintSHA256(key)
+		if s.PinnedFingerprint != "" &&
+			normalizeFingerprint(presented) != normalizeFingerprint(s.PinnedFingerprint) {
+			hostKeyErr = fmt.Errorf("host key mismatch for %s: pinned %s, server presented %s",
+				hostname, s.PinnedFingerprint, presented)
+			return hostKeyErr
+		}
+		if s.HostKeyCheck != nil {
+			if err := s.HostKeyCheck(hostname, presented); err != nil {
+				// Remember the real reason: the ssh library will wrap it
+				// beyond recognition by the time NewClientConn returns.
+				hostKeyErr = err
+				return err
+			}
+		}
 		return nil
 	}
 
@@ -62,18 +346,258 @@ func (s *SftpSession) Connect() error {
 		User:            s.User,
 		Auth:            authMethods,
 		HostKeyCallback: hostKeyCallback,
-		Timeout:         10 * time.Second,
+		BannerCallback:  s.Banner,
+		Timeout:         s.dialTimeout(),
 	}
 
-	client, err := ssh.Dial("tcp", address, config)
+	conn, err := s.dialTCP(address)
 	if err != nil {
-		return core.ErrAuthFailed
+		// Keep the dial detail: "the bastion isn't connected" and "nothing
+		// answers on that port" call for very different fixes.
+		return fmt.Errorf("%w: %v", core.ErrHostUnreachable, err)
 	}
 
-	s.SshClient = client
+	sshConn, chans, reqs, err := ssh.NewClientConn(conn, address, config)
+	if err != nil {
+		conn.Close()
+		if hostKeyErr != nil {
+			return hostKeyErr
+		}
+		// Auth rejections and network problems need different handling
+		// upstream: retrying bad credentials just gets accounts locked.
+		// Name what we offered, so "authentication_failed" is actionable.
+		if strings.Contains(err.Error(), "unable to authenticate") {
+			return fmt.Errorf("%w (tried %s)", core.ErrAuthFailed, strings.Join(authNames, ", "))
+		}
+		return core.ErrHostUnreachable
+	}
+
+	s.SshClient = ssh.NewClient(sshConn, chans, reqs)
+	s.AuthMethodUsed = *tried
+	if s.KeepaliveInterval > 0 {
+		s.keepaliveStop = make(chan struct{})
+		go s.keepalive(s.SshClient, s.keepaliveStop)
+	}
 	return nil
 }
 
+// dialTimeout is the configured handshake bound, defaulting to the historic
+// 10 seconds.
+func (s *SftpSession) dialTimeout() time.Duration {
+	if s.DialTimeout > 0 {
+		return s.DialTimeout
+	}
+	return 10 * time.Second
+}
+
+// keepalive pings the server on the configured interval until stop closes
+// or the connection dies. OpenSSH replies to this request name; servers
+// that don't recognize it still see traffic, which is all we need.
+func (s *SftpSession) keepalive(client *ssh.Client, stop chan struct{}) {
+	ticker := time.NewTicker(s.KeepaliveInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			if _, _, err := client.SendRequest("keepalive@openssh.com", true, nil); err != nil {
+				return // connection is gone; Close or reconnect handles the rest
+			}
+		}
+	}
+}
+
+// dialTCP opens the raw connection to address, going through the configured
+// proxy (or ALL_PROXY) when one is set. Corporate networks often only allow
+// outbound SSH through a SOCKS5 or HTTP CONNECT proxy.
+func (s *SftpSession) dialTCP(address string) (net.Conn, error) {
+	if s.JumpHost != nil {
+		if s.JumpHost.SshClient == nil {
+			return nil, fmt.Errorf("jump host %s is not connected", s.JumpHost.Hostname)
+		}
+		// The bastion dials the last hop for us; proxies don't apply, the
+		// bastion already sits wherever it sits.
+		return s.JumpHost.SshClient.Dial("tcp", address)
+	}
+	proxyURL := s.ProxyURL
+	if proxyURL == "" {
+		proxyURL = os.Getenv("ALL_PROXY")
+	}
+	if proxyURL == "" {
+		return net.DialTimeout("tcp", address, s.dialTimeout())
+	}
+
+	u, err := url.Parse(proxyURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid proxy url %q: %v", proxyURL, err)
+	}
+
+	switch u.Scheme {
+	case "socks5", "socks5h":
+		var auth *proxy.Auth
+		if u.User != nil {
+			pass, _ := u.User.Password()
+			auth = &proxy.Auth{User: u.User.Username(), Password: pass}
+		}
+		dialer, err := proxy.SOCKS5("tcp", u.Host, auth, &net.Dialer{Timeout: s.dialTimeout()})
+		if err != nil {
+			return nil, err
+		}
+		return dialer.Dial("tcp", address)
+	case "http":
+		return httpConnect(u, address)
+	default:
+		return nil, fmt.Errorf("unsupported proxy scheme %q (want socks5 or http)", u.Scheme)
+	}
+}
+
+// httpConnect tunnels through an HTTP proxy via the CONNECT method and hands
+// back the raw connection once the proxy answers 200.
+func httpConnect(u *url.URL, address string) (net.Conn, error) {
+	conn, err := net.DialTimeout("tcp", u.Host, 10*time.Second)
+	if err != nil {
+		return nil, err
+	}
+
+	req := fmt.Sprintf("CONNECT %s HTTP/1.1\r\nHost: %s\r\n", address, address)
+	if u.User != nil {
+		pass, _ := u.User.Password()
+		cred := base64.StdEncoding.EncodeToString([]byte(u.User.Username() + ":" + pass))
+		req += "Proxy-Authorization: Basic " + cred + "\r\n"
+	}
+	req += "\r\n"
+
+	conn.SetDeadline(time.Now().Add(10 * time.Second))
+	if _, err := conn.Write([]byte(req)); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	resp, err := http.ReadResponse(bufio.NewReader(conn), &http.Request{Method: http.MethodConnect})
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		conn.Close()
+		return nil, fmt.Errorf("proxy refused CONNECT: %s", resp.Status)
+	}
+
+	conn.SetDeadline(time.Time{}) // handshake takes over from here
+	return conn, nil
+}
+
+// ConnectWithRetry is Connect plus backoff for transient network failures:
+// a server mid-restart or rate-limiting new connections usually recovers in
+// seconds, and a scheduled job shouldn't die over that. Auth failures abort
+// immediately.
+func (s *SftpSession) ConnectWithRetry(ctx context.Context) error {
+	backoff := s.ConnectBackoff
+	if backoff <= 0 {
+		backoff = 2 * time.Second
+	}
+
+	var err error
+	for attempt := 0; ; attempt++ {
+		err = s.Connect()
+		if err == nil || errors.Is(err, core.ErrAuthFailed) {
+			return err
+		}
+		if attempt >= s.ConnectRetries {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+}
+
+// TestResult is the outcome of a connection probe.
+type TestResult struct {
+	Reachable     bool   `json:"reachable"`             // TCP dial succeeded
+	Authenticated bool   `json:"authenticated"`         // SSH handshake + auth succeeded
+	HostKey       string `json:"host_key"`              // SHA-256 fingerprint presented by the server
+	LatencyMs     int64  `json:"latency_ms"`            // TCP dial round-trip
+	AuthMethod    string `json:"auth_method,omitempty"` // which method the server accepted
+	Error         string `json:"error,omitempty"`
+}
+
+// TestConnection validates credentials and reachability without opening the
+// SFTP subsystem: dial, handshake, auth, disconnect. Cheap enough for a
+// "verify settings" button or a health check.
+func (s *SftpSession) TestConnection() TestResult {
+	address := s.dialAddress()
+	result := TestResult{}
+
+	start := time.Now()
+	conn, err := s.dialTCP(address)
+	result.LatencyMs = time.Since(start).Milliseconds()
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	conn.Close()
+	result.Reachable = true
+
+	authMethods, authNames, tried, err := s.connectAuth()
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+
+	// The probe enforces the same host key policy as Connect: completing
+	// authentication against a host presenting the wrong key would hand an
+	// impostor the password.
+	var hostKeyErr error
+	config := &ssh.ClientConfig{
+		User: s.User,
+		Auth: authMethods,
+		HostKeyCallback: func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+			presented := ssh.FingerprintSHA256(key)
+			result.HostKey = presented
+			if s.PinnedFingerprint != "" &&
+				normalizeFingerprint(presented) != normalizeFingerprint(s.PinnedFingerprint) {
+				hostKeyErr = fmt.Errorf("host key mismatch for %s: pinned %s, server presented %s",
+					hostname, s.PinnedFingerprint, presented)
+				return hostKeyErr
+			}
+			if s.HostKeyCheck != nil {
+				if err := s.HostKeyCheck(hostname, presented); err != nil {
+					hostKeyErr = err
+					return err
+				}
+			}
+			return nil
+		},
+		Timeout: s.dialTimeout(),
+	}
+
+	conn2, err := s.dialTCP(address)
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	sshConn, chans, reqs, err := ssh.NewClientConn(conn2, address, config)
+	if err != nil {
+		conn2.Close()
+		if hostKeyErr != nil {
+			result.Error = hostKeyErr.Error()
+		} else {
+			result.Error = fmt.Sprintf("%v (tried %s)", err, strings.Join(authNames, ", "))
+		}
+		return result
+	}
+	ssh.NewClient(sshConn, chans, reqs).Close()
+	result.Authenticated = true
+	result.AuthMethod = *tried
+	return result
+}
+
 // OpenSFTP initializes the SFTP subsystem on top of the SSH tunnel.
 // This is distinct from Connect() because sometimes we just want Shell, not files.
 func (s *SftpSession) OpenSFTP() error {
@@ -81,7 +605,21 @@ func (s *SftpSession) OpenSFTP() error {
 		return core.ErrConnectionFailed
 	}
 
-	client, err := sftp.NewClient(s.SshClient)
+	var opts []sftp.ClientOption
+	if s.Tuning != nil {
+		opts = s.Tuning.options()
+	}
+
+	if s.Subsystem != "" {
+		client, err := s.openSFTPVia(s.Subsystem, s.SubsystemIsCommand, opts)
+		if err != nil {
+			return err
+		}
+		s.SftpClient = client
+		return nil
+	}
+
+	client, err := sftp.NewClient(s.SshClient, opts...)
 	if err != nil {
 		return core.ErrConnectionFailed
 	}
@@ -90,8 +628,88 @@ func (s *SftpSession) OpenSFTP() error {
 	return nil
 }
 
+// openSFTPVia builds the SFTP channel by hand for servers where the default
+// "sftp" subsystem request fails: either a subsystem under a different name,
+// or an explicit server binary started as a command. Same wire protocol
+// either way — only the handshake differs.
+func (s *SftpSession) openSFTPVia(name string, asCommand bool, opts []sftp.ClientOption) (*sftp.Client, error) {
+	sess, err := s.SshClient.NewSession()
+	if err != nil {
+		return nil, core.ErrConnectionFailed
+	}
+
+	stdin, err := sess.StdinPipe()
+	if err != nil {
+		sess.Close()
+		return nil, core.ErrConnectionFailed
+	}
+	stdout, err := sess.StdoutPipe()
+	if err != nil {
+		sess.Close()
+		return nil, core.ErrConnectionFailed
+	}
+
+	if asCommand {
+		err = sess.Start(name)
+	} else {
+		err = sess.RequestSubsystem(name)
+	}
+	if err != nil {
+		sess.Close()
+		return nil, fmt.Errorf("sftp via %q failed: %v", name, err)
+	}
+
+	client, err := sftp.NewClientPipe(stdout, stdin, opts...)
+	if err != nil {
+		sess.Close()
+		return nil, core.ErrConnectionFailed
+	}
+	return client, nil
+}
+
 // Close disconnects everything politely.
+// Reconnect tears the dead tunnel down and builds a fresh one — same host,
+// same auth, same settings — then reopens SFTP. For recovering a session a
+// network blip killed without losing its configuration. Sessions running on
+// an injected FS have nothing to rebuild.
+func (s *SftpSession) Reconnect() error {
+	if s.FS != nil {
+		return nil
+	}
+	s.Close()
+	s.SftpClient = nil
+	s.SshClient = nil
+	if err := s.Connect(); err != nil {
+		return err
+	}
+	return s.OpenSFTP()
+}
+
+// IsConnectionError reports whether err smells like the transport died —
+// as opposed to a per-file problem like a missing path or permissions. The
+// distinction decides whether a failed job is the file's fault or the
+// session's.
+func IsConnectionError(err error) bool {
+	if err == nil {
+		return false
+	}
+	if errors.Is(err, sftp.ErrSSHFxConnectionLost) || errors.Is(err, io.EOF) ||
+		errors.Is(err, net.ErrClosed) || errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, syscall.EPIPE) {
+		return true
+	}
+	msg := err.Error()
+	return strings.Contains(msg, "connection lost") ||
+		strings.Contains(msg, "connection reset") ||
+		strings.Contains(msg, "broken pipe") ||
+		strings.Contains(msg, "use of closed network connection")
+}
+
 func (s *SftpSession) Close() {
+	if s.keepaliveStop != nil {
+		close(s.keepaliveStop)
+		s.keepaliveStop = nil
+	}
 	if s.SftpClient != nil {
 		s.SftpClient.Close()
 	}
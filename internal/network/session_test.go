@@ -0,0 +1,545 @@
+/*
+ * Copyright 2026 The FileRipper Team
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package network
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/pem"
+	"errors"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+
+	"fileripper/internal/core"
+	"fileripper/internal/sftptest"
+)
+
+func TestDialAddress(t *testing.T) {
+	cases := []struct {
+		host     string
+		port     int
+		resolved string
+		want     string
+	}{
+		{"files.example.com", 22, "", "files.example.com:22"},
+		{"files.example.com", 22, "10.0.0.5", "10.0.0.5:22"},
+		{"files.example.com", 22, "10.0.0.5:2222", "10.0.0.5:2222"},
+		{"files.example.com", 22, "fd00::5", "[fd00::5]:22"},
+		{"files.example.com", 22, "[fd00::5]:2222", "[fd00::5]:2222"},
+	}
+	for _, c := range cases {
+		s := NewSession(c.host, c.port, "u", "p")
+		s.ResolvedAddr = c.resolved
+		if got := s.dialAddress(); got != c.want {
+			t.Errorf("resolved %q: dialAddress() = %q, want %q", c.resolved, got, c.want)
+		}
+	}
+}
+
+func TestConnectViaResolvedAddr(t *testing.T) {
+	srv, err := sftptest.Start(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Close()
+
+	// The hostname is deliberately unresolvable; only ResolvedAddr can
+	// make this connection work.
+	sess := NewSession("intranet.invalid", srv.Port, sftptest.User, sftptest.Password)
+	sess.ResolvedAddr = srv.Host
+	if err := sess.Connect(); err != nil {
+		t.Fatalf("connect via resolved address: %v", err)
+	}
+	defer sess.Close()
+	if err := sess.OpenSFTP(); err != nil {
+		t.Fatalf("sftp: %v", err)
+	}
+}
+
+// startSocks5 runs a minimal no-auth SOCKS5 server good enough for the
+// client handshake: greeting, CONNECT request, then blind byte shoveling.
+func startSocks5(t *testing.T) (addr string, dials *int32) {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+
+	var count int32
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			count++
+			go func(c net.Conn) {
+				defer c.Close()
+
+				// Greeting: VER NMETHODS METHODS... -> no auth required.
+				head := make([]byte, 2)
+				if _, err := io.ReadFull(c, head); err != nil || head[0] != 5 {
+					return
+				}
+				if _, err := io.ReadFull(c, make([]byte, int(head[1]))); err != nil {
+					return
+				}
+				c.Write([]byte{5, 0})
+
+				// Request: VER CMD RSV ATYP DST.ADDR DST.PORT
+				req := make([]byte, 4)
+				if _, err := io.ReadFull(c, req); err != nil || req[1] != 1 {
+					return
+				}
+				var host string
+				switch req[3] {
+				case 1: // IPv4
+					ip := make([]byte, 4)
+					io.ReadFull(c, ip)
+					host = net.IP(ip).String()
+				case 3: // domain
+					l := make([]byte, 1)
+					io.ReadFull(c, l)
+					name := make([]byte, int(l[0]))
+					io.ReadFull(c, name)
+					host = string(name)
+				default:
+					return
+				}
+				portBytes := make([]byte, 2)
+				io.ReadFull(c, portBytes)
+				port := binary.BigEndian.Uint16(portBytes)
+
+				target, err := net.Dial("tcp", net.JoinHostPort(host, strconv.Itoa(int(port))))
+				if err != nil {
+					c.Write([]byte{5, 5, 0, 1, 0, 0, 0, 0, 0, 0})
+					return
+				}
+				defer target.Close()
+				c.Write([]byte{5, 0, 0, 1, 0, 0, 0, 0, 0, 0})
+
+				go io.Copy(target, c)
+				io.Copy(c, target)
+			}(conn)
+		}
+	}()
+	return ln.Addr().String(), &count
+}
+
+func TestConnectThroughSocks5Proxy(t *testing.T) {
+	srv, err := sftptest.Start(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Close()
+
+	proxyAddr, dials := startSocks5(t)
+
+	sess := NewSession(srv.Host, srv.Port, sftptest.User, sftptest.Password)
+	sess.ProxyURL = "socks5://" + proxyAddr
+	if err := sess.Connect(); err != nil {
+		t.Fatalf("connect through proxy: %v", err)
+	}
+	defer sess.Close()
+	if err := sess.OpenSFTP(); err != nil {
+		t.Fatalf("sftp: %v", err)
+	}
+	if *dials == 0 {
+		t.Error("connection never went through the proxy")
+	}
+}
+
+func TestDialTCPRejectsUnknownProxyScheme(t *testing.T) {
+	sess := NewSession("example.com", 22, "u", "p")
+	sess.ProxyURL = "ftp://proxy:21"
+	if _, err := sess.dialTCP("example.com:22"); err == nil {
+		t.Error("unsupported proxy scheme should be rejected")
+	}
+}
+
+func TestWorkDirResolvesRelativePaths(t *testing.T) {
+	root := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(root, "projects", "deep"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(root, "projects", "deep", "notes.txt"), []byte("hi"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(root, "top.txt"), []byte("top"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	srv, err := sftptest.Start(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Close()
+	sess := NewSession("127.0.0.1", srv.Port, sftptest.User, sftptest.Password)
+	sess.ResolvedAddr = srv.Host
+	if err := sess.Connect(); err != nil {
+		t.Fatalf("connect: %v", err)
+	}
+	defer sess.Close()
+	if err := sess.OpenSFTP(); err != nil {
+		t.Fatalf("sftp: %v", err)
+	}
+
+	sess.WorkDir = "projects/deep"
+	if _, err := sess.Stat("notes.txt"); err != nil {
+		t.Errorf("relative path should resolve under WorkDir: %v", err)
+	}
+	entries, err := sess.ReadDir(".")
+	if err != nil || len(entries) != 1 || entries[0].Name() != "notes.txt" {
+		t.Errorf("ReadDir(%q) under WorkDir = %v entries, err %v", ".", len(entries), err)
+	}
+
+	// Absolute paths must bypass the working directory entirely.
+	abs, err := sess.RealPath("top.txt")
+	if err != nil || !strings.HasSuffix(abs, "/projects/deep/top.txt") {
+		t.Errorf("relative RealPath should resolve under WorkDir, got %q (%v)", abs, err)
+	}
+	if _, err := sess.Stat(root + "/top.txt"); err != nil {
+		t.Errorf("absolute path should ignore WorkDir: %v", err)
+	}
+
+	sess.WorkDir = ""
+	if _, err := sess.Stat("top.txt"); err != nil {
+		t.Errorf("clearing WorkDir should restore default resolution: %v", err)
+	}
+}
+
+func TestConnectReportsAuthMethod(t *testing.T) {
+	srv, err := sftptest.Start(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Close()
+
+	sess := NewSession("127.0.0.1", srv.Port, sftptest.User, sftptest.Password)
+	sess.ResolvedAddr = srv.Host
+	if err := sess.Connect(); err != nil {
+		t.Fatalf("connect: %v", err)
+	}
+	defer sess.Close()
+	if sess.AuthMethodUsed != "password" {
+		t.Errorf("AuthMethodUsed = %q, want %q", sess.AuthMethodUsed, "password")
+	}
+
+	// A rejection must still map onto the sentinel and say what was offered.
+	bad := NewSession("127.0.0.1", srv.Port, sftptest.User, "wrong")
+	bad.ResolvedAddr = srv.Host
+	err = bad.Connect()
+	if !errors.Is(err, core.ErrAuthFailed) {
+		t.Fatalf("wrong password: err = %v, want ErrAuthFailed", err)
+	}
+	if !strings.Contains(err.Error(), "password") {
+		t.Errorf("failure should name the attempted methods, got %q", err)
+	}
+}
+
+func TestOpenSFTPWithExplicitSubsystem(t *testing.T) {
+	srv, err := sftptest.Start(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Close()
+
+	sess := NewSession("127.0.0.1", srv.Port, sftptest.User, sftptest.Password)
+	sess.ResolvedAddr = srv.Host
+	sess.Subsystem = "sftp" // standard name, but through the by-hand channel path
+	if err := sess.Connect(); err != nil {
+		t.Fatalf("connect: %v", err)
+	}
+	defer sess.Close()
+	if err := sess.OpenSFTP(); err != nil {
+		t.Fatalf("sftp via explicit subsystem: %v", err)
+	}
+	if _, err := sess.ReadDir("."); err != nil {
+		t.Errorf("readdir over explicit subsystem: %v", err)
+	}
+
+	// A name the server refuses must fail loudly, naming the subsystem.
+	other := NewSession("127.0.0.1", srv.Port, sftptest.User, sftptest.Password)
+	other.ResolvedAddr = srv.Host
+	other.Subsystem = "sftp-v6"
+	if err := other.Connect(); err != nil {
+		t.Fatalf("connect: %v", err)
+	}
+	defer other.Close()
+	if err := other.OpenSFTP(); err == nil || !strings.Contains(err.Error(), "sftp-v6") {
+		t.Errorf("refused subsystem should surface its name, got %v", err)
+	}
+}
+
+func TestParseAuthKeyDistinguishesFailures(t *testing.T) {
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	plainBlock, err := ssh.MarshalPrivateKey(priv, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	plain := pem.EncodeToMemory(plainBlock)
+
+	encBlock, err := ssh.MarshalPrivateKeyWithPassphrase(priv, "", []byte("s3cret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	encrypted := pem.EncodeToMemory(encBlock)
+
+	if _, err := parseAuthKey(plain, "", "inline"); err != nil {
+		t.Errorf("plain key without passphrase: %v", err)
+	}
+	if _, err := parseAuthKey(encrypted, "s3cret", "inline"); err != nil {
+		t.Errorf("encrypted key with right passphrase: %v", err)
+	}
+
+	// The three failure shapes each get their own message, so the daemon
+	// can tell the user what to actually fix.
+	if _, err := parseAuthKey(encrypted, "", "inline"); err == nil ||
+		!strings.Contains(err.Error(), "passphrase required") {
+		t.Errorf("missing passphrase: got %v, want passphrase required", err)
+	}
+	if _, err := parseAuthKey(encrypted, "wrong", "inline"); err == nil ||
+		!strings.Contains(err.Error(), "incorrect passphrase") {
+		t.Errorf("wrong passphrase: got %v, want incorrect passphrase", err)
+	}
+	if _, err := parseAuthKey([]byte("not a key at all"), "", "bad.pem"); err == nil ||
+		strings.Contains(err.Error(), "passphrase") {
+		t.Errorf("garbage key: got %v, want a parse error naming the key", err)
+	}
+}
+
+func TestNewSessionWithKeyKeepsPasswordFallback(t *testing.T) {
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	block, err := ssh.MarshalPrivateKey(priv, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sess := NewSessionWithKey("example.test", 22, "erik", pem.EncodeToMemory(block), "")
+	sess.Password = "hunter2"
+
+	methods, names, _, err := sess.connectAuth()
+	if err != nil {
+		t.Fatalf("connectAuth: %v", err)
+	}
+	if len(methods) != len(names) {
+		t.Fatalf("methods/names out of sync: %d vs %d", len(methods), len(names))
+	}
+	if names[0] != "key" {
+		t.Errorf("first method = %s, want key", names[0])
+	}
+	if names[len(names)-1] != "password" {
+		t.Errorf("last method = %s, want password fallback", names[len(names)-1])
+	}
+}
+
+func TestPinnedFingerprintGatesTheHandshake(t *testing.T) {
+	srv, err := sftptest.Start(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Close()
+
+	// The right pin connects, in either cosmetic form.
+	sess := NewSession("127.0.0.1", srv.Port, sftptest.User, sftptest.Password)
+	sess.ResolvedAddr = srv.Host
+	sess.PinnedFingerprint = srv.HostKeyFingerprint
+	if err := sess.Connect(); err != nil {
+		t.Fatalf("connect with correct pin: %v", err)
+	}
+	sess.Close()
+
+	sess = NewSession("127.0.0.1", srv.Port, sftptest.User, sftptest.Password)
+	sess.ResolvedAddr = srv.Host
+	sess.PinnedFingerprint = strings.TrimPrefix(srv.HostKeyFingerprint, "SHA256:") + "="
+	if err := sess.Connect(); err != nil {
+		t.Fatalf("connect with bare padded pin: %v", err)
+	}
+	sess.Close()
+
+	// A wrong pin fails with a message naming both fingerprints.
+	sess = NewSession("127.0.0.1", srv.Port, sftptest.User, sftptest.Password)
+	sess.ResolvedAddr = srv.Host
+	sess.PinnedFingerprint = "SHA256:AAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAA"
+	err = sess.Connect()
+	if err == nil {
+		sess.Close()
+		t.Fatal("connect with wrong pin should fail")
+	}
+	if !strings.Contains(err.Error(), "host key mismatch") ||
+		!strings.Contains(err.Error(), "pinned") {
+		t.Errorf("mismatch error should name the pin: %v", err)
+	}
+
+	// TestConnection must refuse the wrong key too — the probe sends real
+	// credentials, so it can't be looser than Connect.
+	result := sess.TestConnection()
+	if result.Authenticated {
+		t.Error("probe authenticated against a host failing the pin")
+	}
+	if !strings.Contains(result.Error, "host key mismatch") {
+		t.Errorf("probe error should report the mismatch: %q", result.Error)
+	}
+	if result.HostKey != srv.HostKeyFingerprint {
+		t.Errorf("probe recorded host key %q, want %q", result.HostKey, srv.HostKeyFingerprint)
+	}
+}
+
+func TestKeepaliveRunsUntilClose(t *testing.T) {
+	srv, err := sftptest.Start(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Close()
+
+	sess := NewSession("127.0.0.1", srv.Port, sftptest.User, sftptest.Password)
+	sess.ResolvedAddr = srv.Host
+	sess.KeepaliveInterval = 20 * time.Millisecond
+	if err := sess.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	if err := sess.OpenSFTP(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Let several keepalives go out; the session must stay healthy.
+	time.Sleep(100 * time.Millisecond)
+	if _, err := sess.Getwd(); err != nil {
+		t.Errorf("session unhealthy while keepalives run: %v", err)
+	}
+
+	// Close stops the pinger; closing twice must stay safe.
+	sess.Close()
+	sess.Close()
+}
+
+func TestSessionThroughJumpHost(t *testing.T) {
+	bastionSrv, err := sftptest.Start(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer bastionSrv.Close()
+
+	targetRoot := t.TempDir()
+	targetSrv, err := sftptest.Start(targetRoot)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer targetSrv.Close()
+	if err := os.WriteFile(filepath.Join(targetRoot, "behind.txt"), []byte("x"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	bastion := NewSession("127.0.0.1", bastionSrv.Port, sftptest.User, sftptest.Password)
+	bastion.ResolvedAddr = bastionSrv.Host
+	if err := bastion.Connect(); err != nil {
+		t.Fatalf("bastion connect: %v", err)
+	}
+	defer bastion.Close()
+
+	// Dialing before the bastion is up must fail clearly.
+	early := NewSessionThroughJump(&SftpSession{Hostname: "dead"}, "127.0.0.1", targetSrv.Port, sftptest.User, sftptest.Password)
+	if err := early.Connect(); err == nil || !strings.Contains(err.Error(), "not connected") {
+		t.Errorf("connect through dead jump: got %v, want a not-connected error", err)
+	}
+
+	sess := NewSessionThroughJump(bastion, "127.0.0.1", targetSrv.Port, sftptest.User, sftptest.Password)
+	if err := sess.Connect(); err != nil {
+		t.Fatalf("connect through jump: %v", err)
+	}
+	if err := sess.OpenSFTP(); err != nil {
+		t.Fatalf("sftp through jump: %v", err)
+	}
+	if _, err := sess.Stat("behind.txt"); err != nil {
+		t.Errorf("stat through tunnel: %v", err)
+	}
+
+	// Closing the tunneled session leaves the bastion usable.
+	sess.Close()
+	if err := bastion.OpenSFTP(); err != nil {
+		t.Errorf("bastion should survive the inner close: %v", err)
+	}
+	if _, err := bastion.Getwd(); err != nil {
+		t.Errorf("bastion unusable after inner close: %v", err)
+	}
+}
+
+func TestRemoveAllDeletesTheWholeTree(t *testing.T) {
+	root := t.TempDir()
+	srv, err := sftptest.Start(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Close()
+
+	for _, rel := range []string{"junk/a.txt", "junk/sub/b.txt", "junk/sub/deep/c.txt"} {
+		full := filepath.Join(root, filepath.FromSlash(rel))
+		if err := os.MkdirAll(filepath.Dir(full), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(full, []byte("x"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	sess := NewSession("127.0.0.1", srv.Port, sftptest.User, sftptest.Password)
+	sess.ResolvedAddr = srv.Host
+	if err := sess.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	defer sess.Close()
+	if err := sess.OpenSFTP(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := sess.RemoveAll(context.Background(), "junk"); err != nil {
+		t.Fatalf("RemoveAll: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(root, "junk")); !os.IsNotExist(err) {
+		t.Errorf("junk/ still exists: %v", err)
+	}
+
+	// Already gone is a success, like os.RemoveAll.
+	if err := sess.RemoveAll(context.Background(), "junk"); err != nil {
+		t.Errorf("second RemoveAll: %v", err)
+	}
+
+	// A dead context stops before anything is touched.
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := sess.RemoveAll(cancelled, "."); err == nil {
+		t.Error("cancelled context should refuse to delete")
+	}
+}
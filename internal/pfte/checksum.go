@@ -17,10 +17,18 @@
 package pfte
 
 import (
+	"context"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
+	"hash"
 	"hash/crc32"
 	"io"
 	"os"
+	"sync"
+
+	"fileripper/internal/network"
 )
 
 // CalculateChecksum computes the CRC32 hash of a file.
@@ -45,3 +53,233 @@ func CalculateChecksum(filePath string) (string, error) {
 	// Return as hex string for easy comparison
 	return fmt.Sprintf("%x", hasher.Sum32()), nil
 }
+
+// crc32CombineIEEE concatenates two CRC32s: given crc1 over some prefix and
+// crc2 over the len2 bytes that follow it, the result equals the CRC of the
+// whole run — the trick (borrowed from zlib) is advancing crc1 through len2
+// zero bytes with GF(2) matrix squaring, then xoring crc2 in. This is what
+// lets the multipart chunk workers hash independently and still end up with
+// the exact checksum a single stream would have produced.
+func crc32CombineIEEE(crc1, crc2 uint32, len2 int64) uint32 {
+	if len2 <= 0 {
+		return crc1
+	}
+
+	var even, odd [32]uint32
+
+	// odd = the operator for one zero bit: a right shift plus the
+	// reflected polynomial on carry-out.
+	odd[0] = 0xedb88320
+	for i := 1; i < 32; i++ {
+		odd[i] = 1 << (i - 1)
+	}
+	gf2MatrixSquare(&even, &odd) // two bits
+	gf2MatrixSquare(&odd, &even) // four bits
+
+	// Apply len2 zero bytes to crc1, squaring the operator each round so
+	// every bit of len2 costs one matrix multiply. The first squaring
+	// below turns the four-bit operator into the one-byte operator that
+	// matches len2's lowest bit.
+	for {
+		gf2MatrixSquare(&even, &odd)
+		if len2&1 != 0 {
+			crc1 = gf2MatrixTimes(&even, crc1)
+		}
+		len2 >>= 1
+		if len2 == 0 {
+			break
+		}
+		gf2MatrixSquare(&odd, &even)
+		if len2&1 != 0 {
+			crc1 = gf2MatrixTimes(&odd, crc1)
+		}
+		len2 >>= 1
+		if len2 == 0 {
+			break
+		}
+	}
+	return crc1 ^ crc2
+}
+
+func gf2MatrixTimes(mat *[32]uint32, vec uint32) uint32 {
+	var sum uint32
+	for i := 0; vec != 0; i, vec = i+1, vec>>1 {
+		if vec&1 != 0 {
+			sum ^= mat[i]
+		}
+	}
+	return sum
+}
+
+func gf2MatrixSquare(square, mat *[32]uint32) {
+	for i := 0; i < 32; i++ {
+		square[i] = gf2MatrixTimes(mat, mat[i])
+	}
+}
+
+// crcOfLocalRange hashes length bytes of path starting at offset — used to
+// fill in the checksum of a resumed chunk whose bytes went up in an earlier
+// run.
+func crcOfLocalRange(path string, offset, length int64) (uint32, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	if _, err := f.Seek(offset, io.SeekStart); err != nil {
+		return 0, err
+	}
+	hasher := crc32.NewIEEE()
+	if _, err := io.CopyN(hasher, f, length); err != nil {
+		return 0, err
+	}
+	return hasher.Sum32(), nil
+}
+
+// ManifestAlgo names the digest used for a manifest walk. CRC32 is the
+// transfer-check default; MD5/SHA256 cost more but give a manifest other
+// tools (md5sum, sha256sum) can verify independently.
+type ManifestAlgo string
+
+const (
+	AlgoCRC32  ManifestAlgo = "crc32"
+	AlgoMD5    ManifestAlgo = "md5"
+	AlgoSHA256 ManifestAlgo = "sha256"
+)
+
+func (a ManifestAlgo) newHasher() (hash.Hash, error) {
+	switch a {
+	case AlgoCRC32, "":
+		return crc32.NewIEEE(), nil
+	case AlgoMD5:
+		return md5.New(), nil
+	case AlgoSHA256:
+		return sha256.New(), nil
+	default:
+		return nil, fmt.Errorf("unknown manifest algorithm %q", a)
+	}
+}
+
+// RemoteManifest walks a remote tree and streams every file through a hash —
+// no local writes, no disk needed — producing path (relative to root) ->
+// hex digest. The hashing is spread across workers round-robining over the
+// sessions, the same way transfers are. The result is the baseline a later
+// Compare or verify run checks against.
+func (e *Engine) RemoteManifest(ctx context.Context, sessions []*network.SftpSession, root string, algo ManifestAlgo) (map[string]string, error) {
+	if len(sessions) == 0 || !sessions[0].Ready() {
+		return nil, fmt.Errorf("no_active_sessions")
+	}
+	if _, err := algo.newHasher(); err != nil {
+		return nil, err // reject before walking anything
+	}
+
+	// Enumerate first so the monitor can show real totals while hashing.
+	GlobalMonitor.SetPhase(PhaseEnumerating)
+	var paths []string
+	var totalBytes int64
+	walker := sessions[0].Walk(root)
+	for walker.Step() {
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		default:
+		}
+		if walker.Err() != nil {
+			continue
+		}
+		stat := walker.Stat()
+		rel := remoteRelPath(root, walker.Path())
+		if rel != "." && matchesExclude(e.Excludes, rel) {
+			if stat.IsDir() {
+				walker.SkipDir()
+			}
+			continue
+		}
+		if stat.IsDir() || stat.Mode()&os.ModeSymlink != 0 {
+			continue
+		}
+		paths = append(paths, walker.Path())
+		totalBytes += stat.Size()
+	}
+
+	GlobalMonitor.Reset(int64(len(paths)), totalBytes)
+	GlobalMonitor.SetPhase(PhaseVerifying)
+	defer GlobalMonitor.SetPhase(PhaseIdle)
+	defer GlobalMonitor.SetRunning(false)
+
+	concurrency := e.concurrency()
+	if concurrency > len(paths) {
+		concurrency = len(paths)
+	}
+
+	manifest := make(map[string]string, len(paths))
+	var mu sync.Mutex
+	var firstErr error
+
+	pathChan := make(chan string, len(paths))
+	for _, p := range paths {
+		pathChan <- p
+	}
+	close(pathChan)
+
+	var wg sync.WaitGroup
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func(sess *network.SftpSession) {
+			defer wg.Done()
+			buf := make([]byte, BufferSize)
+			for remotePath := range pathChan {
+				mu.Lock()
+				stop := firstErr != nil
+				mu.Unlock()
+				if stop {
+					return
+				}
+
+				digest, err := hashRemoteFile(ctx, sess, remotePath, algo, buf)
+				mu.Lock()
+				if err != nil {
+					if firstErr == nil {
+						firstErr = fmt.Errorf("%s: %v", remotePath, err)
+					}
+					mu.Unlock()
+					return
+				}
+				manifest[remoteRelPath(root, remotePath)] = digest
+				mu.Unlock()
+				GlobalMonitor.IncFileDone()
+			}
+		}(sessions[i%len(sessions)])
+	}
+	wg.Wait()
+
+	if firstErr != nil {
+		return nil, firstErr
+	}
+	return manifest, nil
+}
+
+// hashRemoteFile streams one remote file through the digest without writing
+// a byte locally.
+func hashRemoteFile(ctx context.Context, sess *network.SftpSession, remotePath string, algo ManifestAlgo, buf []byte) (string, error) {
+	hasher, err := algo.newHasher()
+	if err != nil {
+		return "", err
+	}
+	src, err := sess.Open(remotePath)
+	if err != nil {
+		return "", err
+	}
+	defer src.Close()
+
+	written, err := copyWithContext(ctx, hasher, src, buf)
+	if err != nil {
+		return "", err
+	}
+	GlobalMonitor.AddBytes(written)
+
+	if h32, ok := hasher.(hash.Hash32); ok {
+		return fmt.Sprintf("%x", h32.Sum32()), nil // matches CalculateChecksum
+	}
+	return hex.EncodeToString(hasher.Sum(nil)), nil
+}
@@ -0,0 +1,153 @@
+/*
+ * Copyright 2026 The FileRipper Team
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package pfte
+
+import (
+	"crypto/rand"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// CollisionPolicy decides what happens when a finished download finds that
+// another job in the same batch already landed at its local path. Flatten
+// mode and overlapping jobs make this entirely possible, and before this
+// policy existed the two workers would race on os.Create and corrupt the
+// output.
+type CollisionPolicy int
+
+const (
+	// CollisionOverwrite keeps the historical behavior: last writer wins,
+	// but atomically — the loser's bytes are fully replaced, never mixed.
+	CollisionOverwrite CollisionPolicy = iota
+	// CollisionError fails the colliding job.
+	CollisionError
+	// CollisionRename parks the colliding file at "name (1).ext",
+	// "name (2).ext", ... so every job's bytes survive.
+	CollisionRename
+	// CollisionSkip drops the colliding job's bytes and keeps the first
+	// writer's file.
+	CollisionSkip
+)
+
+func (p CollisionPolicy) String() string {
+	switch p {
+	case CollisionError:
+		return "error"
+	case CollisionRename:
+		return "rename"
+	case CollisionSkip:
+		return "skip"
+	default:
+		return "overwrite"
+	}
+}
+
+// SetCollisionPolicy picks the policy for the next transfers. Like the other
+// globals it's shared by every worker; changing it mid-batch affects files
+// that finish after the call.
+func SetCollisionPolicy(p CollisionPolicy) {
+	claimMu.Lock()
+	collisionPolicy = p
+	claimMu.Unlock()
+}
+
+// claimedPaths maps each local path claimed this batch to the job that owns
+// it, so a retry of the same job re-claims its own path without tripping the
+// policy. Reset at the start of every pool run.
+var (
+	claimMu         sync.Mutex
+	claimedPaths    = make(map[string]*JobResult)
+	collisionPolicy CollisionPolicy
+)
+
+func resetDownloadClaims() {
+	claimMu.Lock()
+	claimedPaths = make(map[string]*JobResult)
+	claimMu.Unlock()
+}
+
+// tempDownloadPath returns a name next to localPath that no other worker can
+// be writing: the random suffix makes concurrent downloads of the same file
+// land in separate temp files.
+func tempDownloadPath(localPath string) string {
+	var b [4]byte
+	_, _ = rand.Read(b[:])
+	return fmt.Sprintf("%s.fr-%x.tmp", localPath, b)
+}
+
+// pathClaimedByOther reports whether someone else's job owns localPath.
+func pathClaimedByOther(localPath string, res *JobResult) bool {
+	claimMu.Lock()
+	defer claimMu.Unlock()
+	owner, ok := claimedPaths[localPath]
+	return ok && owner != res
+}
+
+// finalizeDownload moves a completed temp file into place, applying the
+// collision policy when another job got there first. It returns the path the
+// bytes actually ended up at — with CollisionRename that may be a numbered
+// variant, with CollisionSkip it's the survivor's path.
+func finalizeDownload(tmpPath, localPath string, res *JobResult) (string, error) {
+	claimMu.Lock()
+	defer claimMu.Unlock()
+
+	owner, taken := claimedPaths[localPath]
+	if !taken || owner == res || collisionPolicy == CollisionOverwrite {
+		if err := os.Rename(tmpPath, localPath); err != nil {
+			_ = os.Remove(tmpPath)
+			return "", err
+		}
+		claimedPaths[localPath] = res
+		return localPath, nil
+	}
+
+	switch collisionPolicy {
+	case CollisionError:
+		_ = os.Remove(tmpPath)
+		return "", fmt.Errorf("local_collision: %s already written by another job", localPath)
+	case CollisionSkip:
+		_ = os.Remove(tmpPath)
+		return localPath, nil
+	default: // CollisionRename
+		for i := 1; ; i++ {
+			candidate := numberedPath(localPath, i)
+			if _, claimed := claimedPaths[candidate]; claimed {
+				continue
+			}
+			if _, err := os.Stat(candidate); err == nil {
+				continue
+			}
+			if err := os.Rename(tmpPath, candidate); err != nil {
+				_ = os.Remove(tmpPath)
+				return "", err
+			}
+			claimedPaths[candidate] = res
+			return candidate, nil
+		}
+	}
+}
+
+// numberedPath inserts " (n)" before the extension: "report.pdf" becomes
+// "report (1).pdf", extensionless names just get the suffix appended.
+func numberedPath(localPath string, n int) string {
+	ext := filepath.Ext(localPath)
+	base := strings.TrimSuffix(localPath, ext)
+	return fmt.Sprintf("%s (%d)%s", base, n, ext)
+}
@@ -0,0 +1,389 @@
+/*
+ * Copyright 2026 The FileRipper Team
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package pfte
+
+import (
+	"context"
+	"fmt"
+	"hash/crc32"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"fileripper/internal/network"
+)
+
+// DiffState classifies one path in a local-vs-remote comparison.
+type DiffState int
+
+const (
+	DiffIdentical DiffState = iota
+	DiffModified
+	DiffMissingLocal  // exists remotely, not locally
+	DiffMissingRemote // exists locally, not remotely
+)
+
+func (d DiffState) String() string {
+	switch d {
+	case DiffModified:
+		return "modified"
+	case DiffMissingLocal:
+		return "missing_local"
+	case DiffMissingRemote:
+		return "missing_remote"
+	default:
+		return "identical"
+	}
+}
+
+// DiffEntry is one file's verdict. Paths are relative to the compared roots.
+type DiffEntry struct {
+	Path       string `json:"path"`
+	State      string `json:"state"`
+	LocalSize  int64  `json:"local_size,omitempty"`
+	RemoteSize int64  `json:"remote_size,omitempty"`
+	Detail     string `json:"detail,omitempty"` // what differed (size, mtime, checksum)
+}
+
+// CompareReport is the structured answer to "are these trees in sync?".
+// It marshals cleanly to JSON for scripting.
+type CompareReport struct {
+	Identical     int         `json:"identical"`
+	Modified      int         `json:"modified"`
+	MissingLocal  int         `json:"missing_local"`
+	MissingRemote int         `json:"missing_remote"`
+	Entries       []DiffEntry `json:"entries"`
+}
+
+// InSync is true when nothing differs.
+func (r *CompareReport) InSync() bool {
+	return r.Modified == 0 && r.MissingLocal == 0 && r.MissingRemote == 0
+}
+
+// mtimeTolerance absorbs filesystems that round timestamps (FAT: 2s) and
+// SFTP servers that drop sub-second precision.
+const mtimeTolerance = 2 * time.Second
+
+// Compare walks both trees and reports, per file, whether they match —
+// without transferring or writing anything. With checksum off, "identical"
+// means same size and mtime (within tolerance); with it on, same size and
+// same CRC32, which reads every remote byte but catches silent corruption.
+// Excludes prune both walks the same way a transfer would.
+func (e *Engine) Compare(ctx context.Context, sessions []*network.SftpSession, localPath, remotePath string, checksum bool) (*CompareReport, error) {
+	if len(sessions) == 0 || !sessions[0].Ready() {
+		return nil, fmt.Errorf("no_active_sessions")
+	}
+	session := sessions[0]
+
+	absLocal, err := filepath.Abs(localPath)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := os.Stat(absLocal); err != nil {
+		return nil, err
+	}
+
+	GlobalMonitor.SetPhase(PhaseVerifying)
+	defer GlobalMonitor.SetPhase(PhaseIdle)
+
+	// Local side: rel path -> info.
+	local := make(map[string]os.FileInfo)
+	err = filepath.Walk(absLocal, func(p string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return nil
+		}
+		rel, err := filepath.Rel(absLocal, p)
+		if err != nil {
+			return nil
+		}
+		rel = filepath.ToSlash(rel)
+		if matchesExclude(e.Excludes, rel) {
+			return nil
+		}
+		local[rel] = info
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	report := &CompareReport{}
+	add := func(rel string, state DiffState, localSize, remoteSize int64, detail string) {
+		switch state {
+		case DiffIdentical:
+			report.Identical++
+		case DiffModified:
+			report.Modified++
+		case DiffMissingLocal:
+			report.MissingLocal++
+		case DiffMissingRemote:
+			report.MissingRemote++
+		}
+		report.Entries = append(report.Entries, DiffEntry{
+			Path:       rel,
+			State:      state.String(),
+			LocalSize:  localSize,
+			RemoteSize: remoteSize,
+			Detail:     detail,
+		})
+	}
+
+	// Remote side: walk, matching against the local map as we go.
+	seen := make(map[string]bool)
+	walker := session.Walk(remotePath)
+	for walker.Step() {
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		default:
+		}
+		if walker.Err() != nil {
+			continue
+		}
+		stat := walker.Stat()
+		rel := remoteRelPath(remotePath, walker.Path())
+		if rel == "." {
+			continue
+		}
+		if matchesExclude(e.Excludes, rel) {
+			if stat.IsDir() {
+				walker.SkipDir()
+			}
+			continue
+		}
+		if stat.IsDir() || stat.Mode()&os.ModeSymlink != 0 {
+			continue
+		}
+		seen[rel] = true
+
+		localInfo, ok := local[rel]
+		if !ok {
+			add(rel, DiffMissingLocal, 0, stat.Size(), "")
+			continue
+		}
+		if localInfo.Size() != stat.Size() {
+			add(rel, DiffModified, localInfo.Size(), stat.Size(), "size")
+			continue
+		}
+		if checksum {
+			match, err := e.checksumsMatch(ctx, session, filepath.Join(absLocal, filepath.FromSlash(rel)), walker.Path())
+			if err != nil {
+				add(rel, DiffModified, localInfo.Size(), stat.Size(), "checksum unavailable: "+err.Error())
+				continue
+			}
+			if !match {
+				add(rel, DiffModified, localInfo.Size(), stat.Size(), "checksum")
+				continue
+			}
+		} else {
+			diff := localInfo.ModTime().Sub(stat.ModTime())
+			if diff < -mtimeTolerance || diff > mtimeTolerance {
+				add(rel, DiffModified, localInfo.Size(), stat.Size(), "mtime")
+				continue
+			}
+		}
+		add(rel, DiffIdentical, localInfo.Size(), stat.Size(), "")
+	}
+
+	// Anything local the remote walk never produced is missing remotely.
+	var onlyLocal []string
+	for rel := range local {
+		if !seen[rel] {
+			onlyLocal = append(onlyLocal, rel)
+		}
+	}
+	sort.Strings(onlyLocal)
+	for _, rel := range onlyLocal {
+		add(rel, DiffMissingRemote, local[rel].Size(), 0, "")
+	}
+
+	return report, nil
+}
+
+// checksumsMatch streams the remote file through a CRC32 (no writes) and
+// compares it with the local file's checksum.
+func (e *Engine) checksumsMatch(ctx context.Context, session *network.SftpSession, localPath, remotePath string) (bool, error) {
+	localSum, err := CalculateChecksum(localPath)
+	if err != nil {
+		return false, err
+	}
+
+	src, err := session.Open(remotePath)
+	if err != nil {
+		return false, err
+	}
+	defer src.Close()
+
+	hasher := crc32.NewIEEE()
+	buf := make([]byte, BufferSize)
+	if _, err := copyWithContext(ctx, hasher, src, buf); err != nil {
+		return false, err
+	}
+	return localSum == fmt.Sprintf("%x", hasher.Sum32()), nil
+}
+
+// RepairReport says what a Repair pass found and fixed. Paths are relative
+// to the repaired roots.
+type RepairReport struct {
+	Checked  int64    `json:"checked"`
+	Repaired []string `json:"repaired,omitempty"`
+}
+
+// Repair heals a local copy after a suspected corruption event: every file
+// in the remote tree is checksummed against its local counterpart (streaming
+// the remote side, no writes), and only the damaged or missing ones are
+// re-downloaded. Good files aren't touched. Stronger than a sync — size and
+// mtime lie happily about a truncated or bit-flipped file, checksums don't.
+func (e *Engine) Repair(ctx context.Context, sessions []*network.SftpSession, localPath, remotePath string) (*RepairReport, error) {
+	if len(sessions) == 0 || !sessions[0].Ready() {
+		return nil, fmt.Errorf("no_active_sessions")
+	}
+	session := sessions[0]
+
+	absLocal, err := filepath.Abs(localPath)
+	if err != nil {
+		return nil, err
+	}
+
+	GlobalMonitor.SetPhase(PhaseVerifying)
+
+	report := &RepairReport{}
+	var damaged []FileSpec
+
+	walker := session.Walk(remotePath)
+	for walker.Step() {
+		select {
+		case <-ctx.Done():
+			GlobalMonitor.SetPhase(PhaseIdle)
+			return nil, ctx.Err()
+		default:
+		}
+		if walker.Err() != nil {
+			continue
+		}
+		stat := walker.Stat()
+		rel := remoteRelPath(remotePath, walker.Path())
+		if rel == "." {
+			continue
+		}
+		if matchesExclude(e.Excludes, rel) {
+			if stat.IsDir() {
+				walker.SkipDir()
+			}
+			continue
+		}
+		if stat.IsDir() || stat.Mode()&os.ModeSymlink != 0 {
+			continue
+		}
+		report.Checked++
+
+		local := filepath.Join(absLocal, filepath.FromSlash(rel))
+		if _, err := os.Stat(local); err == nil {
+			// Any doubt (unreadable local, interrupted remote stream) counts
+			// as damage: re-downloading a good file is cheap, trusting a bad
+			// one is not.
+			if match, err := e.checksumsMatch(ctx, session, local, walker.Path()); err == nil && match {
+				continue
+			}
+		}
+		damaged = append(damaged, FileSpec{Local: local, Remote: walker.Path()})
+		report.Repaired = append(report.Repaired, rel)
+	}
+
+	GlobalMonitor.SetPhase(PhaseIdle)
+	if len(damaged) == 0 {
+		return report, nil
+	}
+	if err := e.TransferList(ctx, sessions, "DOWNLOAD", damaged); err != nil {
+		return report, err
+	}
+	return report, nil
+}
+
+// TouchSync fixes drifted timestamps without moving data: for every file
+// whose content matches on both sides (same size, same CRC32) but whose
+// remote mtime differs beyond the tolerance, the remote mtime is set to the
+// local one via Chtimes. Nothing is ever transferred or rewritten — a file
+// whose content differs is left strictly alone (that's a job for a real
+// sync). Returns how many timestamps were corrected.
+func (e *Engine) TouchSync(ctx context.Context, sessions []*network.SftpSession, localPath, remotePath string) (int, error) {
+	if len(sessions) == 0 || !sessions[0].Ready() {
+		return 0, fmt.Errorf("no_active_sessions")
+	}
+	session := sessions[0]
+
+	absLocal, err := filepath.Abs(localPath)
+	if err != nil {
+		return 0, err
+	}
+	if _, err := os.Stat(absLocal); err != nil {
+		return 0, err
+	}
+
+	GlobalMonitor.SetPhase(PhaseVerifying)
+	defer GlobalMonitor.SetPhase(PhaseIdle)
+
+	corrected := 0
+	walker := session.Walk(remotePath)
+	for walker.Step() {
+		select {
+		case <-ctx.Done():
+			return corrected, ctx.Err()
+		default:
+		}
+		if walker.Err() != nil {
+			continue
+		}
+		stat := walker.Stat()
+		rel := remoteRelPath(remotePath, walker.Path())
+		if rel == "." {
+			continue
+		}
+		if matchesExclude(e.Excludes, rel) {
+			if stat.IsDir() {
+				walker.SkipDir()
+			}
+			continue
+		}
+		if stat.IsDir() || stat.Mode()&os.ModeSymlink != 0 {
+			continue
+		}
+
+		localFile := filepath.Join(absLocal, filepath.FromSlash(rel))
+		localInfo, err := os.Stat(localFile)
+		if err != nil || localInfo.Size() != stat.Size() {
+			continue // missing or different — not ours to touch
+		}
+
+		diff := localInfo.ModTime().Sub(stat.ModTime())
+		if diff >= -mtimeTolerance && diff <= mtimeTolerance {
+			continue // already close enough
+		}
+
+		// Only fix the clock when the content genuinely matches.
+		match, err := e.checksumsMatch(ctx, session, localFile, walker.Path())
+		if err != nil || !match {
+			continue
+		}
+		if err := session.Chtimes(walker.Path(), time.Now(), localInfo.ModTime()); err != nil {
+			return corrected, fmt.Errorf("touch %s: %v", walker.Path(), err)
+		}
+		corrected++
+	}
+	return corrected, nil
+}
@@ -0,0 +1,48 @@
+//go:build windows
+
+/*
+ * Copyright 2026 The FileRipper Team
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package pfte
+
+import (
+	"syscall"
+	"unsafe"
+)
+
+// localFreeSpace reports the bytes available to us on the volume holding
+// dir, via GetDiskFreeSpaceExW. Errors just mean "couldn't tell" — callers
+// treat the preflight as best-effort.
+func localFreeSpace(dir string) (int64, error) {
+	kernel32 := syscall.NewLazyDLL("kernel32.dll")
+	proc := kernel32.NewProc("GetDiskFreeSpaceExW")
+
+	p, err := syscall.UTF16PtrFromString(dir)
+	if err != nil {
+		return 0, err
+	}
+	var freeToCaller, total, free uint64
+	r1, _, callErr := proc.Call(
+		uintptr(unsafe.Pointer(p)),
+		uintptr(unsafe.Pointer(&freeToCaller)),
+		uintptr(unsafe.Pointer(&total)),
+		uintptr(unsafe.Pointer(&free)),
+	)
+	if r1 == 0 {
+		return 0, callErr
+	}
+	return int64(freeToCaller), nil
+}
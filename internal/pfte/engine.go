@@ -19,6 +19,7 @@ package pfte
 import (
 	"context"
 	"fmt"
+	"io"
 	"os"
 	"path"
 	"path/filepath"
@@ -26,9 +27,10 @@ import (
 	"strings"
 	"sync"
 	"sync/atomic"
+	"time"
 
+	"fileripper/internal/core"
 	"fileripper/internal/network"
-	"github.com/pkg/sftp"
 )
 
 const (
@@ -47,93 +49,243 @@ const (
 type Engine struct {
 	Mode  TransferMode
 	Queue *JobQueue
+
+	// Concurrency pins the worker count exactly; 0 lets Mode decide
+	// (BatchSizeConservative or BatchSizeBoost).
+	Concurrency int
+
+	// OverallTimeout bounds a whole StartTransfer call (0 = no limit).
+	// FileTimeout bounds a single file, retries included (0 = no limit);
+	// a file that blows it is abandoned without killing the batch.
+	OverallTimeout time.Duration
+	FileTimeout    time.Duration
+
+	// FollowRemoteSymlinks makes the download walk resolve symlinks like
+	// before. Off by default: a link pointing at / (or at its own parent)
+	// must not turn a small download into an infinite one.
+	FollowRemoteSymlinks bool
+
+	// SkippedSpecial lists the non-regular files (fifos, devices, sockets)
+	// the last enumeration refused to touch. Opening a fifo blocks forever
+	// and device nodes produce garbage, so they're skipped with a visible
+	// trace; FailOnSpecial turns any of them into a hard error instead.
+	SkippedSpecial []string
+	FailOnSpecial  bool
+
+	// SkippedSymlinks lists the links we did NOT follow on the last
+	// download, so callers can recreate or report them.
+	SkippedSymlinks []RemoteSymlink
+
+	// ContentsOnly drops the source's top-level directory from the remote
+	// layout: uploading /home/me/project to /srv places project's files
+	// directly under /srv instead of /srv/project. A trailing slash on the
+	// source ("project/") enables this too, rsync-style.
+	ContentsOnly bool
+
+	// Resume makes interrupted multipart uploads restart from their chunk
+	// journal instead of byte zero.
+	Resume bool
+
+	// RelativeBase, when set, is the local directory remote layouts are
+	// computed against instead of the source's parent: uploading /a/b/c/d
+	// with base /a/b lays out c/d under the destination. The source must
+	// live inside it.
+	RelativeBase string
+
+	// KeepPartials controls what happens to the bytes of a download that
+	// ultimately failed: renamed to "<name>.part" when true, deleted when
+	// false (default). Either way the real name never holds a truncated
+	// file a consumer could mistake for a complete one.
+	KeepPartials bool
+
+	// MaxRetryRounds sends finally-failed jobs through whole extra passes
+	// after the main queue drains (transient server-side locks tend to
+	// clear by then). Zero keeps the single pass.
+	MaxRetryRounds int
+
+	// SkipExisting makes transfers sync-like in both directions: a file
+	// whose destination copy already matches the source (same size, same
+	// mtime within tolerance) is not enqueued. This is what makes
+	// re-running an interrupted tree transfer cheap without any journal.
+	SkipExisting bool
+
+	// DryRun makes StartTransfer stop after enumeration: the full report
+	// (directories, files, byte total) lands in LastPlan and nothing is
+	// created, queued, or moved. Invaluable for validating filters.
+	DryRun bool
+
+	// LastPlan holds the report of the most recent dry-run transfer.
+	LastPlan *TransferPlan
+
+	// Excludes holds glob patterns (path.Match syntax, plus "**" spanning
+	// directories) matched against each entry's base name and its path
+	// relative to the transfer root, in both directions. A matching
+	// directory is pruned from the walk entirely — excluding
+	// "node_modules" must not pay the cost of enumerating it.
+	Excludes []string
+
+	// Includes, when non-empty, admits only files matching at least one
+	// pattern (same syntax as Excludes). Directories are still walked:
+	// a non-matching directory may hold matching files.
+	Includes []string
+
+	// FuzzySearch re-enables the old behavior of hunting for a missing
+	// download target by name a few levels deep. Off by default: silently
+	// matching "something like it" when the user mistyped a path caused more
+	// grief than the convenience was worth.
+	FuzzySearch bool
+
+	// PauseOnDisconnect makes a batch survive total network loss: instead
+	// of every remaining job failing fast, the pool pauses, probes, and
+	// resumes when connectivity returns. PauseDeadline caps one continuous
+	// pause (0 = wait forever); ProbeInterval is how often to re-check
+	// (0 = every 5s).
+	PauseOnDisconnect bool
+	PauseDeadline     time.Duration
+	ProbeInterval     time.Duration
+
+	// MaxDepth caps how many directory levels below the source root the
+	// enumeration descends, on both sides: 0 queues only the source's
+	// immediate entries, 1 goes one level deeper, and so on. Directories at
+	// the cut are still created (empty) but never walked. Negative means
+	// unlimited — the default from NewEngine.
+	MaxDepth int
+
+	// VerifyDownloads re-checks each downloaded file against the checksum
+	// streamed during transfer; MismatchPolicy decides what happens when
+	// the check fails.
+	VerifyDownloads bool
+	MismatchPolicy  MismatchPolicy
+
+	// LastResults holds the per-job outcomes of the most recent batch
+	// transfer (completion order), the raw data for any end-of-run report.
+	LastResults []*TransferJob
+
+	// Warnings collects paths the last upload walk could not read (permission
+	// denied, vanished files, broken symlinks). The walk used to drop these
+	// silently — for a backup that means missing files nobody hears about.
+	// StrictWalk turns any warning into a hard failure before transfer.
+	Warnings   []string
+	StrictWalk bool
+
+	// PreserveDirModes copies source directory permissions to the
+	// destination (Chmod after create). When off, DefaultDirMode is used
+	// for created directories (0 = 0755).
+	PreserveDirModes bool
+	DefaultDirMode   os.FileMode
+
+	// PreserveFileModes is the download-side counterpart: each downloaded
+	// file gets the remote file's permissions instead of os.Create's
+	// 0666-minus-umask. When off, DefaultFileMode (if non-zero) is applied.
+	PreserveFileModes bool
+	DefaultFileMode   os.FileMode
+
+	// PreserveXattrs carries extended attributes across the wire in
+	// .fr-xattr sidecar files (SFTP itself has no xattr concept). Uploads
+	// write a sidecar next to each file that has attributes; downloads
+	// replay matching sidecars onto the local copies. Anything that
+	// couldn't be preserved lands in Warnings.
+	PreserveXattrs bool
+
+	// ForceFileMode / ForceDirMode override every uploaded file's /
+	// created directory's mode, regardless of the source. For sources
+	// whose modes are wrong or meaningless (zip extracts, Windows
+	// mounts) this beats any preserve policy. 0 = no override.
+	ForceFileMode os.FileMode
+	ForceDirMode  os.FileMode
+}
+
+// dirToCreate pairs a directory path with the mode captured at enumeration
+// time, so empty upload-drop dirs keep their restrictions too.
+type dirToCreate struct {
+	path string
+	mode os.FileMode
+}
+
+// RemoteSymlink records a symlink encountered (and not followed) during a
+// remote walk.
+type RemoteSymlink struct {
+	Path      string // remote path of the link itself
+	Target    string // what it points at (raw readlink result)
+	LocalPath string // where it would have landed locally
+	Reason    string // why it was skipped (policy, broken target, loop)
 }
 
 func NewEngine() *Engine {
 	return &Engine{
-		Mode:  ModeBoost,
-		Queue: NewQueue(),
+		Mode:     ModeBoost,
+		Queue:    NewQueue(),
+		MaxDepth: -1,
 	}
 }
 
 // StartTransfer handles the heavy lifting (source can be local or remote)
 func (e *Engine) StartTransfer(ctx context.Context, sessions []*network.SftpSession, operation string, sourcePath string, destPath string) error {
-	if len(sessions) == 0 || sessions[0].SftpClient == nil {
+	if len(sessions) == 0 || !sessions[0].Ready() {
 		return fmt.Errorf("no_active_sessions")
 	}
 	mainSession := sessions[0]
 
-	concurrency := BatchSizeConservative
-	if e.Mode == ModeBoost {
-		concurrency = BatchSizeBoost
+	if e.OverallTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, e.OverallTimeout)
+		defer cancel()
 	}
 
-	// --- UPLOAD LOGIC ---
-	if operation == "UPLOAD" {
-		absSource, err := filepath.Abs(sourcePath)
+	if e.DryRun {
+		plan, err := e.BuildPlan(ctx, sessions, operation, sourcePath, destPath, true)
 		if err != nil {
-			return fmt.Errorf("failed to get absolute path: %v", err)
+			return err
 		}
+		e.LastPlan = plan
+		return nil
+	}
 
-		// Base dir is the parent of the source folder (e.g., C:\Users\...)
-		baseDir := filepath.Dir(absSource)
-
-		var foldersToCreate []string
-		var filesToTransfer []*TransferJob
-		totalBytes := int64(0)
-
-		err = filepath.Walk(absSource, func(p string, info os.FileInfo, err error) error {
-			if err != nil {
-				return nil // (We skip errors to keep the flow going)
-			}
-
-			// Handle Symlinks: We follow them to keep it simple across OS
-			if info.Mode()&os.ModeSymlink != 0 {
-				resolvedPath, err := filepath.EvalSymlinks(p)
-				if err != nil {
-					return nil
-				}
-				info, err = os.Stat(resolvedPath)
-				if err != nil {
-					return nil
-				}
-			}
+	concurrency := e.concurrency()
 
-			// Calculate relative path from local base
-			relPath, err := filepath.Rel(baseDir, p)
-			if err != nil {
-				return err
+	// --- UPLOAD LOGIC ---
+	if operation == "UPLOAD" {
+		// Pin down the destination before walking anything: a stray slash
+		// or an empty dest produces a subtly wrong remote layout otherwise.
+		destPath, err := cleanDest(destPath)
+		if err != nil {
+			return err
+		}
+		if destPath == "." {
+			// Resolve to the server's working dir so the layout is explicit.
+			if wd, err := mainSession.Getwd(); err == nil {
+				destPath = wd
 			}
+		}
 
-			// Cross-platform path normalization: SFTP always wants forward slashes
-			remoteRel := filepath.ToSlash(relPath)
-			finalRemotePath := path.Join(destPath, remoteRel)
-
-			if info.IsDir() {
-				if remoteRel != "." && remoteRel != "" {
-					foldersToCreate = append(foldersToCreate, finalRemotePath)
-				}
-			} else {
-				filesToTransfer = append(filesToTransfer, &TransferJob{
-					LocalPath:  p,
-					RemotePath: finalRemotePath,
-					Operation:  "UPLOAD",
-				})
-				totalBytes += info.Size()
-			}
-			return nil
-		})
+		foldersToCreate, filesToTransfer, totalBytes, err := e.enumerateUpload(sourcePath, destPath)
 		if err != nil {
 			return err
 		}
 
-		sort.Slice(foldersToCreate, func(i, j int) bool {
-			return len(foldersToCreate[i]) < len(foldersToCreate[j])
-		})
+		// Sync mode: files whose remote copy already matches (uploads keep
+		// the source mtime, so a finished file compares equal on rerun)
+		// never reach the queue.
+		var skippedCount int64
+		if e.SkipExisting {
+			kept := filesToTransfer[:0]
+			for _, job := range filesToTransfer {
+				lst, lerr := os.Stat(job.LocalPath)
+				rst, rerr := mainSession.Stat(job.RemotePath)
+				if lerr == nil && rerr == nil && localUpToDate(lst, rst) {
+					skippedCount++
+					totalBytes -= lst.Size()
+					continue
+				}
+				kept = append(kept, job)
+			}
+			filesToTransfer = kept
+		}
 
 		dirCount := len(foldersToCreate)
 		if dirCount > 0 {
-			dirChan := make(chan string, dirCount)
+			GlobalMonitor.SetPhase(PhaseCreatingDirs)
+			dirChan := make(chan dirToCreate, dirCount)
 			var wg sync.WaitGroup
 			var doneCount int32
 			for _, d := range foldersToCreate {
@@ -150,7 +302,10 @@ func (e *Engine) StartTransfer(ctx context.Context, sessions []*network.SftpSess
 						case <-ctx.Done():
 							return
 						default:
-							_ = mainSession.SftpClient.MkdirAll(dir)
+							_ = mainSession.MkdirAll(dir.path)
+							if mode := e.dirMode(dir.mode); mode != 0 {
+								_ = mainSession.Chmod(dir.path, mode)
+							}
 							atomic.AddInt32(&doneCount, 1)
 						}
 					}
@@ -161,6 +316,10 @@ func (e *Engine) StartTransfer(ctx context.Context, sessions []*network.SftpSess
 
 		fileCount := int64(len(filesToTransfer))
 		if fileCount == 0 {
+			if skippedCount > 0 {
+				GlobalMonitor.Reset(0, 0)
+				GlobalMonitor.AddSkippedFiles(skippedCount)
+			}
 			return nil
 		}
 
@@ -168,9 +327,14 @@ func (e *Engine) StartTransfer(ctx context.Context, sessions []*network.SftpSess
 			e.Queue.Add(job)
 		}
 		GlobalMonitor.Reset(fileCount, totalBytes)
+		GlobalMonitor.AddSkippedFiles(skippedCount)
+		GlobalMonitor.SetPhase(PhaseTransferring)
 
-		workerPool := NewWorkerPool(concurrency, e.Queue)
+		workerPool := e.newPool(concurrency)
 		workerPool.StartUnleash(ctx, sessions)
+		e.LastResults = workerPool.Results()
+		e.Warnings = append(e.Warnings, workerPool.XattrIssues()...)
+		GlobalMonitor.SetPhase(PhaseIdle)
 		return nil
 
 		// --- DOWNLOAD LOGIC ---
@@ -186,34 +350,43 @@ func (e *Engine) startDownload(ctx context.Context, sessions []*network.SftpSess
 		os.Mkdir(localBase, 0755)
 	}
 
-	targetName := path.Base(targetPath)
-	if targetPath == "" || targetPath == "." {
-		targetName = ""
-	}
-	remoteSource := targetPath
-	if remoteSource == "" {
-		remoteSource = "."
+	remoteSource, rootDirName := downloadLayout(targetPath)
+
+	targetName := path.Base(remoteSource)
+	if remoteSource == "." || remoteSource == "/" {
+		targetName = "" // nothing sensible to search for
 	}
 
-	info, err := mainSession.SftpClient.Stat(remoteSource) // (We follow symlinks if the target is one)
+	info, err := mainSession.Stat(remoteSource) // (We follow symlinks if the target is one)
 
-	if err != nil && targetName != "" {
-		foundPath := findRemotePath(mainSession.SftpClient, ".", targetName, 3)
-		if foundPath != "" {
+	if err != nil && e.FuzzySearch && targetName != "" {
+		// Opt-in only: guessing at "something with that name" when the user
+		// mistyped a path is a trap, not a feature.
+		if foundPath := findRemotePath(mainSession, ".", targetName, 3); foundPath != "" {
 			remoteSource = foundPath
-			info, err = mainSession.SftpClient.Stat(remoteSource)
-		} else {
-			return fmt.Errorf("target not found")
+			info, err = mainSession.Stat(remoteSource)
 		}
 	}
 	if err != nil {
-		return err
+		return fmt.Errorf("%w: remote %q does not exist", core.ErrSourceNotFound, remoteSource)
 	}
 
 	queuedCount := int64(0)
 	totalBytes := int64(0)
+	skippedCount := int64(0)
+
+	GlobalMonitor.SetPhase(PhaseEnumerating)
+
+	// Cycle guard for symlink following: remember every resolved path we've
+	// already handled so a self/parent-pointing link can't loop us forever.
+	e.SkippedSymlinks = nil
+	e.SkippedSpecial = nil
+	visited := make(map[string]bool)
+	if resolved, err := mainSession.RealPath(remoteSource); err == nil {
+		visited[resolved] = true
+	}
 
-	walker := mainSession.SftpClient.Walk(remoteSource)
+	walker := mainSession.Walk(remoteSource)
 	for walker.Step() {
 		select {
 		case <-ctx.Done():
@@ -227,33 +400,96 @@ func (e *Engine) startDownload(ctx context.Context, sessions []*network.SftpSess
 		remotePath := walker.Path()
 		stat := walker.Stat()
 
-		relPath, err := filepath.Rel(remoteSource, remotePath)
-		if err != nil {
-			relPath = filepath.Base(remotePath)
-		}
-		rootDirName := filepath.Base(remoteSource)
-		if remoteSource == "." || remoteSource == "/" {
-			rootDirName = "root_dump"
+		relPath := remoteRelPath(remoteSource, remotePath)
+
+		if remotePath != remoteSource && matchesExclude(e.Excludes, relPath) {
+			if stat.IsDir() {
+				walker.SkipDir() // prune: don't descend, don't enumerate
+			}
+			continue
 		}
-		localPath := filepath.Join(localBase, rootDirName, relPath)
+
+		localPath := filepath.Join(localBase, rootDirName, filepath.FromSlash(relPath))
 
 		if !info.IsDir() && remotePath == remoteSource {
+			// A single file keeps its own name, whatever the layout.
 			localPath = filepath.Join(localBase, rootDirName)
+			if rootDirName == "" {
+				localPath = filepath.Join(localBase, path.Base(remoteSource))
+			}
 		}
 
 		if stat.Mode()&os.ModeSymlink != 0 {
-			realStat, err := mainSession.SftpClient.Stat(remotePath)
+			target, _ := mainSession.ReadLink(remotePath)
+			if !e.FollowRemoteSymlinks {
+				e.SkippedSymlinks = append(e.SkippedSymlinks, RemoteSymlink{
+					Path:      remotePath,
+					Target:    target,
+					LocalPath: localPath,
+					Reason:    "symlink following disabled",
+				})
+				continue
+			}
+			if resolved, err := mainSession.RealPath(remotePath); err == nil {
+				if visited[resolved] {
+					continue // already covered; following again would loop
+				}
+				visited[resolved] = true
+			}
+			realStat, err := mainSession.Stat(remotePath)
 			if err != nil {
+				// The walk saw the link (Lstat) but its target doesn't
+				// resolve: a dangling symlink. Silently vanishing files are
+				// worse than a visible skip, so put it on the report.
+				e.SkippedSymlinks = append(e.SkippedSymlinks, RemoteSymlink{
+					Path:      remotePath,
+					Target:    target,
+					LocalPath: localPath,
+					Reason:    "broken symlink: target does not exist",
+				})
 				continue
 			}
 			stat = realStat
 		}
 
+		if !stat.IsDir() && !stat.Mode().IsRegular() {
+			// Fifos, devices, sockets: downloading one is never what the
+			// user meant, and opening a fifo would hang a worker for good.
+			if e.FailOnSpecial {
+				return fmt.Errorf("special_file: %s (%s)", remotePath, stat.Mode())
+			}
+			e.SkippedSpecial = append(e.SkippedSpecial, remotePath)
+			continue
+		}
+
 		if stat.IsDir() {
 			os.MkdirAll(localPath, 0755)
+			if mode := e.dirMode(stat.Mode().Perm()); mode != 0 {
+				os.Chmod(localPath, mode)
+			}
+			if e.MaxDepth >= 0 && remotePath != remoteSource && pathDepth(relPath) >= e.MaxDepth {
+				walker.SkipDir() // created, but the depth cap says don't go in
+			}
+			continue
+		}
+
+		if e.PreserveXattrs && strings.HasSuffix(remotePath, xattrSuffix) {
+			// Sidecars are metadata, not payload: the worker replays them
+			// onto the real file instead of materializing them on disk.
+			continue
+		}
+
+		if remotePath != remoteSource && !includesFile(e.Includes, relPath) {
 			continue
 		}
 
+		if e.SkipExisting {
+			if lst, err := os.Stat(localPath); err == nil && localUpToDate(lst, stat) {
+				skippedCount++
+				continue
+			}
+		}
+
 		e.Queue.Add(&TransferJob{
 			LocalPath:  localPath,
 			RemotePath: remotePath,
@@ -264,15 +500,693 @@ func (e *Engine) startDownload(ctx context.Context, sessions []*network.SftpSess
 	}
 
 	GlobalMonitor.Reset(queuedCount, totalBytes)
+	GlobalMonitor.AddSkippedFiles(skippedCount)
+
+	// Preflight: if the batch plainly won't fit, say so now instead of
+	// failing mid-transfer with a pile of partials. Best-effort — when the
+	// OS can't tell us, the in-flight ENOSPC handling still has our back.
+	if free, err := localFreeSpace(localBase); err == nil && totalBytes > free {
+		GlobalMonitor.SetPhase(PhaseIdle)
+		return fmt.Errorf("%w: batch needs %d bytes but only %d are free locally",
+			core.ErrLocalDiskFull, totalBytes, free)
+	}
 
 	if queuedCount > 0 {
-		workerPool := NewWorkerPool(concurrency, e.Queue)
+		GlobalMonitor.SetPhase(PhaseTransferring)
+		workerPool := e.newPool(concurrency)
 		workerPool.StartUnleash(ctx, sessions)
+		e.LastResults = workerPool.Results()
+		e.Warnings = append(e.Warnings, workerPool.XattrIssues()...)
+	}
+	GlobalMonitor.SetPhase(PhaseIdle)
+	return nil
+}
+
+// UploadStream ships bytes from an arbitrary reader (e.g. stdin) to a remote
+// file. The source is non-seekable and its size unknown, so multipart and
+// resume don't apply; progress is bytes-so-far only.
+func (e *Engine) UploadStream(ctx context.Context, sessions []*network.SftpSession, r io.Reader, remote string) error {
+	if len(sessions) == 0 || !sessions[0].Ready() {
+		return fmt.Errorf("no_active_sessions")
+	}
+	client := sessions[0]
+
+	if dir := path.Dir(remote); dir != "." && dir != "/" {
+		_ = client.MkdirAll(dir)
+	}
+
+	dst, err := client.Create(remote)
+	if err != nil {
+		return err
+	}
+	defer dst.Close()
+
+	GlobalMonitor.Reset(1, 0)
+	GlobalMonitor.SetPhase(PhaseTransferring)
+	GlobalMonitor.SetCurrentFile(remote)
+	defer GlobalMonitor.SetPhase(PhaseIdle)
+	defer GlobalMonitor.SetRunning(false)
+
+	tracker := newProgressTracker(r)
+	buf := make([]byte, BufferSize)
+	if _, err := copyWithContext(ctx, dst, tracker, buf); err != nil {
+		return err
+	}
+	GlobalMonitor.IncFileDone()
+	return nil
+}
+
+// DownloadStream pulls a remote file into an arbitrary writer (e.g. stdout).
+func (e *Engine) DownloadStream(ctx context.Context, sessions []*network.SftpSession, remote string, w io.Writer) error {
+	if len(sessions) == 0 || !sessions[0].Ready() {
+		return fmt.Errorf("no_active_sessions")
+	}
+	client := sessions[0]
+
+	src, err := client.Open(remote)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	totalBytes := int64(0)
+	if st, err := client.Stat(remote); err == nil {
+		totalBytes = st.Size()
+	}
+	GlobalMonitor.Reset(1, totalBytes)
+	GlobalMonitor.SetPhase(PhaseTransferring)
+	GlobalMonitor.SetCurrentFile(remote)
+	defer GlobalMonitor.SetPhase(PhaseIdle)
+	defer GlobalMonitor.SetRunning(false)
+
+	tracker := newProgressTracker(src)
+	buf := make([]byte, BufferSize)
+	if _, err := copyWithContext(ctx, w, tracker, buf); err != nil {
+		return err
+	}
+	GlobalMonitor.IncFileDone()
+	return nil
+}
+
+// DownloadRange streams just the byte range [start, end) of a remote file to
+// w — the tail of a huge log, a chunk for caller-built resume logic —
+// seeking past everything before start and stopping at end. end <= 0 means
+// "through EOF". Progress covers only the requested range.
+func (e *Engine) DownloadRange(ctx context.Context, sessions []*network.SftpSession, remote string, start, end int64, w io.Writer) error {
+	if len(sessions) == 0 || !sessions[0].Ready() {
+		return fmt.Errorf("no_active_sessions")
+	}
+	client := sessions[0]
+
+	if start < 0 {
+		return fmt.Errorf("range start must be >= 0, got %d", start)
+	}
+	if end > 0 && end <= start {
+		return fmt.Errorf("range [%d, %d) is empty", start, end)
+	}
+
+	st, err := client.Stat(remote)
+	if err != nil {
+		return err
+	}
+	size := st.Size()
+	if start > size {
+		return fmt.Errorf("range start %d past end of file (%d bytes)", start, size)
+	}
+	if end <= 0 || end > size {
+		end = size
+	}
+
+	src, err := client.Open(remote)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	if _, err := src.Seek(start, io.SeekStart); err != nil {
+		return err
 	}
+
+	GlobalMonitor.Reset(1, end-start)
+	GlobalMonitor.SetPhase(PhaseTransferring)
+	GlobalMonitor.SetCurrentFile(remote)
+	defer GlobalMonitor.SetPhase(PhaseIdle)
+	defer GlobalMonitor.SetRunning(false)
+
+	tracker := newProgressTracker(io.LimitReader(src, end-start))
+	buf := make([]byte, BufferSize)
+	if _, err := copyWithContext(ctx, w, tracker, buf); err != nil {
+		return err
+	}
+	GlobalMonitor.IncFileDone()
 	return nil
 }
 
-func findRemotePath(client *sftp.Client, root, targetName string, maxDepth int) string {
+// FileSpec names one file to move: where it lives locally and remotely.
+type FileSpec struct {
+	Local  string
+	Remote string
+}
+
+// TransferList moves exactly the given files, preserving the caller's
+// layout — no walking, no discovery. Needed directories are created first.
+func (e *Engine) TransferList(ctx context.Context, sessions []*network.SftpSession, operation string, specs []FileSpec) error {
+	if len(sessions) == 0 || !sessions[0].Ready() {
+		return fmt.Errorf("no_active_sessions")
+	}
+	if len(specs) == 0 {
+		return nil
+	}
+	mainSession := sessions[0]
+
+	if e.OverallTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, e.OverallTimeout)
+		defer cancel()
+	}
+
+	totalBytes := int64(0)
+	parents := make(map[string]bool)
+
+	GlobalMonitor.SetPhase(PhaseEnumerating)
+
+	for _, spec := range specs {
+		if operation == "UPLOAD" {
+			st, err := os.Stat(spec.Local)
+			if err != nil {
+				return err
+			}
+			if st.IsDir() {
+				return fmt.Errorf("source_is_directory: %s", spec.Local)
+			}
+			totalBytes += st.Size()
+			parents[path.Dir(spec.Remote)] = true
+		} else {
+			st, err := mainSession.Stat(spec.Remote)
+			if err != nil {
+				return err
+			}
+			if st.IsDir() {
+				return fmt.Errorf("remote_is_directory: %s", spec.Remote)
+			}
+			totalBytes += st.Size()
+			parents[filepath.Dir(spec.Local)] = true
+		}
+	}
+
+	GlobalMonitor.SetPhase(PhaseCreatingDirs)
+	for dir := range parents {
+		if dir == "." || dir == "/" {
+			continue
+		}
+		if operation == "UPLOAD" {
+			_ = mainSession.MkdirAll(dir)
+		} else {
+			_ = os.MkdirAll(dir, 0755)
+		}
+	}
+
+	for _, spec := range specs {
+		e.Queue.Add(&TransferJob{
+			LocalPath:  spec.Local,
+			RemotePath: spec.Remote,
+			Operation:  operation,
+		})
+	}
+
+	GlobalMonitor.Reset(int64(len(specs)), totalBytes)
+	GlobalMonitor.SetPhase(PhaseTransferring)
+
+	pool := e.newPool(e.concurrency())
+	pool.StartUnleash(ctx, sessions)
+	e.LastResults = pool.Results()
+	GlobalMonitor.SetPhase(PhaseIdle)
+	return nil
+}
+
+// TransferBetween copies a file or tree from one remote host straight to
+// another: each file streams src -> dst through this process without ever
+// touching local disk, so the bytes cross the network once. A directory's
+// contents land under destPath. The usual queue/worker/monitor machinery
+// runs the batch, which is what makes trees, retries, and progress work.
+func (e *Engine) TransferBetween(ctx context.Context, src, dst *network.SftpSession, sourcePath, destPath string) error {
+	if src == nil || !src.Ready() || dst == nil || !dst.Ready() {
+		return fmt.Errorf("no_active_sessions")
+	}
+
+	if e.OverallTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, e.OverallTimeout)
+		defer cancel()
+	}
+
+	info, err := src.Stat(sourcePath)
+	if err != nil {
+		return fmt.Errorf("%w: remote %q does not exist", core.ErrSourceNotFound, sourcePath)
+	}
+
+	GlobalMonitor.SetPhase(PhaseEnumerating)
+	e.SkippedSymlinks = nil
+	e.SkippedSpecial = nil
+	queuedCount := int64(0)
+	totalBytes := int64(0)
+
+	if !info.IsDir() {
+		target := destPath
+		if target == "" || strings.HasSuffix(destPath, "/") {
+			target = path.Join(destPath, path.Base(sourcePath))
+		}
+		if dir := path.Dir(target); dir != "." && dir != "/" {
+			_ = dst.MkdirAll(dir)
+		}
+		e.Queue.Add(&TransferJob{LocalPath: sourcePath, RemotePath: target, Operation: "REMOTE"})
+		queuedCount, totalBytes = 1, info.Size()
+	} else {
+		walker := src.Walk(sourcePath)
+		for walker.Step() {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			default:
+			}
+			if walker.Err() != nil {
+				continue
+			}
+			remotePath := walker.Path()
+			stat := walker.Stat()
+			relPath := remoteRelPath(sourcePath, remotePath)
+
+			if remotePath != sourcePath && matchesExclude(e.Excludes, relPath) {
+				if stat.IsDir() {
+					walker.SkipDir()
+				}
+				continue
+			}
+
+			target := path.Join(destPath, relPath)
+
+			if stat.IsDir() {
+				_ = dst.MkdirAll(target)
+				continue
+			}
+			if stat.Mode()&os.ModeSymlink != 0 {
+				// No local side to plant a link on either end of; report it
+				// like the download walk does rather than silently drop it.
+				linkTarget, _ := src.ReadLink(remotePath)
+				e.SkippedSymlinks = append(e.SkippedSymlinks, RemoteSymlink{
+					Path:   remotePath,
+					Target: linkTarget,
+					Reason: "symlinks are not copied between servers",
+				})
+				continue
+			}
+			if !stat.Mode().IsRegular() {
+				e.SkippedSpecial = append(e.SkippedSpecial, remotePath)
+				continue
+			}
+
+			if remotePath != sourcePath && !includesFile(e.Includes, relPath) {
+				continue
+			}
+
+			e.Queue.Add(&TransferJob{LocalPath: remotePath, RemotePath: target, Operation: "REMOTE"})
+			queuedCount++
+			totalBytes += stat.Size()
+		}
+	}
+
+	GlobalMonitor.Reset(queuedCount, totalBytes)
+
+	if queuedCount > 0 {
+		GlobalMonitor.SetPhase(PhaseTransferring)
+		pool := e.newPool(e.concurrency())
+		pool.SourceSession = src
+		pool.StartUnleash(ctx, []*network.SftpSession{dst})
+		e.LastResults = pool.Results()
+	}
+	GlobalMonitor.SetPhase(PhaseIdle)
+	return nil
+}
+
+// Failures lists the jobs from the most recent batch that ended in an
+// error, path and reason each. Empty means everything queued actually made
+// it.
+func (e *Engine) Failures() []TransferError {
+	var out []TransferError
+	for _, job := range e.LastResults {
+		if job.Result.Err != nil {
+			out = append(out, TransferError{
+				Path:      job.RemotePath,
+				Operation: job.Operation,
+				Err:       job.Result.Err,
+			})
+		}
+	}
+	return out
+}
+
+// localUpToDate decides whether the local copy already matches the remote
+// file: same size and an mtime within the comparison tolerance (downloads
+// preserve the remote mtime, so a completed file compares equal on rerun).
+func localUpToDate(local, remote os.FileInfo) bool {
+	if local.IsDir() || local.Size() != remote.Size() {
+		return false
+	}
+	diff := local.ModTime().Sub(remote.ModTime())
+	return diff >= -mtimeTolerance && diff <= mtimeTolerance
+}
+
+// dirMode decides what mode a created directory should get: the source's
+// mode when preserving, the configured default otherwise, 0 for "leave it".
+func (e *Engine) dirMode(source os.FileMode) os.FileMode {
+	if e.ForceDirMode != 0 {
+		return e.ForceDirMode
+	}
+	if e.PreserveDirModes {
+		return source
+	}
+	return e.DefaultDirMode
+}
+
+// newPool builds a worker pool carrying the engine's per-file settings.
+// concurrency is the worker count for the next batch: an explicit
+// Concurrency setting wins, otherwise the mode decides.
+func (e *Engine) concurrency() int {
+	if e.Concurrency > 0 {
+		return e.Concurrency
+	}
+	if e.Mode == ModeBoost {
+		return BatchSizeBoost
+	}
+	return BatchSizeConservative
+}
+
+func (e *Engine) newPool(concurrency int) *WorkerPool {
+	wp := NewWorkerPool(concurrency, e.Queue)
+	wp.FileTimeout = e.FileTimeout
+	wp.Verify = e.VerifyDownloads
+	wp.Mismatch = e.MismatchPolicy
+	wp.Resume = e.Resume
+	wp.ForceFileMode = e.ForceFileMode
+	wp.KeepPartial = e.KeepPartials
+	wp.PreserveFileModes = e.PreserveFileModes
+	wp.DefaultFileMode = e.DefaultFileMode
+	wp.PreserveXattrs = e.PreserveXattrs
+	wp.MaxRetryRounds = e.MaxRetryRounds
+	wp.PauseOnDisconnect = e.PauseOnDisconnect
+	wp.PauseDeadline = e.PauseDeadline
+	wp.ProbeInterval = e.ProbeInterval
+	return wp
+}
+
+// enumerateUpload walks the local source and computes everything an upload
+// needs: directories to create (with their modes), the file jobs, and the
+// byte total. It performs no remote writes, so the planner can reuse it.
+func (e *Engine) enumerateUpload(sourcePath, destPath string) ([]dirToCreate, []*TransferJob, int64, error) {
+	// rsync semantics: "project/" means "the contents of project",
+	// "project" means the directory itself. filepath.Abs eats the
+	// trailing slash, so check before converting.
+	contentsOnly := e.ContentsOnly ||
+		strings.HasSuffix(sourcePath, "/") || strings.HasSuffix(sourcePath, string(os.PathSeparator))
+
+	absSource, err := filepath.Abs(sourcePath)
+	if err != nil {
+		return nil, nil, 0, fmt.Errorf("failed to get absolute path: %v", err)
+	}
+
+	// A typo'd source must fail loudly here: filepath.Walk would just hand
+	// the error to our warning collector and the "transfer" would succeed
+	// having moved nothing.
+	if _, err := os.Stat(absSource); err != nil {
+		return nil, nil, 0, fmt.Errorf("%w: local %q does not exist", core.ErrSourceNotFound, sourcePath)
+	}
+
+	// Base dir is the parent of the source folder (e.g., C:\Users\...),
+	// or the source itself when only its contents are wanted.
+	baseDir := filepath.Dir(absSource)
+	if contentsOnly {
+		baseDir = absSource
+	}
+	if e.RelativeBase != "" {
+		absBase, err := filepath.Abs(e.RelativeBase)
+		if err != nil {
+			return nil, nil, 0, fmt.Errorf("failed to get absolute path: %v", err)
+		}
+		rel, err := filepath.Rel(absBase, absSource)
+		if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(os.PathSeparator)) {
+			// A base that doesn't contain the source would produce ".."
+			// segments in remote paths — refuse rather than guess.
+			return nil, nil, 0, fmt.Errorf("source_outside_base")
+		}
+		baseDir = absBase
+	}
+
+	var foldersToCreate []dirToCreate
+	var filesToTransfer []*TransferJob
+	totalBytes := int64(0)
+
+	GlobalMonitor.SetPhase(PhaseEnumerating)
+
+	e.Warnings = nil
+	e.SkippedSpecial = nil
+	err = filepath.Walk(absSource, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			// Keep going, but leave a trace: a silently omitted file is the
+			// worst possible outcome for a backup.
+			e.Warnings = append(e.Warnings, fmt.Sprintf("%s: %v", p, err))
+			return nil
+		}
+
+		// Handle Symlinks: We follow them to keep it simple across OS
+		if info.Mode()&os.ModeSymlink != 0 {
+			resolvedPath, err := filepath.EvalSymlinks(p)
+			if err != nil {
+				e.Warnings = append(e.Warnings, fmt.Sprintf("%s: broken symlink: %v", p, err))
+				return nil
+			}
+			info, err = os.Stat(resolvedPath)
+			if err != nil {
+				e.Warnings = append(e.Warnings, fmt.Sprintf("%s: %v", p, err))
+				return nil
+			}
+		}
+
+		// Calculate relative path from local base
+		relPath, err := filepath.Rel(baseDir, p)
+		if err != nil {
+			return err
+		}
+
+		// Cross-platform path normalization: SFTP always wants forward slashes
+		remoteRel := filepath.ToSlash(relPath)
+		finalRemotePath := path.Join(destPath, remoteRel)
+
+		// Exclude/include filters, evaluated against the source-relative
+		// path so the same patterns behave identically in both directions.
+		if p != absSource {
+			if srcRel, err := filepath.Rel(absSource, p); err == nil {
+				sr := filepath.ToSlash(srcRel)
+				if matchesExclude(e.Excludes, sr) {
+					if info.IsDir() {
+						return filepath.SkipDir // pruned: don't even descend
+					}
+					return nil
+				}
+				if !info.IsDir() && !includesFile(e.Includes, sr) {
+					return nil
+				}
+			}
+		}
+
+		if !info.IsDir() && !info.Mode().IsRegular() {
+			// A fifo would hang the worker that opens it; skip loudly.
+			if e.FailOnSpecial {
+				return fmt.Errorf("special_file: %s (%s)", p, info.Mode())
+			}
+			e.SkippedSpecial = append(e.SkippedSpecial, p)
+			return nil
+		}
+
+		if info.IsDir() {
+			if remoteRel != "." && remoteRel != "" {
+				foldersToCreate = append(foldersToCreate, dirToCreate{finalRemotePath, info.Mode().Perm()})
+			}
+			if e.MaxDepth >= 0 && p != absSource {
+				if rel, err := filepath.Rel(absSource, p); err == nil &&
+					pathDepth(filepath.ToSlash(rel)) >= e.MaxDepth {
+					return filepath.SkipDir
+				}
+			}
+		} else if strings.HasSuffix(p, stateSuffix) {
+			// Our own resume journals don't belong on the server.
+			return nil
+		} else {
+			filesToTransfer = append(filesToTransfer, &TransferJob{
+				LocalPath:  p,
+				RemotePath: finalRemotePath,
+				Operation:  "UPLOAD",
+			})
+			totalBytes += info.Size()
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, nil, 0, err
+	}
+	if e.StrictWalk && len(e.Warnings) > 0 {
+		return nil, nil, 0, fmt.Errorf("walk_incomplete: %d path(s) could not be read", len(e.Warnings))
+	}
+
+	sort.Slice(foldersToCreate, func(i, j int) bool {
+		return len(foldersToCreate[i].path) < len(foldersToCreate[j].path)
+	})
+
+	return foldersToCreate, filesToTransfer, totalBytes, nil
+}
+
+// downloadLayout pins down where a download lands locally, because "it
+// depends" kept surprising people. The rules, with local base "dump":
+//
+//	""  or "." -> remote "."   -> dump/root_dump/...  (a named folder, so
+//	"/"        -> remote "/"   -> dump/root_dump/...   cwd isn't flooded)
+//	"foo"      -> remote "foo" -> dump/foo/...         (the directory itself)
+//	"foo/"     -> remote "foo" -> dump/...             (its contents, rsync-style)
+//	"./"       -> remote "."   -> dump/...
+//
+// A single file always keeps just its base name under the chosen root.
+// Inputs are cleaned first, so "a//b/." behaves like "a/b".
+func downloadLayout(targetPath string) (remoteSource, rootDirName string) {
+	cleaned := targetPath
+	if cleaned == "" {
+		cleaned = "."
+	}
+	cleaned = path.Clean(filepath.ToSlash(cleaned))
+
+	// Trailing slash = "the contents, not the folder", same as uploads.
+	contentsOnly := strings.HasSuffix(targetPath, "/") && cleaned != "/"
+
+	if cleaned == "/" {
+		return cleaned, "root_dump"
+	}
+	if cleaned == "." {
+		if contentsOnly {
+			return cleaned, ""
+		}
+		return cleaned, "root_dump"
+	}
+	if contentsOnly {
+		return cleaned, ""
+	}
+	return cleaned, path.Base(cleaned)
+}
+
+// cleanDest normalizes a remote destination path. The resulting layout is:
+// uploading <source> to <dest> produces <dest>/<source-base>/... (or
+// <dest>/... with ContentsOnly). Empty destinations are rejected rather
+// than guessed at.
+func cleanDest(dest string) (string, error) {
+	if strings.TrimSpace(dest) == "" {
+		return "", fmt.Errorf("empty_destination")
+	}
+	return path.Clean(filepath.ToSlash(dest)), nil
+}
+
+// pathDepth counts how many levels below the transfer root a forward-slash
+// relative path sits: "a" is 0, "a/b" is 1.
+func pathDepth(relPath string) int {
+	return strings.Count(relPath, "/")
+}
+
+// matchesExclude reports whether relPath (forward-slash, relative to the
+// transfer root) is excluded. Patterns are tried against the base name and
+// the full relative path, so both "*.log" and "cache/*" behave as expected.
+// Malformed patterns never match.
+func matchesExclude(patterns []string, relPath string) bool {
+	for _, pattern := range patterns {
+		if matchGlob(pattern, relPath) {
+			return true
+		}
+	}
+	return false
+}
+
+// includesFile is the admit side of the filter: an empty list admits
+// everything, otherwise at least one pattern has to match. Only applied to
+// files — pruning directories on includes would hide the files inside.
+func includesFile(patterns []string, relPath string) bool {
+	if len(patterns) == 0 {
+		return true
+	}
+	for _, pattern := range patterns {
+		if matchGlob(pattern, relPath) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchGlob is path.Match extended with "**", which spans any number of
+// path segments ("**/*.log" catches a log at any depth). Patterns without
+// "**" keep the old behavior: they try the base name and the full relative
+// path.
+func matchGlob(pattern, relPath string) bool {
+	if strings.Contains(pattern, "**") {
+		return matchSegments(strings.Split(pattern, "/"), strings.Split(relPath, "/"))
+	}
+	if ok, err := path.Match(pattern, path.Base(relPath)); err == nil && ok {
+		return true
+	}
+	ok, err := path.Match(pattern, relPath)
+	return err == nil && ok
+}
+
+// matchSegments matches pattern segments against path segments, "**"
+// swallowing zero or more of them.
+func matchSegments(pattern, segs []string) bool {
+	if len(pattern) == 0 {
+		return len(segs) == 0
+	}
+	if pattern[0] == "**" {
+		if matchSegments(pattern[1:], segs) {
+			return true
+		}
+		return len(segs) > 0 && matchSegments(pattern, segs[1:])
+	}
+	if len(segs) == 0 {
+		return false
+	}
+	if ok, err := path.Match(pattern[0], segs[0]); err != nil || !ok {
+		return false
+	}
+	return matchSegments(pattern[1:], segs[1:])
+}
+
+// remoteRelPath computes target relative to base using remote (forward-slash)
+// semantics. We can't use filepath.Rel here: it works with the OS separator,
+// so on Windows it would mangle remote names that legally contain backslashes,
+// and it errors on inputs that are perfectly fine remote paths.
+func remoteRelPath(base, target string) string {
+	b := path.Clean(base)
+	t := path.Clean(target)
+	if b == t {
+		return "."
+	}
+	if b == "." {
+		// Walk paths under "." come back already relative ("foo/bar").
+		return strings.TrimPrefix(t, "./")
+	}
+	prefix := b
+	if !strings.HasSuffix(prefix, "/") {
+		prefix += "/"
+	}
+	if strings.HasPrefix(t, prefix) {
+		return strings.TrimPrefix(t, prefix)
+	}
+	// Shouldn't happen during a walk rooted at base; degrade to the name.
+	return path.Base(t)
+}
+
+func findRemotePath(client network.RemoteFS, root, targetName string, maxDepth int) string {
 	if maxDepth < 0 {
 		return ""
 	}
@@ -296,8 +1210,35 @@ func findRemotePath(client *sftp.Client, root, targetName string, maxDepth int)
 	return ""
 }
 
+// AppendFile ships the local bytes beyond the remote file's current size,
+// appending in place. Single-session, single-stream: the append-only use
+// case (log shipping) has no business in the multipart swarm.
+func (e *Engine) AppendFile(ctx context.Context, sessions []*network.SftpSession, local, remote string) error {
+	if len(sessions) == 0 || !sessions[0].Ready() {
+		return fmt.Errorf("no_active_sessions")
+	}
+	st, err := os.Stat(local)
+	if err != nil {
+		return err
+	}
+	if st.IsDir() {
+		return fmt.Errorf("source_is_directory")
+	}
+	var res JobResult
+	GlobalMonitor.Reset(1, st.Size())
+	GlobalMonitor.SetPhase(PhaseTransferring)
+	err = AppendFile(ctx, sessions[0], local, remote, &res)
+	if err == nil {
+		GlobalMonitor.IncFileDone()
+	} else {
+		GlobalMonitor.IncFileFailed()
+	}
+	GlobalMonitor.SetPhase(PhaseIdle)
+	return err
+}
+
 func (e *Engine) UploadSpecificFile(ctx context.Context, sessions []*network.SftpSession, local, remote string) error {
-	if len(sessions) == 0 || sessions[0].SftpClient == nil {
+	if len(sessions) == 0 || !sessions[0].Ready() {
 		return fmt.Errorf("no_active_sessions")
 	}
 	st, err := os.Stat(local)
@@ -307,25 +1248,28 @@ func (e *Engine) UploadSpecificFile(ctx context.Context, sessions []*network.Sft
 	if st.IsDir() {
 		return fmt.Errorf("source_is_directory")
 	}
+	// The batch path pre-creates directories; give single files the same
+	// courtesy so "/new/dir/file.txt" just works.
+	if dir := path.Dir(remote); dir != "." && dir != "/" {
+		_ = sessions[0].MkdirAll(dir)
+	}
 	e.Queue.Add(&TransferJob{
 		LocalPath:  local,
 		RemotePath: remote,
 		Operation:  "UPLOAD",
 	})
 	GlobalMonitor.Reset(1, st.Size())
-	c := BatchSizeConservative
-	if e.Mode == ModeBoost {
-		c = BatchSizeBoost
-	}
-	NewWorkerPool(c, e.Queue).StartUnleash(ctx, sessions)
+	pool := e.newPool(e.concurrency())
+	pool.StartUnleash(ctx, sessions)
+	e.LastResults = pool.Results()
 	return nil
 }
 
 func (e *Engine) DownloadSpecificFile(ctx context.Context, sessions []*network.SftpSession, remote, local string) error {
-	if len(sessions) == 0 || sessions[0].SftpClient == nil {
+	if len(sessions) == 0 || !sessions[0].Ready() {
 		return fmt.Errorf("no_active_sessions")
 	}
-	st, err := sessions[0].SftpClient.Stat(remote)
+	st, err := sessions[0].Stat(remote)
 	if err != nil {
 		return err
 	}
@@ -342,10 +1286,8 @@ func (e *Engine) DownloadSpecificFile(ctx context.Context, sessions []*network.S
 		Operation:  "DOWNLOAD",
 	})
 	GlobalMonitor.Reset(1, st.Size())
-	c := BatchSizeConservative
-	if e.Mode == ModeBoost {
-		c = BatchSizeBoost
-	}
-	NewWorkerPool(c, e.Queue).StartUnleash(ctx, sessions)
+	pool := e.newPool(e.concurrency())
+	pool.StartUnleash(ctx, sessions)
+	e.LastResults = pool.Results()
 	return nil
 }
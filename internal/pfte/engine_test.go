@@ -0,0 +1,287 @@
+/*
+ * Copyright 2026 The FileRipper Team
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package pfte
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"fileripper/internal/core"
+	"fileripper/internal/network"
+)
+
+func TestRemoteRelPath(t *testing.T) {
+	cases := []struct {
+		base   string
+		target string
+		want   string
+	}{
+		{"/data", "/data/file.txt", "file.txt"},
+		{"/data", "/data/sub/file.txt", "sub/file.txt"},
+		{"/data", "/data", "."},
+		{".", "file.txt", "file.txt"},
+		{".", "sub/file.txt", "sub/file.txt"},
+		// Real-world media/document names: spaces, %, #, unicode, trailing dots
+		{"/data", "/data/my report (final).pdf", "my report (final).pdf"},
+		{"/data", "/data/100% done #2.txt", "100% done #2.txt"},
+		{"/data", "/data/résumé 日本語.doc", "résumé 日本語.doc"},
+		{"/data", "/data/archive.tar.", "archive.tar."},
+		{"/data", "/data/sub dir/it's \"quoted\".txt", "sub dir/it's \"quoted\".txt"},
+	}
+
+	for _, c := range cases {
+		got := remoteRelPath(c.base, c.target)
+		if got != c.want {
+			t.Errorf("remoteRelPath(%q, %q) = %q, want %q", c.base, c.target, got, c.want)
+		}
+	}
+}
+
+func TestCleanDest(t *testing.T) {
+	cases := []struct {
+		in      string
+		want    string
+		wantErr bool
+	}{
+		{"/srv", "/srv", false},
+		{"/srv/", "/srv", false},
+		{"srv//nested/", "srv/nested", false},
+		{".", ".", false},
+		{"", "", true},
+		{"   ", "", true},
+	}
+	for _, c := range cases {
+		got, err := cleanDest(c.in)
+		if c.wantErr {
+			if err == nil {
+				t.Errorf("cleanDest(%q): expected error, got %q", c.in, got)
+			}
+			continue
+		}
+		if err != nil || got != c.want {
+			t.Errorf("cleanDest(%q) = %q, %v; want %q", c.in, got, err, c.want)
+		}
+	}
+}
+
+func TestRemoteJoinPreservesSpecialNames(t *testing.T) {
+	// The upload path builds remote targets with path.Join; make sure odd
+	// but legal filenames survive the Clean it performs.
+	names := []string{
+		"file with spaces.txt",
+		"100%.log",
+		"notes #1.md",
+		"résumé.pdf",
+		"trailing.dot.",
+	}
+	for _, name := range names {
+		joined := path.Join("/dest", name)
+		if joined != "/dest/"+name {
+			t.Errorf("path.Join mangled %q into %q", name, joined)
+		}
+	}
+}
+
+func TestEnumerateUploadRelativeBase(t *testing.T) {
+	root := t.TempDir()
+	deep := filepath.Join(root, "b", "c", "d")
+	if err := os.MkdirAll(deep, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(deep, "f.txt"), []byte("x"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		base string
+		want string // expected remote path of f.txt
+	}{
+		{"", "/dest/d/f.txt"}, // default: parent of the source
+		{filepath.Join(root, "b"), "/dest/c/d/f.txt"},
+		{root, "/dest/b/c/d/f.txt"},
+		{deep, "/dest/f.txt"},
+	}
+	for _, c := range cases {
+		e := NewEngine()
+		e.RelativeBase = c.base
+		_, files, _, err := e.enumerateUpload(deep, "/dest")
+		if err != nil {
+			t.Errorf("base %q: %v", c.base, err)
+			continue
+		}
+		if len(files) != 1 || files[0].RemotePath != c.want {
+			t.Errorf("base %q: got %+v, want remote %q", c.base, files, c.want)
+		}
+	}
+
+	// A base that doesn't contain the source must be rejected.
+	e := NewEngine()
+	e.RelativeBase = t.TempDir()
+	if _, _, _, err := e.enumerateUpload(deep, "/dest"); err == nil {
+		t.Error("expected error for base outside the source tree")
+	}
+}
+
+func TestEnumerateUploadWarnsOnUnreadable(t *testing.T) {
+	src := t.TempDir()
+	writeTree(t, src, map[string]string{
+		"ok.txt": "fine",
+	})
+	if err := os.Symlink(filepath.Join(src, "gone"), filepath.Join(src, "dangling")); err != nil {
+		t.Fatal(err)
+	}
+	locked := filepath.Join(src, "locked")
+	if err := os.Mkdir(locked, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(locked, "secret.txt"), []byte("x"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	unreadable := os.Geteuid() != 0 // root reads through 0000 dirs
+	if unreadable {
+		if err := os.Chmod(locked, 0o000); err != nil {
+			t.Fatal(err)
+		}
+		defer os.Chmod(locked, 0o755)
+	}
+
+	engine := NewEngine()
+	_, files, _, err := engine.enumerateUpload(src, "/dest")
+	if err != nil {
+		t.Fatalf("enumerate: %v", err)
+	}
+	if len(files) == 0 {
+		t.Fatal("readable files should still be enumerated")
+	}
+	want := 1 // the dangling symlink
+	if unreadable {
+		want = 2
+	}
+	if len(engine.Warnings) != want {
+		t.Fatalf("Warnings = %v, want %d entries", engine.Warnings, want)
+	}
+	for _, w := range engine.Warnings {
+		if !strings.Contains(w, src) {
+			t.Errorf("warning %q does not name the offending path", w)
+		}
+	}
+
+	engine.StrictWalk = true
+	if _, _, _, err := engine.enumerateUpload(src, "/dest"); err == nil {
+		t.Fatal("strict mode should fail when the walk skipped paths")
+	}
+}
+
+func TestDownloadLayout(t *testing.T) {
+	cases := []struct {
+		target     string
+		wantSource string
+		wantRoot   string
+	}{
+		{"", ".", "root_dump"},
+		{".", ".", "root_dump"},
+		{"/", "/", "root_dump"},
+		{"./", ".", ""},
+		{"foo", "foo", "foo"},
+		{"foo/", "foo", ""},
+		{"a/b", "a/b", "b"},
+		{"a/b/", "a/b", ""},
+		{"a//b/.", "a/b", "b"},
+		{"/var/log", "/var/log", "log"},
+		{"/var/log/", "/var/log", ""},
+	}
+	for _, c := range cases {
+		source, root := downloadLayout(c.target)
+		if source != c.wantSource || root != c.wantRoot {
+			t.Errorf("downloadLayout(%q) = (%q, %q), want (%q, %q)",
+				c.target, source, root, c.wantSource, c.wantRoot)
+		}
+	}
+}
+
+func TestMisspelledSourceErrorsInsteadOfNoOp(t *testing.T) {
+	engine := NewEngine()
+	_, _, _, err := engine.enumerateUpload(filepath.Join(t.TempDir(), "no-such-dir"), "up")
+	if !errors.Is(err, core.ErrSourceNotFound) {
+		t.Errorf("upload with missing source: err = %v, want ErrSourceNotFound", err)
+	}
+}
+
+func TestMisspelledDownloadTargetErrors(t *testing.T) {
+	t.Chdir(t.TempDir())
+	f := newFakeFS()
+	f.addFile("data/real.txt", "x")
+
+	engine := NewEngine()
+	err := engine.StartTransfer(context.Background(),
+		[]*network.SftpSession{fakeSession(f)}, "DOWNLOAD", "dataa", "")
+	if !errors.Is(err, core.ErrSourceNotFound) {
+		t.Errorf("download with missing target: err = %v, want ErrSourceNotFound", err)
+	}
+
+	// The old fuzzy hunt is still there for those who ask for it.
+	engine.FuzzySearch = true
+	if err := engine.StartTransfer(context.Background(),
+		[]*network.SftpSession{fakeSession(f)}, "DOWNLOAD", "real.txt", ""); err != nil {
+		t.Errorf("fuzzy search opt-in should find real.txt: %v", err)
+	}
+}
+
+func TestConcurrencyOverridesMode(t *testing.T) {
+	e := NewEngine()
+	e.Mode = ModeConservative
+	if got := e.concurrency(); got != BatchSizeConservative {
+		t.Errorf("conservative = %d, want %d", got, BatchSizeConservative)
+	}
+	e.Mode = ModeBoost
+	if got := e.concurrency(); got != BatchSizeBoost {
+		t.Errorf("boost = %d, want %d", got, BatchSizeBoost)
+	}
+	e.Concurrency = 7
+	if got := e.concurrency(); got != 7 {
+		t.Errorf("explicit = %d, want 7", got)
+	}
+}
+
+func TestMatchGlobSupportsDoubleStar(t *testing.T) {
+	cases := []struct {
+		pattern, rel string
+		want         bool
+	}{
+		{"*.log", "debug.log", true},
+		{"*.log", "sub/debug.log", true}, // base-name match, old behavior
+		{"node_modules", "node_modules", true},
+		{"node_modules", "src/node_modules", true},
+		{"**/*.log", "a/b/c/debug.log", true},
+		{"**/*.log", "debug.log", true}, // ** spans zero segments too
+		{"**/*.log", "a/b/c/debug.txt", false},
+		{"node_modules/**", "node_modules/left-pad/index.js", true},
+		{"node_modules/**", "src/main.go", false},
+		{"src/**/testdata", "src/a/b/testdata", true},
+		{"src/**/testdata", "src/testdata", true},
+	}
+	for _, c := range cases {
+		if got := matchGlob(c.pattern, c.rel); got != c.want {
+			t.Errorf("matchGlob(%q, %q) = %v, want %v", c.pattern, c.rel, got, c.want)
+		}
+	}
+}
@@ -0,0 +1,1200 @@
+/*
+ * Copyright 2026 The FileRipper Team
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package pfte
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"fileripper/internal/core"
+
+	"fileripper/internal/network"
+
+	"github.com/kr/fs"
+)
+
+// fakeFS is an in-memory network.RemoteFS: just enough to run the engine
+// without a server. Paths are clean, slash-separated, rooted at ".".
+type fakeFS struct {
+	files map[string][]byte // path -> content
+	dirs  map[string]bool
+
+	// writeErr injects a failure for writes to a given path, letting tests
+	// exercise error handling (quota, flaky server) without a real one.
+	writeErr map[string]error
+
+	// failWrites makes the next N writes to a path fail, then succeed —
+	// the transient server-side lock in miniature.
+	failWrites map[string]int
+
+	// endless makes reads of a path drip data forever — a stand-in for the
+	// pathological file that never finishes.
+	endless map[string]bool
+
+	// slow throttles reads of a path to 1KB per millisecond, so tests can
+	// keep workers busy long enough to observe concurrent behavior.
+	slow map[string]bool
+
+	// down simulates total network loss while non-zero: opens and probes
+	// fail until a test flips it back. Accessed atomically.
+	down int32
+}
+
+func (f *fakeFS) setDown(down bool) {
+	v := int32(0)
+	if down {
+		v = 1
+	}
+	atomic.StoreInt32(&f.down, v)
+}
+
+func (f *fakeFS) isDown() bool { return atomic.LoadInt32(&f.down) == 1 }
+
+func newFakeFS() *fakeFS {
+	return &fakeFS{
+		files:      map[string][]byte{},
+		dirs:       map[string]bool{".": true},
+		writeErr:   map[string]error{},
+		failWrites: map[string]int{},
+		endless:    map[string]bool{},
+		slow:       map[string]bool{},
+	}
+}
+
+func (f *fakeFS) addFile(p string, content string) {
+	f.files[p] = []byte(content)
+	for d := path.Dir(p); d != "." && d != "/"; d = path.Dir(d) {
+		f.dirs[d] = true
+	}
+}
+
+type fakeInfo struct {
+	name  string
+	size  int64
+	isDir bool
+}
+
+func (i fakeInfo) Name() string { return i.name }
+func (i fakeInfo) Size() int64  { return i.size }
+func (i fakeInfo) Mode() os.FileMode {
+	mode := os.FileMode(0644)
+	if i.isDir {
+		mode = os.ModeDir | 0755
+	}
+	return mode
+}
+func (i fakeInfo) ModTime() time.Time { return time.Time{} }
+func (i fakeInfo) IsDir() bool        { return i.isDir }
+func (i fakeInfo) Sys() any           { return nil }
+
+func (f *fakeFS) Stat(p string) (os.FileInfo, error) {
+	p = path.Clean(p)
+	if data, ok := f.files[p]; ok {
+		return fakeInfo{name: path.Base(p), size: int64(len(data))}, nil
+	}
+	if f.dirs[p] {
+		return fakeInfo{name: path.Base(p), isDir: true}, nil
+	}
+	return nil, os.ErrNotExist
+}
+
+func (f *fakeFS) Lstat(p string) (os.FileInfo, error) { return f.Stat(p) }
+
+func (f *fakeFS) ReadDir(dir string) ([]os.FileInfo, error) {
+	dir = path.Clean(dir)
+	if !f.dirs[dir] {
+		return nil, os.ErrNotExist
+	}
+	var out []os.FileInfo
+	seen := map[string]bool{}
+	add := func(p string, isDir bool, size int64) {
+		if path.Dir(p) != dir || seen[p] {
+			return
+		}
+		seen[p] = true
+		out = append(out, fakeInfo{name: path.Base(p), size: size, isDir: isDir})
+	}
+	for p, data := range f.files {
+		add(p, false, int64(len(data)))
+	}
+	for p := range f.dirs {
+		add(p, true, 0)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Name() < out[j].Name() })
+	return out, nil
+}
+
+func (f *fakeFS) Join(elem ...string) string { return path.Join(elem...) }
+
+func (f *fakeFS) Walk(root string) *fs.Walker { return fs.WalkFS(root, f) }
+
+type fakeFile struct {
+	*bytes.Reader
+	fs   *fakeFS
+	path string
+	buf  bytes.Buffer
+}
+
+func (ff *fakeFile) Write(p []byte) (int, error) {
+	if err := ff.fs.writeErr[ff.path]; err != nil {
+		return 0, err
+	}
+	if n := ff.fs.failWrites[ff.path]; n > 0 {
+		ff.fs.failWrites[ff.path] = n - 1
+		return 0, errors.New("temporarily locked")
+	}
+	return ff.buf.Write(p)
+}
+func (ff *fakeFile) Close() error {
+	if ff.buf.Len() > 0 || ff.Reader == nil {
+		ff.fs.files[ff.path] = ff.buf.Bytes()
+	}
+	return nil
+}
+func (ff *fakeFile) Stat() (os.FileInfo, error) { return ff.fs.Stat(ff.path) }
+
+func (f *fakeFS) Open(p string) (network.RemoteFile, error) {
+	if f.isDown() {
+		return nil, fmt.Errorf("connection_lost")
+	}
+	data, ok := f.files[path.Clean(p)]
+	if !ok {
+		return nil, os.ErrNotExist
+	}
+	if f.endless[path.Clean(p)] {
+		return &endlessFile{fakeFile{fs: f, path: path.Clean(p)}}, nil
+	}
+	if f.slow[path.Clean(p)] {
+		return &slowFile{fakeFile{Reader: bytes.NewReader(data), fs: f, path: path.Clean(p)}}, nil
+	}
+	return &fakeFile{Reader: bytes.NewReader(data), fs: f, path: path.Clean(p)}, nil
+}
+
+// slowFile reads at most 1KB per call with a small delay: finite, but slow
+// enough that a pool stays busy for an observable while.
+type slowFile struct {
+	fakeFile
+}
+
+func (sf *slowFile) Read(p []byte) (int, error) {
+	time.Sleep(time.Millisecond)
+	if len(p) > 1024 {
+		p = p[:1024]
+	}
+	return sf.Reader.Read(p)
+}
+
+// endlessFile drips bytes forever, never reaching EOF.
+type endlessFile struct {
+	fakeFile
+}
+
+func (ef *endlessFile) Read(p []byte) (int, error) {
+	time.Sleep(2 * time.Millisecond)
+	n := len(p)
+	if n > 1024 {
+		n = 1024
+	}
+	return n, nil
+}
+
+func (f *fakeFS) Create(p string) (network.RemoteFile, error) {
+	return &fakeFile{fs: f, path: path.Clean(p)}, nil
+}
+
+func (f *fakeFS) OpenFile(p string, flags int) (network.RemoteFile, error) { return f.Open(p) }
+
+func (f *fakeFS) MkdirAll(p string) error {
+	for d := path.Clean(p); d != "." && d != "/"; d = path.Dir(d) {
+		f.dirs[d] = true
+	}
+	return nil
+}
+
+func (f *fakeFS) Rename(oldname, newname string) error {
+	data, ok := f.files[path.Clean(oldname)]
+	if !ok {
+		return os.ErrNotExist
+	}
+	delete(f.files, path.Clean(oldname))
+	f.files[path.Clean(newname)] = data
+	return nil
+}
+
+func (f *fakeFS) Remove(p string) error {
+	delete(f.files, path.Clean(p))
+	return nil
+}
+
+func (f *fakeFS) Chtimes(p string, atime, mtime time.Time) error { return nil }
+func (f *fakeFS) Chmod(p string, mode os.FileMode) error         { return nil }
+func (f *fakeFS) RealPath(p string) (string, error)              { return path.Clean(p), nil }
+func (f *fakeFS) ReadLink(p string) (string, error)              { return "", os.ErrInvalid }
+func (f *fakeFS) Getwd() (string, error) {
+	if f.isDown() {
+		return "", fmt.Errorf("connection_lost")
+	}
+	return "/home/test", nil
+}
+
+func fakeSession(f *fakeFS) *network.SftpSession {
+	return &network.SftpSession{Hostname: "fake", FS: f}
+}
+
+func TestBuildPlanAgainstFakeFS(t *testing.T) {
+	f := newFakeFS()
+	f.addFile("data/a.txt", "12345")
+	f.addFile("data/sub/b.txt", "1234567890")
+
+	engine := NewEngine()
+	plan, err := engine.BuildPlan(context.Background(), []*network.SftpSession{fakeSession(f)}, "DOWNLOAD", "data", "", true)
+	if err != nil {
+		t.Fatalf("BuildPlan: %v", err)
+	}
+	if plan.TotalFiles != 2 || plan.TotalBytes != 15 {
+		t.Errorf("plan = %d files / %d bytes, want 2 / 15", plan.TotalFiles, plan.TotalBytes)
+	}
+	if len(plan.Files) != 2 {
+		t.Errorf("expected 2 plan entries, got %v", plan.Files)
+	}
+}
+
+func TestStreamPlanEmitsNDJSON(t *testing.T) {
+	f := newFakeFS()
+	f.addFile("data/a.txt", "12345")
+	f.addFile("data/logs/noise.log", "xxxxx")
+	f.addFile("data/sub/b.txt", "1234567890")
+
+	engine := NewEngine()
+	engine.Excludes = []string{"*.log"}
+	var out bytes.Buffer
+	err := engine.StreamPlan(context.Background(), []*network.SftpSession{fakeSession(f)},
+		"DOWNLOAD", "data", "", &out)
+	if err != nil {
+		t.Fatalf("StreamPlan: %v", err)
+	}
+
+	counts := map[string]int{}
+	var skipped PlanRecord
+	for _, line := range strings.Split(strings.TrimSpace(out.String()), "\n") {
+		var rec PlanRecord
+		if err := json.Unmarshal([]byte(line), &rec); err != nil {
+			t.Fatalf("not valid NDJSON: %q: %v", line, err)
+		}
+		counts[rec.Type]++
+		if rec.Type == "skip" {
+			skipped = rec
+		}
+	}
+	if counts["file"] != 2 || counts["skip"] != 1 {
+		t.Errorf("records = %v, want 2 files and 1 skip", counts)
+	}
+	if skipped.Reason != "excluded by pattern" || !strings.HasSuffix(skipped.RemotePath, "noise.log") {
+		t.Errorf("skip record should name the file and reason, got %+v", skipped)
+	}
+}
+
+func TestEstimateAgainstFakeFS(t *testing.T) {
+	f := newFakeFS()
+	f.addFile("data/a.txt", "12345")
+	f.addFile("data/sub/b.txt", "1234567890")
+
+	engine := NewEngine()
+	sessions := []*network.SftpSession{fakeSession(f)}
+
+	// Enumeration only: counts but no ETA.
+	est, err := engine.Estimate(context.Background(), sessions, "DOWNLOAD", "data", "", false)
+	if err != nil {
+		t.Fatalf("Estimate: %v", err)
+	}
+	if est.TotalFiles != 2 || est.TotalBytes != 15 {
+		t.Errorf("estimate = %d files / %d bytes, want 2 / 15", est.TotalFiles, est.TotalBytes)
+	}
+	if est.ProbeBytesPerSec != 0 || est.ETA != 0 {
+		t.Errorf("no-probe estimate should not carry throughput, got %d B/s, ETA %v", est.ProbeBytesPerSec, est.ETA)
+	}
+
+	// With the probe: a throughput figure and an ETA derived from it.
+	before := len(f.files)
+	est, err = engine.Estimate(context.Background(), sessions, "DOWNLOAD", "data", "", true)
+	if err != nil {
+		t.Fatalf("Estimate with probe: %v", err)
+	}
+	if est.ProbeBytesPerSec <= 0 {
+		t.Errorf("probe should measure a positive rate, got %d", est.ProbeBytesPerSec)
+	}
+	if est.ETA <= 0 {
+		t.Errorf("probe estimate should include an ETA, got %v", est.ETA)
+	}
+	if len(f.files) != before {
+		t.Errorf("probe file was not cleaned up: %d files before, %d after", before, len(f.files))
+	}
+}
+
+func TestDownloadSpecificFileAgainstFakeFS(t *testing.T) {
+	t.Chdir(t.TempDir())
+	f := newFakeFS()
+	f.addFile("docs/readme.md", "# hello from the fake")
+
+	engine := NewEngine()
+	engine.Mode = ModeConservative
+	sessions := []*network.SftpSession{fakeSession(f)}
+
+	if err := engine.DownloadSpecificFile(context.Background(), sessions, "docs/readme.md", "out/readme.md"); err != nil {
+		t.Fatalf("download: %v", err)
+	}
+	got, err := os.ReadFile("out/readme.md")
+	if err != nil {
+		t.Fatalf("reading result: %v", err)
+	}
+	if !strings.Contains(string(got), "hello from the fake") {
+		t.Errorf("unexpected content: %q", got)
+	}
+}
+
+func TestUploadQuotaExceededStopsRetrying(t *testing.T) {
+	src := filepath.Join(t.TempDir(), "big.bin")
+	if err := os.WriteFile(src, []byte("some payload"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	f := newFakeFS()
+	// Uploads land at a temp sibling first, so that's where the quota bites.
+	f.writeErr["up/big.bin"+uploadTmpSuffix] = errors.New("sftp: \"Quota exceeded\" (SSH_FX_FAILURE)")
+
+	engine := NewEngine()
+	engine.Mode = ModeConservative
+	sessions := []*network.SftpSession{fakeSession(f)}
+
+	err := engine.UploadSpecificFile(context.Background(), sessions, src, "up/big.bin")
+	if err != nil {
+		t.Fatalf("UploadSpecificFile: %v", err)
+	}
+
+	if len(engine.LastResults) != 1 {
+		t.Fatalf("expected 1 result, got %d", len(engine.LastResults))
+	}
+	res := engine.LastResults[0].Result
+	if res.Err != core.ErrQuotaExceeded {
+		t.Errorf("expected ErrQuotaExceeded, got %v", res.Err)
+	}
+	if res.Attempts != 1 {
+		t.Errorf("quota failure was retried: %d attempts", res.Attempts)
+	}
+	if _, ok := f.files["up/big.bin"]; ok {
+		t.Errorf("partial file left behind after quota failure")
+	}
+	if _, ok := f.files["up/big.bin"+uploadTmpSuffix]; ok {
+		t.Errorf("temp file left behind after quota failure")
+	}
+}
+
+func TestIsQuotaErr(t *testing.T) {
+	cases := []struct {
+		err  error
+		want bool
+	}{
+		{errors.New("sftp: \"Quota exceeded\" (SSH_FX_FAILURE)"), true},
+		{errors.New("sftp: \"No space left on device\" (SSH_FX_FAILURE)"), true},
+		{errors.New("write /dest/f: no space left on device"), true},
+		{errors.New("sftp: \"Permission denied\" (SSH_FX_PERMISSION_DENIED)"), false},
+		{errors.New("connection reset by peer"), false},
+		{nil, false},
+	}
+	for _, c := range cases {
+		if got := isQuotaErr(c.err); got != c.want {
+			t.Errorf("isQuotaErr(%v) = %v, want %v", c.err, got, c.want)
+		}
+	}
+}
+
+func TestSkipSingleFileByPath(t *testing.T) {
+	t.Chdir(t.TempDir())
+	f := newFakeFS()
+	f.addFile("data/stuck.bin", "seed")
+	f.endless["data/stuck.bin"] = true
+
+	engine := NewEngine()
+	engine.Mode = ModeConservative
+	sessions := []*network.SftpSession{fakeSession(f)}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- engine.DownloadSpecificFile(context.Background(), sessions, "data/stuck.bin", "out/stuck.bin")
+	}()
+
+	// Wait until a worker picks the file up, then cancel just that file.
+	deadline := time.Now().Add(5 * time.Second)
+	for !CancelFile("data/stuck.bin") {
+		if time.Now().After(deadline) {
+			t.Fatal("file never became active")
+		}
+		time.Sleep(2 * time.Millisecond)
+	}
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("batch errored instead of continuing: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("batch did not finish after skipping the file")
+	}
+
+	skipped := GlobalMonitor.UserSkippedFiles()
+	if len(skipped) != 1 || skipped[0] != "data/stuck.bin" {
+		t.Errorf("skipped list = %v, want the cancelled file", skipped)
+	}
+}
+
+func TestCompareReportsDiffPerFile(t *testing.T) {
+	local := t.TempDir()
+	writeLocal := func(rel, content string) {
+		full := filepath.Join(local, filepath.FromSlash(rel))
+		if err := os.MkdirAll(filepath.Dir(full), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(full, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	writeLocal("same.txt", "identical bytes")
+	writeLocal("changed.txt", "local version!")
+	writeLocal("only-local.txt", "not uploaded yet")
+
+	f := newFakeFS()
+	f.addFile("backup/same.txt", "identical bytes")
+	f.addFile("backup/changed.txt", "remote version")
+	f.addFile("backup/only-remote.txt", "deleted locally")
+
+	engine := NewEngine()
+	sessions := []*network.SftpSession{fakeSession(f)}
+
+	report, err := engine.Compare(context.Background(), sessions, local, "backup", true)
+	if err != nil {
+		t.Fatalf("Compare: %v", err)
+	}
+
+	if report.InSync() {
+		t.Error("trees differ but report says in sync")
+	}
+	states := map[string]string{}
+	for _, e := range report.Entries {
+		states[e.Path] = e.State
+	}
+	want := map[string]string{
+		"same.txt":        "identical",
+		"changed.txt":     "modified",
+		"only-local.txt":  "missing_remote",
+		"only-remote.txt": "missing_local",
+	}
+	for path, state := range want {
+		if states[path] != state {
+			t.Errorf("%s: got %q, want %q", path, states[path], state)
+		}
+	}
+	if report.Identical != 1 || report.Modified != 1 || report.MissingLocal != 1 || report.MissingRemote != 1 {
+		t.Errorf("counts off: %+v", report)
+	}
+}
+
+func TestFailedDownloadLeavesNoTruncatedFile(t *testing.T) {
+	t.Chdir(t.TempDir())
+	f := newFakeFS()
+	f.addFile("data/wedge.bin", "seed")
+	f.endless["data/wedge.bin"] = true
+
+	engine := NewEngine()
+	engine.Mode = ModeConservative
+	engine.FileTimeout = 50 * time.Millisecond
+
+	sessions := []*network.SftpSession{fakeSession(f)}
+	if err := engine.DownloadSpecificFile(context.Background(), sessions, "data/wedge.bin", "out/wedge.bin"); err != nil {
+		t.Fatalf("download: %v", err)
+	}
+
+	if _, err := os.Stat("out/wedge.bin"); !os.IsNotExist(err) {
+		t.Errorf("truncated file left at the real name (stat err = %v)", err)
+	}
+
+	// With KeepPartials, the bytes survive under an unmistakable name.
+	engine.KeepPartials = true
+	if err := engine.DownloadSpecificFile(context.Background(), sessions, "data/wedge.bin", "out/wedge.bin"); err != nil {
+		t.Fatalf("download: %v", err)
+	}
+	if _, err := os.Stat("out/wedge.bin"); !os.IsNotExist(err) {
+		t.Errorf("truncated file left at the real name (stat err = %v)", err)
+	}
+	if _, err := os.Stat("out/wedge.bin.part"); err != nil {
+		t.Errorf("expected .part file: %v", err)
+	}
+}
+
+func TestScaleWorkersMidTransfer(t *testing.T) {
+	if ScaleWorkers(4) {
+		t.Fatal("no transfer is running; ScaleWorkers should report false")
+	}
+
+	t.Chdir(t.TempDir())
+	f := newFakeFS()
+	const jobs = 6
+	queue := NewQueue()
+	for i := 0; i < jobs; i++ {
+		name := fmt.Sprintf("slow-%d.bin", i)
+		f.addFile(name, "x")
+		f.endless[name] = true
+		queue.Add(&TransferJob{LocalPath: name, RemotePath: name, Operation: "DOWNLOAD"})
+	}
+
+	wp := NewWorkerPool(1, queue)
+	wp.FileTimeout = 150 * time.Millisecond // endless files only end by deadline
+
+	done := make(chan struct{})
+	go func() {
+		wp.StartUnleash(context.Background(), []*network.SftpSession{fakeSession(f)})
+		close(done)
+	}()
+
+	// The pool registers itself once running; then the resize must land.
+	deadline := time.After(5 * time.Second)
+	for !ScaleWorkers(3) {
+		select {
+		case <-deadline:
+			t.Fatal("pool never became scalable")
+		case <-time.After(time.Millisecond):
+		}
+	}
+
+	<-done
+	if got := len(wp.Results()); got != jobs {
+		t.Errorf("pool completed %d jobs, want %d", got, jobs)
+	}
+	if ScaleWorkers(1) {
+		t.Error("pool drained; ScaleWorkers should report false again")
+	}
+}
+
+func TestDownloadRange(t *testing.T) {
+	f := newFakeFS()
+	f.addFile("big.log", "0123456789abcdefghij")
+	sessions := []*network.SftpSession{fakeSession(f)}
+	engine := NewEngine()
+
+	cases := []struct {
+		start, end int64
+		want       string
+	}{
+		{0, 5, "01234"},
+		{5, 10, "56789"},
+		{10, 0, "abcdefghij"}, // open end = through EOF
+		{18, 99, "ij"},        // end clamped to the file size
+	}
+	for _, c := range cases {
+		var buf bytes.Buffer
+		if err := engine.DownloadRange(context.Background(), sessions, "big.log", c.start, c.end, &buf); err != nil {
+			t.Fatalf("range [%d, %d): %v", c.start, c.end, err)
+		}
+		if buf.String() != c.want {
+			t.Errorf("range [%d, %d) = %q, want %q", c.start, c.end, buf.String(), c.want)
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := engine.DownloadRange(context.Background(), sessions, "big.log", 5, 5, &buf); err == nil {
+		t.Error("empty range should be rejected")
+	}
+	if err := engine.DownloadRange(context.Background(), sessions, "big.log", 99, 0, &buf); err == nil {
+		t.Error("start past EOF should be rejected")
+	}
+	if err := engine.DownloadRange(context.Background(), sessions, "big.log", -1, 0, &buf); err == nil {
+		t.Error("negative start should be rejected")
+	}
+}
+
+func TestRemoteManifestHashesWithoutWriting(t *testing.T) {
+	f := newFakeFS()
+	f.addFile("tree/a.txt", "hello")
+	f.addFile("tree/sub/b.txt", "world")
+	sessions := []*network.SftpSession{fakeSession(f)}
+	engine := NewEngine()
+	engine.Mode = ModeConservative
+
+	manifest, err := engine.RemoteManifest(context.Background(), sessions, "tree", AlgoCRC32)
+	if err != nil {
+		t.Fatalf("manifest: %v", err)
+	}
+	if len(manifest) != 2 {
+		t.Fatalf("manifest = %v, want 2 entries", manifest)
+	}
+	// Digests must agree with the local checksummer so Compare-style
+	// verification can use either side.
+	local := filepath.Join(t.TempDir(), "a.txt")
+	if err := os.WriteFile(local, []byte("hello"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	want, err := CalculateChecksum(local)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if manifest["a.txt"] != want {
+		t.Errorf("a.txt digest = %q, want %q (same as local CRC32)", manifest["a.txt"], want)
+	}
+
+	// SHA256 manifests are verifiable with standard tools.
+	manifest, err = engine.RemoteManifest(context.Background(), sessions, "tree", AlgoSHA256)
+	if err != nil {
+		t.Fatal(err)
+	}
+	const sha256hello = "2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824"
+	if manifest["a.txt"] != sha256hello {
+		t.Errorf("sha256 digest = %q, want %q", manifest["a.txt"], sha256hello)
+	}
+
+	if _, err := engine.RemoteManifest(context.Background(), sessions, "tree", "sha1"); err == nil {
+		t.Error("unknown algorithm should be rejected")
+	}
+}
+
+func TestFailedJobRetriesOnAlternateSession(t *testing.T) {
+	t.Chdir(t.TempDir())
+
+	good := newFakeFS()
+	bad := newFakeFS() // has none of the files: every open fails
+	const jobs = 8
+	queue := NewQueue()
+	for i := 0; i < jobs; i++ {
+		name := fmt.Sprintf("file-%d.txt", i)
+		good.addFile(name, strings.Repeat("payload ", 4096))
+		good.slow[name] = true // keep the pool busy so both workers get pops
+		queue.Add(&TransferJob{LocalPath: name, RemotePath: name, Operation: "DOWNLOAD"})
+	}
+
+	sessions := []*network.SftpSession{
+		{Hostname: "bad", FS: bad},
+		{Hostname: "good", FS: good},
+	}
+	wp := NewWorkerPool(2, queue)
+	wp.StartUnleash(context.Background(), sessions)
+
+	results := wp.Results()
+	if len(results) != jobs {
+		t.Fatalf("completed %d jobs, want %d", len(results), jobs)
+	}
+	sawFailover := false
+	for _, job := range results {
+		if job.Result.Err != nil {
+			t.Errorf("%s failed despite a healthy session: %v", job.RemotePath, job.Result.Err)
+		}
+		if job.Result.Session != "good" {
+			t.Errorf("%s finished on %q, want the healthy session", job.RemotePath, job.Result.Session)
+		}
+		if job.triedCount() > 0 {
+			sawFailover = true
+		}
+	}
+	if !sawFailover {
+		t.Error("no job ever failed over; the degraded session was never exercised")
+	}
+}
+
+// runCollisionBatch downloads `jobs` distinct remote files that all map to
+// the same local name, under the given policy, and returns the pool results.
+func runCollisionBatch(t *testing.T, jobs int, policy CollisionPolicy) []*TransferJob {
+	t.Helper()
+	SetCollisionPolicy(policy)
+	t.Cleanup(func() { SetCollisionPolicy(CollisionOverwrite) })
+
+	f := newFakeFS()
+	queue := NewQueue()
+	for i := 0; i < jobs; i++ {
+		name := fmt.Sprintf("src-%02d.bin", i)
+		f.addFile(name, fmt.Sprintf("payload of %s repeated|", name))
+		f.slow[name] = true // keep workers overlapping on purpose
+		queue.Add(&TransferJob{LocalPath: "same.bin", RemotePath: name, Operation: "DOWNLOAD"})
+	}
+
+	wp := NewWorkerPool(4, queue)
+	wp.StartUnleash(context.Background(), []*network.SftpSession{fakeSession(f)})
+	results := wp.Results()
+	if len(results) != jobs {
+		t.Fatalf("pool completed %d jobs, want %d", len(results), jobs)
+	}
+	return results
+}
+
+func TestCollidingDownloadsRenameDeterministically(t *testing.T) {
+	t.Chdir(t.TempDir())
+	const jobs = 12
+	results := runCollisionBatch(t, jobs, CollisionRename)
+
+	// Every job must have landed somewhere, all 12 names distinct, and each
+	// file must hold exactly one source's bytes — no interleaving, ever.
+	seen := map[string]bool{}
+	for _, job := range results {
+		if job.Result.Err != nil {
+			t.Fatalf("job %s failed: %v", job.RemotePath, job.Result.Err)
+		}
+		if job.Result.FinalPath == "" {
+			t.Fatalf("job %s recorded no final path", job.RemotePath)
+		}
+		if seen[job.Result.FinalPath] {
+			t.Fatalf("two jobs landed at %s", job.Result.FinalPath)
+		}
+		seen[job.Result.FinalPath] = true
+
+		got, err := os.ReadFile(job.Result.FinalPath)
+		if err != nil {
+			t.Fatalf("reading %s: %v", job.Result.FinalPath, err)
+		}
+		want := fmt.Sprintf("payload of %s repeated|", job.RemotePath)
+		if string(got) != want {
+			t.Errorf("%s holds corrupt bytes: %q", job.Result.FinalPath, got)
+		}
+	}
+	if !seen["same.bin"] {
+		t.Error("the first writer should keep the plain name")
+	}
+}
+
+func TestCollidingDownloadsErrorAndSkipPolicies(t *testing.T) {
+	t.Chdir(t.TempDir())
+	results := runCollisionBatch(t, 6, CollisionError)
+	failed := 0
+	winner := ""
+	for _, job := range results {
+		if job.Result.Err != nil {
+			failed++
+		} else {
+			winner = job.RemotePath
+		}
+	}
+	if failed != 5 {
+		t.Errorf("error policy: %d jobs failed, want 5 of 6", failed)
+	}
+
+	// The whole point of the policy: the first writer's file survives the
+	// losers' failure handling intact.
+	survivor, err := os.ReadFile("same.bin")
+	if err != nil {
+		t.Fatalf("error policy: the winner's file should survive: %v", err)
+	}
+	if want := fmt.Sprintf("payload of %s repeated|", winner); winner != "" && string(survivor) != want {
+		t.Errorf("error policy: same.bin holds %q, want the winner's %q", survivor, want)
+	}
+	if entries, err := os.ReadDir("."); err != nil || len(entries) != 1 {
+		t.Errorf("error policy: losers should leave no debris, got %v (err %v)", entries, err)
+	}
+
+	t.Chdir(t.TempDir())
+	results = runCollisionBatch(t, 6, CollisionSkip)
+	for _, job := range results {
+		if job.Result.Err != nil {
+			t.Errorf("skip policy: job %s failed: %v", job.RemotePath, job.Result.Err)
+		}
+	}
+	entries, err := os.ReadDir(".")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].Name() != "same.bin" {
+		t.Errorf("skip policy should leave exactly same.bin, got %v", entries)
+	}
+	survivor, err = os.ReadFile("same.bin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	intact := false
+	for _, job := range results {
+		if string(survivor) == fmt.Sprintf("payload of %s repeated|", job.RemotePath) {
+			intact = true
+		}
+	}
+	if !intact {
+		t.Errorf("skip policy: same.bin holds corrupt bytes: %q", survivor)
+	}
+}
+
+func TestFileCountersAddUp(t *testing.T) {
+	t.Chdir(t.TempDir())
+	f := newFakeFS()
+	queue := NewQueue()
+
+	// Three clean downloads, two that fail (no such remote file), and one
+	// endless one the user will cancel: 3 + 2 + 1 must equal 6 at the end.
+	for i := 0; i < 3; i++ {
+		name := fmt.Sprintf("ok-%d.bin", i)
+		f.addFile(name, "content")
+		queue.Add(&TransferJob{LocalPath: name, RemotePath: name, Operation: "DOWNLOAD"})
+	}
+	for i := 0; i < 2; i++ {
+		name := fmt.Sprintf("missing-%d.bin", i)
+		queue.Add(&TransferJob{LocalPath: name, RemotePath: name, Operation: "DOWNLOAD"})
+	}
+	f.addFile("endless.bin", "x")
+	f.endless["endless.bin"] = true
+	queue.Add(&TransferJob{LocalPath: "endless.bin", RemotePath: "endless.bin", Operation: "DOWNLOAD"})
+
+	GlobalMonitor.Reset(6, 0)
+	wp := NewWorkerPool(2, queue)
+
+	done := make(chan struct{})
+	go func() {
+		wp.StartUnleash(context.Background(), []*network.SftpSession{fakeSession(f)})
+		close(done)
+	}()
+
+	// Cancel the endless file once a worker picks it up.
+	deadline := time.After(5 * time.Second)
+	for !CancelFile("endless.bin") {
+		select {
+		case <-deadline:
+			t.Fatal("endless.bin never became cancelable")
+		case <-time.After(time.Millisecond):
+		}
+	}
+	<-done
+
+	stats := GlobalMonitor.GetStats()
+	if stats.FilesDone != 3 {
+		t.Errorf("FilesDone = %d, want 3", stats.FilesDone)
+	}
+	if stats.FilesFailed != 2 {
+		t.Errorf("FilesFailed = %d, want 2", stats.FilesFailed)
+	}
+	if skipped := int64(len(stats.SkippedByUser)); skipped != 1 {
+		t.Errorf("SkippedByUser = %d, want 1", skipped)
+	}
+	if sum := stats.FilesDone + stats.FilesFailed + int64(len(stats.SkippedByUser)); sum != stats.TotalFiles {
+		t.Errorf("done+failed+skipped = %d, want TotalFiles = %d", sum, stats.TotalFiles)
+	}
+}
+
+func TestQuotaStopFinalizesQueuedTail(t *testing.T) {
+	t.Chdir(t.TempDir())
+	f := newFakeFS()
+	queue := NewQueue()
+
+	// One upload that trips the quota, then a tail of jobs the pool will
+	// never attempt: every one must still be finalized as failed.
+	const tail = 4
+	src := filepath.Join(t.TempDir(), "src.bin")
+	if err := os.WriteFile(src, []byte("data"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	f.writeErr["full.bin"] = fmt.Errorf("sftp: \"quota exceeded\" (SSH_FX_FAILURE)")
+
+	queue.Add(&TransferJob{LocalPath: src, RemotePath: "full.bin", Operation: "UPLOAD"})
+	for i := 0; i < tail; i++ {
+		name := fmt.Sprintf("tail-%d.bin", i)
+		f.addFile(name, "content")
+		queue.Add(&TransferJob{LocalPath: name, RemotePath: name, Operation: "DOWNLOAD"})
+	}
+
+	GlobalMonitor.Reset(int64(1+tail), 0)
+	wp := NewWorkerPool(1, queue)
+	wp.StartUnleash(context.Background(), []*network.SftpSession{fakeSession(f)})
+
+	if got := len(wp.Results()); got != 1+tail {
+		t.Fatalf("results cover %d jobs, want %d", got, 1+tail)
+	}
+	stats := GlobalMonitor.GetStats()
+	if sum := stats.FilesDone + stats.FilesFailed; sum != stats.TotalFiles {
+		t.Errorf("done+failed = %d, want TotalFiles = %d", sum, stats.TotalFiles)
+	}
+}
+
+func TestPauseOnDisconnectResumesBatch(t *testing.T) {
+	t.Chdir(t.TempDir())
+	f := newFakeFS()
+	queue := NewQueue()
+	const jobs = 5
+	for i := 0; i < jobs; i++ {
+		name := fmt.Sprintf("file-%d.bin", i)
+		f.addFile(name, "survives the outage")
+		queue.Add(&TransferJob{LocalPath: name, RemotePath: name, Operation: "DOWNLOAD"})
+	}
+
+	// The network is already gone when the pool starts; every open fails
+	// until the test brings it back.
+	f.setDown(true)
+
+	GlobalMonitor.Reset(jobs, 0)
+	wp := NewWorkerPool(2, queue)
+	wp.PauseOnDisconnect = true
+	wp.ProbeInterval = 10 * time.Millisecond
+
+	done := make(chan struct{})
+	go func() {
+		wp.StartUnleash(context.Background(), []*network.SftpSession{fakeSession(f)})
+		close(done)
+	}()
+
+	// The pool must report the pause, not a failure cascade.
+	deadline := time.After(5 * time.Second)
+	for GlobalMonitor.GetStats().Phase != "paused" {
+		select {
+		case <-deadline:
+			t.Fatal("pool never entered the paused phase")
+		case <-time.After(time.Millisecond):
+		}
+	}
+
+	f.setDown(false) // the wifi comes back
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("pool never resumed after connectivity returned")
+	}
+
+	stats := GlobalMonitor.GetStats()
+	if stats.FilesDone != jobs {
+		t.Errorf("FilesDone = %d, want %d — the outage should not cost any file", stats.FilesDone, jobs)
+	}
+	if stats.FilesFailed != 0 {
+		t.Errorf("FilesFailed = %d, want 0", stats.FilesFailed)
+	}
+}
+
+func TestPauseOnDisconnectDeadlineGivesUp(t *testing.T) {
+	t.Chdir(t.TempDir())
+	f := newFakeFS()
+	queue := NewQueue()
+	f.addFile("a.bin", "x")
+	queue.Add(&TransferJob{LocalPath: "a.bin", RemotePath: "a.bin", Operation: "DOWNLOAD"})
+	f.setDown(true)
+
+	GlobalMonitor.Reset(1, 0)
+	wp := NewWorkerPool(1, queue)
+	wp.PauseOnDisconnect = true
+	wp.ProbeInterval = 5 * time.Millisecond
+	wp.PauseDeadline = 30 * time.Millisecond
+
+	start := time.Now()
+	wp.StartUnleash(context.Background(), []*network.SftpSession{fakeSession(f)})
+
+	if elapsed := time.Since(start); elapsed > 3*time.Second {
+		t.Errorf("pool took %v to give up; the deadline should cap the pause", elapsed)
+	}
+	if stats := GlobalMonitor.GetStats(); stats.FilesFailed != 1 {
+		t.Errorf("FilesFailed = %d, want 1 after the deadline expired", stats.FilesFailed)
+	}
+}
+
+func TestFailuresNameTheCasualties(t *testing.T) {
+	src := t.TempDir()
+	for _, name := range []string{"ok.txt", "doomed.txt"} {
+		if err := os.WriteFile(filepath.Join(src, name), []byte("x"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	f := newFakeFS()
+	f.writeErr["up/doomed.txt"+uploadTmpSuffix] = errors.New("permission denied")
+
+	engine := NewEngine()
+	engine.Mode = ModeConservative
+	engine.ContentsOnly = true
+	sessions := []*network.SftpSession{fakeSession(f)}
+	if err := engine.StartTransfer(context.Background(), sessions, "UPLOAD", src, "up"); err != nil {
+		t.Fatalf("upload: %v", err)
+	}
+
+	failures := engine.Failures()
+	if len(failures) != 1 {
+		t.Fatalf("failures = %d, want 1", len(failures))
+	}
+	if failures[0].Path != "up/doomed.txt" {
+		t.Errorf("failed path = %s, want up/doomed.txt", failures[0].Path)
+	}
+	if failures[0].Err == nil || !strings.Contains(failures[0].Err.Error(), "permission denied") {
+		t.Errorf("failure err = %v, want the underlying cause", failures[0].Err)
+	}
+	if _, ok := f.files["up/ok.txt"]; !ok {
+		t.Error("the healthy file should still have been uploaded")
+	}
+}
+
+func TestRetryRoundsRecoverTransientFailures(t *testing.T) {
+	src := filepath.Join(t.TempDir(), "locked.txt")
+	if err := os.WriteFile(src, []byte("eventually lands"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	f := newFakeFS()
+	// Three failures exhaust the inline attempts; the end-of-batch round
+	// hits a healthy path.
+	f.failWrites["up/locked.txt"+uploadTmpSuffix] = 3
+
+	engine := NewEngine()
+	engine.Mode = ModeConservative
+	engine.MaxRetryRounds = 1
+	sessions := []*network.SftpSession{fakeSession(f)}
+	if err := engine.UploadSpecificFile(context.Background(), sessions, src, "up/locked.txt"); err != nil {
+		t.Fatalf("upload: %v", err)
+	}
+
+	if failures := engine.Failures(); len(failures) != 0 {
+		t.Fatalf("failures = %v, want none after the retry round", failures)
+	}
+	if got := string(f.files["up/locked.txt"]); got != "eventually lands" {
+		t.Errorf("remote content = %q", got)
+	}
+
+	// Without rounds the same scenario stays failed.
+	f2 := newFakeFS()
+	f2.failWrites["up/locked.txt"+uploadTmpSuffix] = 3
+	engine2 := NewEngine()
+	engine2.Mode = ModeConservative
+	if err := engine2.UploadSpecificFile(context.Background(), []*network.SftpSession{fakeSession(f2)}, src, "up/locked.txt"); err != nil {
+		t.Fatalf("upload: %v", err)
+	}
+	if failures := engine2.Failures(); len(failures) != 1 {
+		t.Errorf("failures = %d, want 1 with no retry rounds", len(failures))
+	}
+}
+
+func TestTransferBetweenStreamsServerToServer(t *testing.T) {
+	t.Chdir(t.TempDir()) // prove nothing gets staged locally
+
+	srcFS := newFakeFS()
+	srcFS.addFile("share/a.txt", "alpha")
+	srcFS.addFile("share/sub/b.txt", "bravo")
+	dstFS := newFakeFS()
+
+	engine := NewEngine()
+	engine.Mode = ModeConservative
+	err := engine.TransferBetween(context.Background(), fakeSession(srcFS), fakeSession(dstFS), "share", "mirror")
+	if err != nil {
+		t.Fatalf("transfer between: %v", err)
+	}
+
+	if got := string(dstFS.files["mirror/a.txt"]); got != "alpha" {
+		t.Errorf("mirror/a.txt = %q", got)
+	}
+	if got := string(dstFS.files["mirror/sub/b.txt"]); got != "bravo" {
+		t.Errorf("mirror/sub/b.txt = %q", got)
+	}
+	if failures := engine.Failures(); len(failures) != 0 {
+		t.Errorf("failures = %v", failures)
+	}
+
+	// The whole point of the operation: no local staging, not even a dump/.
+	entries, err := os.ReadDir(".")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 0 {
+		t.Errorf("local directory is not empty after a server-to-server copy: %v", entries)
+	}
+}
+
+func TestUploadHonorsExcludeAndIncludeGlobs(t *testing.T) {
+	root := t.TempDir()
+	for rel, content := range map[string]string{
+		"src/main.go":                "package main",
+		"src/main_test.go":           "package main",
+		"src/debug.log":              "noise",
+		"node_modules/pkg/index.js":  "junk",
+		"node_modules/pkg/README.md": "junk",
+	} {
+		full := filepath.Join(root, filepath.FromSlash(rel))
+		if err := os.MkdirAll(filepath.Dir(full), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(full, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	f := newFakeFS()
+	engine := NewEngine()
+	engine.Mode = ModeConservative
+	engine.Excludes = []string{"node_modules"}
+	engine.Includes = []string{"**/*.go"}
+	sessions := []*network.SftpSession{fakeSession(f)}
+	if err := engine.StartTransfer(context.Background(), sessions, "UPLOAD", root+"/", "up"); err != nil {
+		t.Fatalf("upload: %v", err)
+	}
+
+	for _, want := range []string{"up/src/main.go", "up/src/main_test.go"} {
+		if _, ok := f.files[want]; !ok {
+			t.Errorf("%s missing; remote files: %v", want, f.files)
+		}
+	}
+	for p := range f.files {
+		if strings.Contains(p, "node_modules") || strings.HasSuffix(p, ".log") {
+			t.Errorf("filtered file made it to the server: %s", p)
+		}
+	}
+}
+
+func TestDryRunReportsWithoutMovingBytes(t *testing.T) {
+	root := t.TempDir()
+	for rel, content := range map[string]string{
+		"docs/a.txt":     "12345",
+		"docs/sub/b.txt": "1234567890",
+	} {
+		full := filepath.Join(root, filepath.FromSlash(rel))
+		if err := os.MkdirAll(filepath.Dir(full), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(full, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	f := newFakeFS()
+	engine := NewEngine()
+	engine.Mode = ModeConservative
+	engine.DryRun = true
+	sessions := []*network.SftpSession{fakeSession(f)}
+	if err := engine.StartTransfer(context.Background(), sessions, "UPLOAD", root+"/", "up"); err != nil {
+		t.Fatalf("dry run: %v", err)
+	}
+
+	plan := engine.LastPlan
+	if plan == nil {
+		t.Fatal("dry run left no plan behind")
+	}
+	if plan.TotalFiles != 2 || plan.TotalBytes != 15 {
+		t.Errorf("plan = %d files / %d bytes, want 2 / 15", plan.TotalFiles, plan.TotalBytes)
+	}
+	if len(plan.Files) != 2 {
+		t.Errorf("plan files = %v, want both entries listed", plan.Files)
+	}
+
+	// The whole point: nothing moved, nothing was created.
+	if len(f.files) != 0 {
+		t.Errorf("dry run wrote files: %v", f.files)
+	}
+	for d := range f.dirs {
+		if d != "." {
+			t.Errorf("dry run created directory %s", d)
+		}
+	}
+}
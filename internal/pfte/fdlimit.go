@@ -0,0 +1,66 @@
+/*
+ * Copyright 2026 The FileRipper Team
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package pfte
+
+import "context"
+
+// GlobalFDLimit bounds how many file operations hold descriptors open at
+// once. 128 boost workers plus 16 multipart chunks each opening local and
+// remote handles can blow through a default ulimit and produce "too many
+// open files" errors that look like random transfer failures.
+var GlobalFDLimit = newFDLimiter(defaultOpenFileLimit())
+
+// SetOpenFileLimit replaces the global limiter. Call it before starting a
+// transfer; n <= 0 restores the rlimit-derived default.
+func SetOpenFileLimit(n int) {
+	if n <= 0 {
+		n = defaultOpenFileLimit()
+	}
+	GlobalFDLimit = newFDLimiter(n)
+}
+
+type fdLimiter struct {
+	sem chan struct{}
+}
+
+func newFDLimiter(n int) *fdLimiter {
+	return &fdLimiter{sem: make(chan struct{}, n)}
+}
+
+// acquire takes a slot, flagging the monitor as throttled while it has to
+// wait, so the user sees "fd limit reached" instead of a mystery stall.
+func (l *fdLimiter) acquire(ctx context.Context) error {
+	select {
+	case l.sem <- struct{}{}:
+		return nil
+	default:
+	}
+
+	GlobalMonitor.SetFdThrottled(true)
+	defer GlobalMonitor.SetFdThrottled(false)
+
+	select {
+	case l.sem <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (l *fdLimiter) release() {
+	<-l.sem
+}
@@ -0,0 +1,37 @@
+//go:build !windows
+
+/*
+ * Copyright 2026 The FileRipper Team
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package pfte
+
+import "syscall"
+
+// defaultOpenFileLimit leaves half the process's soft NOFILE limit for
+// everything else (sockets, logs, the SSH tunnels themselves).
+func defaultOpenFileLimit() int {
+	var rl syscall.Rlimit
+	if err := syscall.Getrlimit(syscall.RLIMIT_NOFILE, &rl); err == nil {
+		n := int(rl.Cur) / 2
+		if n > 4096 {
+			n = 4096
+		}
+		if n >= 8 {
+			return n
+		}
+	}
+	return 256
+}
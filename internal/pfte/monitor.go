@@ -25,6 +25,40 @@ import (
 // Global instance to be accessed by API and Engine
 var GlobalMonitor *TransferMonitor
 
+// RecentFilesKept is how many recently started files the monitor remembers.
+// With 128 workers "current file" is meaningless; a short rolling list at
+// least shows what's moving.
+const RecentFilesKept = 5
+
+// Phase tells the user what the engine is busy with, beyond raw percentages.
+type Phase int
+
+const (
+	PhaseIdle Phase = iota
+	PhaseEnumerating
+	PhaseCreatingDirs
+	PhaseTransferring
+	PhaseVerifying
+	PhasePaused
+)
+
+func (p Phase) String() string {
+	switch p {
+	case PhaseEnumerating:
+		return "enumerating"
+	case PhaseCreatingDirs:
+		return "creating dirs"
+	case PhaseTransferring:
+		return "transferring"
+	case PhaseVerifying:
+		return "verifying"
+	case PhasePaused:
+		return "paused"
+	default:
+		return "idle"
+	}
+}
+
 func init() {
 	GlobalMonitor = NewMonitor()
 }
@@ -38,6 +72,17 @@ type TransferStats struct {
 	SpeedMBs        float64 `json:"speed_mb_s"`
 	CurrentFile     string  `json:"current_file"` // Last file started
 	IsRunning       bool    `json:"is_running"`
+
+	Phase       string   `json:"phase"`
+	RecentFiles []string `json:"recent_files"` // most recently started, newest last
+
+	TotalRetries int64 `json:"total_retries"` // failed attempts across all files
+	FdThrottled  bool  `json:"fd_throttled"`  // workers waiting on the open-file limit
+
+	SkippedByUser []string `json:"skipped_by_user,omitempty"` // files cancelled individually
+	SkippedFiles  int64    `json:"skipped_files"`             // already up to date, not transferred
+	FilesFailed   int64    `json:"files_failed"`              // jobs that ended in a final error
+	PendingRetry  int64    `json:"pending_retry"`             // parked for the end-of-batch retry pass
 }
 
 type TransferMonitor struct {
@@ -46,9 +91,20 @@ type TransferMonitor struct {
 	totalBytes int64
 	bytesDone  int64 // Atomic
 
-	currentFile string
-	mu          sync.Mutex // Protects string and bools
-	isRunning   bool
+	filesFailed int64 // Atomic
+
+	pendingRetry int64 // Atomic: jobs parked for the end-of-batch retry pass
+
+	currentFile  string
+	recentFiles  []string
+	phase        Phase
+	retried      map[string]int    // path -> failed attempts
+	mismatches   map[string]string // path -> mismatch action taken
+	userSkipped  []string          // files the user cancelled individually
+	mu           sync.Mutex        // Protects string, maps and bools
+	isRunning    bool
+	fdThrottled  int64 // Atomic counter of throttled waiters
+	skippedFiles int64 // Atomic
 
 	// Speed calculation helpers
 	lastBytes    int64
@@ -70,9 +126,16 @@ func (m *TransferMonitor) Reset(totalFiles, totalBytes int64) {
 	atomic.StoreInt64(&m.totalFiles, totalFiles)
 	atomic.StoreInt64(&m.totalBytes, totalBytes)
 	atomic.StoreInt64(&m.filesDone, 0)
+	atomic.StoreInt64(&m.filesFailed, 0)
 	atomic.StoreInt64(&m.bytesDone, 0)
+	atomic.StoreInt64(&m.skippedFiles, 0)
+	atomic.StoreInt64(&m.pendingRetry, 0)
 
 	m.currentFile = "Initializing..."
+	m.recentFiles = nil
+	m.retried = nil
+	m.mismatches = nil
+	m.userSkipped = nil
 	m.isRunning = true
 	m.lastBytes = 0
 	m.lastCheck = time.Now()
@@ -88,9 +151,110 @@ func (m *TransferMonitor) IncFileDone() {
 	atomic.AddInt64(&m.filesDone, 1)
 }
 
+// IncFileFailed counts a job whose final outcome was an error. Every queued
+// job ends up in exactly one bucket — done, failed, or skipped by the user —
+// so the three always sum to the total.
+func (m *TransferMonitor) IncFileFailed() {
+	atomic.AddInt64(&m.filesFailed, 1)
+}
+
+// SetPendingRetry publishes how many jobs are parked for the end-of-batch
+// retry pass, so the dashboard can say "3 waiting for another go" instead
+// of looking stuck.
+func (m *TransferMonitor) SetPendingRetry(n int64) {
+	atomic.StoreInt64(&m.pendingRetry, n)
+}
+
+// AddSkippedFiles counts files left alone because the destination already
+// had an up-to-date copy.
+func (m *TransferMonitor) AddSkippedFiles(n int64) {
+	atomic.AddInt64(&m.skippedFiles, n)
+}
+
 func (m *TransferMonitor) SetCurrentFile(name string) {
 	m.mu.Lock()
 	m.currentFile = name
+	m.recentFiles = append(m.recentFiles, name)
+	if len(m.recentFiles) > RecentFilesKept {
+		m.recentFiles = m.recentFiles[len(m.recentFiles)-RecentFilesKept:]
+	}
+	m.mu.Unlock()
+}
+
+// RecordMismatch notes that a file failed checksum verification and which
+// policy action was taken, so the final report can list it.
+func (m *TransferMonitor) RecordMismatch(path, action string) {
+	m.mu.Lock()
+	if m.mismatches == nil {
+		m.mismatches = make(map[string]string)
+	}
+	m.mismatches[path] = action
+	m.mu.Unlock()
+}
+
+// MismatchedFiles returns a copy of path -> policy action for files that
+// failed verification.
+func (m *TransferMonitor) MismatchedFiles() map[string]string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	out := make(map[string]string, len(m.mismatches))
+	for k, v := range m.mismatches {
+		out[k] = v
+	}
+	return out
+}
+
+// RecordUserSkip notes that the user cancelled this one file mid-flight;
+// it's a deliberate skip, not a failure.
+func (m *TransferMonitor) RecordUserSkip(path string) {
+	m.mu.Lock()
+	m.userSkipped = append(m.userSkipped, path)
+	m.mu.Unlock()
+}
+
+// UserSkippedFiles returns the files cancelled individually this batch.
+func (m *TransferMonitor) UserSkippedFiles() []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]string(nil), m.userSkipped...)
+}
+
+// AddRetry records a failed attempt for a file. The retry loops already had
+// this information; now it isn't thrown away.
+func (m *TransferMonitor) AddRetry(path string) {
+	m.mu.Lock()
+	if m.retried == nil {
+		m.retried = make(map[string]int)
+	}
+	m.retried[path]++
+	m.mu.Unlock()
+}
+
+// RetriedFiles returns a copy of path -> failed-attempt counts for files
+// that needed more than one attempt.
+func (m *TransferMonitor) RetriedFiles() map[string]int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	out := make(map[string]int, len(m.retried))
+	for k, v := range m.retried {
+		out[k] = v
+	}
+	return out
+}
+
+// SetFdThrottled tracks workers stuck waiting for an open-file slot. It's a
+// counter under the hood since many workers can be throttled at once.
+func (m *TransferMonitor) SetFdThrottled(throttled bool) {
+	if throttled {
+		atomic.AddInt64(&m.fdThrottled, 1)
+	} else {
+		atomic.AddInt64(&m.fdThrottled, -1)
+	}
+}
+
+func (m *TransferMonitor) SetPhase(p Phase) {
+	m.mu.Lock()
+	m.phase = p
 	m.mu.Unlock()
 }
 
@@ -119,19 +283,38 @@ func (m *TransferMonitor) GetStats() TransferStats {
 		m.lastCheck = now
 	}
 
+	retries := int64(0)
+	for _, n := range m.retried {
+		retries += int64(n)
+	}
+
 	percent := 0.0
+	totalFiles := atomic.LoadInt64(&m.totalFiles)
+	filesDone := atomic.LoadInt64(&m.filesDone)
 	if totalBytes > 0 {
 		percent = (float64(bytesNow) / float64(totalBytes)) * 100
+	} else if totalFiles > 0 {
+		// All-zero-byte batches (or unknown sizes) would sit at 0% forever;
+		// fall back to file-count progress so the bar still moves.
+		percent = (float64(filesDone) / float64(totalFiles)) * 100
 	}
 
 	return TransferStats{
-		TotalFiles:      atomic.LoadInt64(&m.totalFiles),
-		FilesDone:       atomic.LoadInt64(&m.filesDone),
+		TotalFiles:      totalFiles,
+		FilesDone:       filesDone,
 		TotalBytes:      totalBytes,
 		BytesDone:       bytesNow,
 		ProgressPercent: percent,
 		SpeedMBs:        m.currentSpeed,
 		CurrentFile:     m.currentFile,
 		IsRunning:       m.isRunning,
+		Phase:           m.phase.String(),
+		RecentFiles:     append([]string(nil), m.recentFiles...),
+		TotalRetries:    retries,
+		FdThrottled:     atomic.LoadInt64(&m.fdThrottled) > 0,
+		SkippedByUser:   append([]string(nil), m.userSkipped...),
+		SkippedFiles:    atomic.LoadInt64(&m.skippedFiles),
+		FilesFailed:     atomic.LoadInt64(&m.filesFailed),
+		PendingRetry:    atomic.LoadInt64(&m.pendingRetry),
 	}
 }
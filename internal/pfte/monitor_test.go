@@ -0,0 +1,53 @@
+/*
+ * Copyright 2026 The FileRipper Team
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package pfte
+
+import "testing"
+
+func TestProgressFallsBackToFileCount(t *testing.T) {
+	m := NewMonitor()
+
+	// A batch of 10 empty files: TotalBytes is 0, but the bar should still
+	// advance as files complete.
+	m.Reset(10, 0)
+	for i := 0; i < 5; i++ {
+		m.IncFileDone()
+	}
+
+	stats := m.GetStats()
+	if stats.ProgressPercent != 50 {
+		t.Errorf("expected 50%% from file counts, got %.1f%%", stats.ProgressPercent)
+	}
+
+	for i := 0; i < 5; i++ {
+		m.IncFileDone()
+	}
+	if got := m.GetStats().ProgressPercent; got != 100 {
+		t.Errorf("expected 100%%, got %.1f%%", got)
+	}
+}
+
+func TestProgressPrefersBytesWhenKnown(t *testing.T) {
+	m := NewMonitor()
+	m.Reset(4, 1000)
+	m.AddBytes(250)
+	m.IncFileDone() // file count says 25% too, but bytes are authoritative
+
+	if got := m.GetStats().ProgressPercent; got != 25 {
+		t.Errorf("expected 25%% from bytes, got %.1f%%", got)
+	}
+}
@@ -0,0 +1,388 @@
+/*
+ * Copyright 2026 The FileRipper Team
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package pfte
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"time"
+
+	"fileripper/internal/network"
+)
+
+// PlanEntry is one file a transfer would move.
+type PlanEntry struct {
+	LocalPath  string `json:"local_path"`
+	RemotePath string `json:"remote_path"`
+	Size       int64  `json:"size"`
+}
+
+// TransferPlan is the answer to "what would this transfer actually do?":
+// the same enumeration a real transfer performs, minus the transferring.
+type TransferPlan struct {
+	Operation  string      `json:"operation"`
+	TotalFiles int64       `json:"total_files"`
+	TotalBytes int64       `json:"total_bytes"`
+	TotalDirs  int64       `json:"total_dirs"`
+	Dirs       []string    `json:"dirs,omitempty"`
+	Files      []PlanEntry `json:"files,omitempty"`
+}
+
+// BuildPlan runs the enumeration phase of StartTransfer and reports what it
+// found without creating directories, queuing jobs, or moving bytes. When
+// includeList is false only the counts/totals are filled in, which keeps the
+// response small for huge trees.
+func (e *Engine) BuildPlan(ctx context.Context, sessions []*network.SftpSession, operation, sourcePath, destPath string, includeList bool) (*TransferPlan, error) {
+	if len(sessions) == 0 || !sessions[0].Ready() {
+		return nil, fmt.Errorf("no_active_sessions")
+	}
+	mainSession := sessions[0]
+
+	plan := &TransferPlan{Operation: operation}
+
+	if operation == "UPLOAD" {
+		destPath, err := cleanDest(destPath)
+		if err != nil {
+			return nil, err
+		}
+		if destPath == "." {
+			if wd, err := mainSession.Getwd(); err == nil {
+				destPath = wd
+			}
+		}
+
+		folders, files, totalBytes, err := e.enumerateUpload(sourcePath, destPath)
+		GlobalMonitor.SetPhase(PhaseIdle)
+		if err != nil {
+			return nil, err
+		}
+
+		plan.TotalFiles = int64(len(files))
+		plan.TotalBytes = totalBytes
+		plan.TotalDirs = int64(len(folders))
+		if includeList {
+			for _, d := range folders {
+				plan.Dirs = append(plan.Dirs, d.path)
+			}
+			for _, job := range files {
+				size := int64(0)
+				if st, err := os.Stat(job.LocalPath); err == nil {
+					size = st.Size()
+				}
+				plan.Files = append(plan.Files, PlanEntry{
+					LocalPath:  job.LocalPath,
+					RemotePath: job.RemotePath,
+					Size:       size,
+				})
+			}
+		}
+		return plan, nil
+	}
+
+	// DOWNLOAD: same resolution and walk as startDownload, collect-only.
+	remoteSource, rootDirName := downloadLayout(sourcePath)
+	info, err := mainSession.Stat(remoteSource)
+	if err != nil {
+		return nil, err
+	}
+
+	localBase := "dump"
+
+	GlobalMonitor.SetPhase(PhaseEnumerating)
+	defer GlobalMonitor.SetPhase(PhaseIdle)
+
+	walker := mainSession.Walk(remoteSource)
+	for walker.Step() {
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		default:
+		}
+		if walker.Err() != nil {
+			continue
+		}
+		remotePath := walker.Path()
+		stat := walker.Stat()
+
+		// Planning treats symlinks the conservative way: skipped, like a
+		// default (non-following) transfer would skip them.
+		if stat.Mode()&os.ModeSymlink != 0 {
+			continue
+		}
+
+		relPath := remoteRelPath(remoteSource, remotePath)
+		localPath := filepath.Join(localBase, rootDirName, filepath.FromSlash(relPath))
+		if !info.IsDir() && remotePath == remoteSource {
+			localPath = filepath.Join(localBase, rootDirName)
+			if rootDirName == "" {
+				localPath = filepath.Join(localBase, path.Base(remoteSource))
+			}
+		}
+
+		if stat.IsDir() {
+			plan.TotalDirs++
+			if includeList {
+				plan.Dirs = append(plan.Dirs, localPath)
+			}
+			continue
+		}
+
+		plan.TotalFiles++
+		plan.TotalBytes += stat.Size()
+		if includeList {
+			plan.Files = append(plan.Files, PlanEntry{
+				LocalPath:  localPath,
+				RemotePath: remotePath,
+				Size:       stat.Size(),
+			})
+		}
+	}
+	return plan, nil
+}
+
+// PlanRecord is one NDJSON line of a streamed plan: a file job, a directory
+// that would be created, or an entry the filters dropped (with the reason).
+// Automation consumes these to drive approval workflows or external movers.
+type PlanRecord struct {
+	Type       string `json:"type"` // "file", "dir" or "skip"
+	Operation  string `json:"operation,omitempty"`
+	LocalPath  string `json:"local_path,omitempty"`
+	RemotePath string `json:"remote_path,omitempty"`
+	Size       int64  `json:"size,omitempty"`
+	Reason     string `json:"reason,omitempty"` // skips only
+}
+
+// StreamPlan runs the same enumeration and filtering a transfer would and
+// writes the concrete job list to w as NDJSON — one record per line, emitted
+// as the walk goes, so a million-file plan never has to fit in memory. No
+// directories are created and no bytes move. This is the machine-readable
+// sibling of BuildPlan's summary.
+func (e *Engine) StreamPlan(ctx context.Context, sessions []*network.SftpSession, operation, sourcePath, destPath string, w io.Writer) error {
+	if len(sessions) == 0 || !sessions[0].Ready() {
+		return fmt.Errorf("no_active_sessions")
+	}
+	mainSession := sessions[0]
+	enc := json.NewEncoder(w)
+
+	if operation == "UPLOAD" {
+		destPath, err := cleanDest(destPath)
+		if err != nil {
+			return err
+		}
+		if destPath == "." {
+			if wd, err := mainSession.Getwd(); err == nil {
+				destPath = wd
+			}
+		}
+
+		folders, files, _, err := e.enumerateUpload(sourcePath, destPath)
+		GlobalMonitor.SetPhase(PhaseIdle)
+		if err != nil {
+			return err
+		}
+		for _, d := range folders {
+			if err := enc.Encode(PlanRecord{Type: "dir", Operation: operation, RemotePath: d.path}); err != nil {
+				return err
+			}
+		}
+		for _, job := range files {
+			size := int64(0)
+			if st, err := os.Stat(job.LocalPath); err == nil {
+				size = st.Size()
+			}
+			rec := PlanRecord{
+				Type: "file", Operation: operation,
+				LocalPath: job.LocalPath, RemotePath: job.RemotePath, Size: size,
+			}
+			if err := enc.Encode(rec); err != nil {
+				return err
+			}
+		}
+		for _, p := range e.SkippedSpecial {
+			if err := enc.Encode(PlanRecord{Type: "skip", Operation: operation, LocalPath: p, Reason: "special file"}); err != nil {
+				return err
+			}
+		}
+		for _, warning := range e.Warnings {
+			if err := enc.Encode(PlanRecord{Type: "skip", Operation: operation, Reason: warning}); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	// DOWNLOAD: stream records straight off the walk.
+	remoteSource, rootDirName := downloadLayout(sourcePath)
+	info, err := mainSession.Stat(remoteSource)
+	if err != nil {
+		return err
+	}
+
+	localBase := "dump"
+
+	GlobalMonitor.SetPhase(PhaseEnumerating)
+	defer GlobalMonitor.SetPhase(PhaseIdle)
+
+	walker := mainSession.Walk(remoteSource)
+	for walker.Step() {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		default:
+		}
+		if walker.Err() != nil {
+			continue
+		}
+		remotePath := walker.Path()
+		stat := walker.Stat()
+		relPath := remoteRelPath(remoteSource, remotePath)
+		localPath := filepath.Join(localBase, rootDirName, filepath.FromSlash(relPath))
+		if !info.IsDir() && remotePath == remoteSource {
+			localPath = filepath.Join(localBase, rootDirName)
+			if rootDirName == "" {
+				localPath = filepath.Join(localBase, path.Base(remoteSource))
+			}
+		}
+
+		rec := PlanRecord{Operation: operation, LocalPath: localPath, RemotePath: remotePath}
+
+		// Apply the same filters the transfer applies, but keep what they
+		// drop on the record — "why isn't my file in the plan" should be
+		// answerable from the output alone.
+		switch {
+		case remotePath != remoteSource && matchesExclude(e.Excludes, relPath):
+			rec.Type, rec.Reason = "skip", "excluded by pattern"
+			if stat.IsDir() {
+				walker.SkipDir()
+			}
+		case stat.Mode()&os.ModeSymlink != 0:
+			// Conservative like BuildPlan: a default transfer skips these.
+			rec.Type, rec.Reason = "skip", "symlink following disabled"
+		case !stat.IsDir() && !stat.Mode().IsRegular():
+			rec.Type, rec.Reason = "skip", fmt.Sprintf("special file (%s)", stat.Mode())
+		case stat.IsDir():
+			rec.Type = "dir"
+			if e.MaxDepth >= 0 && remotePath != remoteSource && pathDepth(relPath) >= e.MaxDepth {
+				walker.SkipDir()
+			}
+		default:
+			rec.Type, rec.Size = "file", stat.Size()
+		}
+		if err := enc.Encode(rec); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// probeSize is how much the bandwidth probe pushes over the wire: enough to
+// get past TCP slow start, small enough to be over in a blink on any link
+// worth using.
+const probeSize = 256 * 1024
+
+// TransferEstimate is the pre-flight answer to "how big is this and how long
+// will it take?". ETA is only filled in when a probe ran (or a prior
+// throughput figure was supplied); enumeration alone can't know the link.
+type TransferEstimate struct {
+	Operation  string `json:"operation"`
+	TotalFiles int64  `json:"total_files"`
+	TotalBytes int64  `json:"total_bytes"`
+	TotalDirs  int64  `json:"total_dirs"`
+
+	ProbeBytesPerSec int64         `json:"probe_bytes_per_sec,omitempty"`
+	ETA              time.Duration `json:"eta_ns,omitempty"`
+}
+
+// Estimate enumerates like a dry run and, when probe is set, measures the
+// link by pushing a small temp file to the server (removed afterwards) to
+// turn the byte total into a realistic duration — "~22 minutes" beats
+// finding out the hard way. Distinct from the live ETA, which needs a
+// running transfer to exist.
+func (e *Engine) Estimate(ctx context.Context, sessions []*network.SftpSession, operation, sourcePath, destPath string, probe bool) (*TransferEstimate, error) {
+	plan, err := e.BuildPlan(ctx, sessions, operation, sourcePath, destPath, false)
+	if err != nil {
+		return nil, err
+	}
+
+	est := &TransferEstimate{
+		Operation:  plan.Operation,
+		TotalFiles: plan.TotalFiles,
+		TotalBytes: plan.TotalBytes,
+		TotalDirs:  plan.TotalDirs,
+	}
+
+	if probe {
+		rate, err := probeThroughput(ctx, sessions[0])
+		if err != nil {
+			return nil, fmt.Errorf("bandwidth probe failed: %v", err)
+		}
+		est.ProbeBytesPerSec = rate
+		if rate > 0 {
+			est.ETA = time.Duration(float64(est.TotalBytes) / float64(rate) * float64(time.Second))
+		}
+	}
+	return est, nil
+}
+
+// probeThroughput times a small upload to the server's working directory and
+// returns bytes/sec. The probe file is removed whether or not the write
+// finished cleanly.
+func probeThroughput(ctx context.Context, session *network.SftpSession) (int64, error) {
+	wd, err := session.Getwd()
+	if err != nil {
+		wd = "."
+	}
+	probePath := path.Join(wd, fmt.Sprintf(".fileripper-probe-%d", time.Now().UnixNano()))
+
+	dst, err := session.Create(probePath)
+	if err != nil {
+		return 0, err
+	}
+	defer session.Remove(probePath)
+
+	chunk := make([]byte, 32*1024)
+	written := int64(0)
+	start := time.Now()
+	for written < probeSize {
+		select {
+		case <-ctx.Done():
+			dst.Close()
+			return 0, ctx.Err()
+		default:
+		}
+		n, err := dst.Write(chunk)
+		written += int64(n)
+		if err != nil {
+			dst.Close()
+			return 0, err
+		}
+	}
+	if err := dst.Close(); err != nil {
+		return 0, err
+	}
+
+	elapsed := time.Since(start).Seconds()
+	if elapsed <= 0 {
+		elapsed = 1e-6 // a loopback probe can finish between clock ticks
+	}
+	return int64(float64(written) / elapsed), nil
+}
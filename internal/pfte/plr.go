@@ -18,8 +18,12 @@ package pfte
 
 import (
 	"context"
+	"os"
 	"sync"
+	"sync/atomic"
+	"time"
 
+	"fileripper/internal/core"
 	"fileripper/internal/network"
 )
 
@@ -28,6 +32,161 @@ type WorkerPool struct {
 	Concurrency int
 	Queue       *JobQueue
 	Wg          sync.WaitGroup
+
+	// Live-scaling state: desired is the target worker count (changeable
+	// mid-run via Resize), active the number currently looping. A worker
+	// noticing active > desired retires after its current file; growing
+	// spawns fresh workers on the spot.
+	desired int32
+	active  int32
+	nextID  int32
+
+	// Captured by StartUnleash so Resize can spawn workers later with the
+	// same context and session rotation.
+	runCtx   context.Context
+	sessions []*network.SftpSession
+	spawnMu  sync.Mutex
+
+	// FileTimeout caps a single job (retries included). 0 = unlimited.
+	FileTimeout time.Duration
+
+	// Verify re-checks downloads against the streamed checksum; Mismatch
+	// decides what to do when that fails.
+	Verify   bool
+	Mismatch MismatchPolicy
+
+	// Resume lets multipart uploads pick up from their chunk journal.
+	Resume bool
+
+	// ForceFileMode, when non-zero, is stamped onto every uploaded file
+	// after transfer, overriding whatever mode the source had.
+	ForceFileMode os.FileMode
+
+	// PreserveFileModes copies the remote file's permissions onto each
+	// downloaded file (so scripts keep +x and private keys stay 0600);
+	// otherwise DefaultFileMode is applied when non-zero. Without either,
+	// downloads land with os.Create's 0666-minus-umask and nothing else.
+	PreserveFileModes bool
+	DefaultFileMode   os.FileMode
+
+	// KeepPartial renames a failed download's bytes to "<name>.part"
+	// instead of deleting them.
+	KeepPartial bool
+
+	// PauseOnDisconnect turns total connectivity loss into a pause instead
+	// of a failure cascade: when a job fails and no session answers a probe,
+	// workers hold off on popping jobs while one of them re-probes every
+	// ProbeInterval, resuming the batch when the network returns.
+	// PauseDeadline caps how long one continuous pause may last before the
+	// pool gives up and lets the remaining jobs fail normally (0 = forever).
+	PauseOnDisconnect bool
+	ProbeInterval     time.Duration
+	PauseDeadline     time.Duration
+
+	// paused is 1 while the probing worker holds the batch; pauseExpired
+	// flips to 1 when a pause hit its deadline, disarming further pauses.
+	paused       int32
+	pauseExpired int32
+
+	// completed collects every job a worker finished, success or not, with
+	// its Result filled in. Read it via Results() after the pool drains.
+	completed   []*TransferJob
+	completedMu sync.Mutex
+
+	// quotaHit flips to 1 when a worker runs the destination out of space.
+	// Every following file would fail the same way, so the pool drains
+	// without attempting them.
+	quotaHit int32
+
+	// diskFull is quotaHit's local-side twin: the download disk filled up.
+	diskFull int32
+
+	// MaxRetryRounds gives finally-failed jobs whole extra passes once the
+	// main queue drains — transient server-side locks often clear by then.
+	// Zero keeps the historic single pass.
+	MaxRetryRounds int
+	round          int32 // current retry round, atomic
+	retryPending   []*TransferJob
+	retryMu        sync.Mutex
+
+	// reconnects counts in-place tunnel rebuilds per session, so a host
+	// that keeps dropping us doesn't get redialed forever.
+	reconnects   map[*network.SftpSession]int
+	reconnectsMu sync.Mutex
+
+	// SourceSession is the read side for "REMOTE" (server-to-server) jobs;
+	// the pool's own sessions are the write side.
+	SourceSession *network.SftpSession
+
+	// PreserveXattrs ships extended attributes in sidecar files; anything
+	// that couldn't be preserved ends up in xattrIssues for the report.
+	PreserveXattrs bool
+	xattrIssues    []string
+	xattrMu        sync.Mutex
+}
+
+// activePool points at the pool currently draining a batch, so the worker
+// count can be adjusted from outside (CLI signal, API call) without holding
+// a handle to the engine internals.
+var (
+	activePool   *WorkerPool
+	activePoolMu sync.Mutex
+)
+
+// ScaleWorkers adjusts the worker count of the transfer that's running right
+// now. Returns false when nothing is in flight. Shrinking is graceful —
+// excess workers finish their current file first; growing takes effect
+// immediately.
+func ScaleWorkers(n int) bool {
+	activePoolMu.Lock()
+	pool := activePool
+	activePoolMu.Unlock()
+	if pool == nil {
+		return false
+	}
+	pool.Resize(n)
+	return true
+}
+
+// activeJobs tracks the cancel function of every in-flight file, keyed by
+// remote path, so a single pathological file can be skipped while the batch
+// keeps going. userSkips remembers which cancellations were deliberate so
+// the worker can file them under "skipped by user" instead of "failed".
+var (
+	activeJobs   = make(map[string]context.CancelFunc)
+	userSkips    = make(map[string]bool)
+	activeJobsMu sync.Mutex
+)
+
+// CancelFile cancels the in-flight transfer of remotePath without touching
+// the rest of the batch. Returns false when no worker is currently on it.
+func CancelFile(remotePath string) bool {
+	activeJobsMu.Lock()
+	defer activeJobsMu.Unlock()
+	cancel, ok := activeJobs[remotePath]
+	if !ok {
+		return false
+	}
+	userSkips[remotePath] = true
+	cancel()
+	return true
+}
+
+func registerActiveJob(remotePath string, cancel context.CancelFunc) {
+	activeJobsMu.Lock()
+	activeJobs[remotePath] = cancel
+	activeJobsMu.Unlock()
+}
+
+// releaseActiveJob drops the registration and reports whether the file's
+// cancellation came from the user.
+func releaseActiveJob(remotePath string) bool {
+	activeJobsMu.Lock()
+	defer activeJobsMu.Unlock()
+	delete(activeJobs, remotePath)
+	skipped := userSkips[remotePath]
+	delete(userSkips, remotePath)
+	return skipped
 }
 
 func NewWorkerPool(concurrency int, queue *JobQueue) *WorkerPool {
@@ -39,52 +198,453 @@ func NewWorkerPool(concurrency int, queue *JobQueue) *WorkerPool {
 
 // StartUnleash fires up the goroutines using ROUND ROBIN session balancing.
 func (wp *WorkerPool) StartUnleash(ctx context.Context, sessions []*network.SftpSession) {
-	sessionCount := len(sessions)
-
 	GlobalMonitor.SetRunning(true)
+	resetDownloadClaims()
 
+	wp.runCtx = ctx
+	wp.sessions = sessions
+	atomic.StoreInt32(&wp.desired, int32(wp.Concurrency))
+
+	activePoolMu.Lock()
+	activePool = wp
+	activePoolMu.Unlock()
+	defer func() {
+		activePoolMu.Lock()
+		activePool = nil
+		activePoolMu.Unlock()
+	}()
+
+	wp.spawnMu.Lock()
 	for i := 0; i < wp.Concurrency; i++ {
-		wp.Wg.Add(1)
+		wp.spawn()
+	}
+	wp.spawnMu.Unlock()
+
+	wp.Wg.Wait()
+
+	// End-of-batch retry rounds: everything that failed its inline
+	// attempts goes back through the full machinery, bounded by
+	// MaxRetryRounds so a permanently broken file can't spin forever.
+	for atomic.LoadInt32(&wp.round) < int32(wp.MaxRetryRounds) {
+		atomic.AddInt32(&wp.round, 1)
+		wp.retryMu.Lock()
+		pending := wp.retryPending
+		wp.retryPending = nil
+		GlobalMonitor.SetPendingRetry(0)
+		wp.retryMu.Unlock()
+
+		if len(pending) == 0 || ctx.Err() != nil ||
+			atomic.LoadInt32(&wp.quotaHit) == 1 || atomic.LoadInt32(&wp.diskFull) == 1 {
+			// Nothing retryable (or no point): finalize what's left below.
+			for _, job := range pending {
+				wp.Queue.Add(job)
+			}
+			break
+		}
+
+		for _, job := range pending {
+			wp.Queue.Add(job)
+		}
+		wp.spawnMu.Lock()
+		for i := 0; i < wp.Concurrency; i++ {
+			wp.spawn()
+		}
+		wp.spawnMu.Unlock()
+		wp.Wg.Wait()
+	}
+
+	// Whatever is still queued when the workers leave early (quota stop,
+	// cancellation) gets finalized as failed, so the counters always add up
+	// to the batch total instead of silently losing the tail.
+	for job := wp.Queue.Pop(); job != nil; job = wp.Queue.Pop() {
+		reason := ctx.Err()
+		if reason == nil && atomic.LoadInt32(&wp.quotaHit) == 1 {
+			reason = core.ErrQuotaExceeded
+		}
+		if reason == nil && atomic.LoadInt32(&wp.diskFull) == 1 {
+			reason = core.ErrLocalDiskFull
+		}
+		if reason == nil {
+			reason = context.Canceled
+		}
+		job.Result.Err = reason
+		GlobalMonitor.IncFileFailed()
+		wp.completedMu.Lock()
+		wp.completed = append(wp.completed, job)
+		wp.completedMu.Unlock()
+	}
+
+	GlobalMonitor.SetRunning(false)
+}
+
+// Resize sets the live worker target. Growth spawns immediately; shrinkage
+// lets the surplus retire between files, so nothing in flight is aborted.
+func (wp *WorkerPool) Resize(n int) {
+	if n < 1 {
+		n = 1
+	}
+	wp.spawnMu.Lock()
+	defer wp.spawnMu.Unlock()
+	atomic.StoreInt32(&wp.desired, int32(n))
+	for int(atomic.LoadInt32(&wp.active)) < n {
+		wp.spawn()
+	}
+}
+
+// spawn launches one worker. Callers hold spawnMu.
+func (wp *WorkerPool) spawn() {
+	wp.Wg.Add(1)
+	atomic.AddInt32(&wp.active, 1)
 
-		// Load Balance: Worker 0 -> Sess 0, Worker 1 -> Sess 1, Worker 2 -> Sess 0...
-		assignedSession := sessions[i%sessionCount]
+	// Load Balance: Worker 0 -> Sess 0, Worker 1 -> Sess 1, Worker 2 -> Sess 0...
+	workerID := int(atomic.AddInt32(&wp.nextID, 1) - 1)
+	assignedSession := wp.sessions[workerID%len(wp.sessions)]
 
-		go func(workerID int, sess *network.SftpSession) {
-			defer wp.Wg.Done()
+	go func(workerID int, sess *network.SftpSession) {
+		defer wp.Wg.Done()
+		defer atomic.AddInt32(&wp.active, -1)
 
+		for {
+			select {
+			case <-wp.runCtx.Done():
+				return
+			default:
+			}
+
+			// Retire when the pool shrank under us: the CAS makes sure
+			// exactly as many workers leave as the resize asked for.
 			for {
-				select {
-				case <-ctx.Done():
+				a := atomic.LoadInt32(&wp.active)
+				if a <= atomic.LoadInt32(&wp.desired) {
+					break
+				}
+				if atomic.CompareAndSwapInt32(&wp.active, a, a-1) {
+					atomic.AddInt32(&wp.active, 1) // deferred decrement balances this
 					return
-				default:
 				}
+			}
 
-				job := wp.Queue.Pop()
-				if job == nil {
-					return
+			if atomic.LoadInt32(&wp.quotaHit) == 1 || atomic.LoadInt32(&wp.diskFull) == 1 {
+				return // one side is out of space; don't burn the rest of the queue
+			}
+
+			job := wp.Queue.Pop()
+			if job == nil {
+				return
+			}
+
+			// A job that already failed on this tunnel belongs to someone
+			// else, as long as another worker is around to take it.
+			if job.hasTried(sess) && job.triedCount() < len(wp.sessions) &&
+				atomic.LoadInt32(&wp.active) > 1 {
+				wp.Queue.Add(job)
+				time.Sleep(5 * time.Millisecond) // let the right worker get at it
+				continue
+			}
+
+			GlobalMonitor.SetCurrentFile(job.RemotePath)
+			job.Result.Session = sess.Hostname
+			started := time.Now()
+
+			// Per-file context: gives each file its own deadline and
+			// lets CancelFile skip exactly this one.
+			var jobCtx context.Context
+			var cancel context.CancelFunc
+			if wp.FileTimeout > 0 {
+				jobCtx, cancel = context.WithTimeout(wp.runCtx, wp.FileTimeout)
+			} else {
+				jobCtx, cancel = context.WithCancel(wp.runCtx)
+			}
+			registerActiveJob(job.RemotePath, cancel)
+
+			var err error
+			if job.Operation == "DOWNLOAD" {
+				if wp.Verify {
+					err = DownloadFileVerified(jobCtx, sess, job.RemotePath, job.LocalPath, wp.Mismatch, &job.Result)
+				} else if wp.Resume {
+					err = DownloadFileResumable(jobCtx, sess, job.RemotePath, job.LocalPath, &job.Result)
+				} else {
+					err = DownloadFileWithProgress(jobCtx, sess, job.RemotePath, job.LocalPath, &job.Result)
 				}
+			} else if job.Operation == "UPLOAD" {
+				if wp.Resume {
+					err = UploadFileResumable(jobCtx, sess, job.LocalPath, job.RemotePath, &job.Result)
+				} else {
+					err = UploadFileWithProgress(jobCtx, sess, job.LocalPath, job.RemotePath, &job.Result)
+				}
+			} else if job.Operation == "REMOTE" {
+				err = CopyRemoteWithProgress(jobCtx, wp.SourceSession, sess, job.LocalPath, job.RemotePath, &job.Result)
+			}
+			cancel()
 
-				GlobalMonitor.SetCurrentFile(job.RemotePath)
+			userSkipped := releaseActiveJob(job.RemotePath)
+			if userSkipped {
+				GlobalMonitor.RecordUserSkip(job.RemotePath)
+			}
 
-				var err error
-				if job.Operation == "DOWNLOAD" {
-					err = DownloadFileWithProgress(ctx, sess, job.RemotePath, job.LocalPath)
-				} else if job.Operation == "UPLOAD" {
-					err = UploadFileWithProgress(ctx, sess, job.LocalPath, job.RemotePath)
+			// A failure with every session dark is the network's fault, not
+			// the file's: park the job and wait for connectivity to return.
+			if err != nil && !userSkipped && err != core.ErrQuotaExceeded &&
+				err != core.ErrLocalDiskFull && wp.runCtx.Err() == nil &&
+				wp.PauseOnDisconnect && atomic.LoadInt32(&wp.pauseExpired) == 0 && wp.allSessionsDown() {
+				wp.Queue.Add(job)
+				wp.pauseUntilReconnected()
+				continue
+			}
+
+			// A connection error with the tunnel actually dead is the
+			// session's fault, not the file's: rebuild it in place and put
+			// the job back. Bounded per session — a server that keeps
+			// dropping us isn't coming back because we redial harder.
+			if err != nil && !userSkipped && wp.runCtx.Err() == nil &&
+				network.IsConnectionError(err) && sessionDead(sess) {
+				if wp.noteReconnect(sess) {
+					if rerr := sess.Reconnect(); rerr == nil {
+						if job.Operation == "DOWNLOAD" {
+							cleanupPartialDownload(job, wp.KeepPartial)
+						}
+						wp.Queue.Add(job)
+						continue
+					}
 				}
+			}
 
-				if err != nil {
-					// Concise logging to avoid console spam
-					// log.Printf("[Worker %d] Fail: %v", workerID, err)
-					// Simple retry logic is inside transfer functions
+			// Same-session retries are exhausted; before declaring the file
+			// failed, let a different tunnel have a go — one degraded
+			// session out of several is exactly why we run more than one.
+			if err != nil && !userSkipped && err != core.ErrQuotaExceeded &&
+				err != core.ErrLocalDiskFull && wp.runCtx.Err() == nil {
+				job.markTried(sess)
+				if len(wp.sessions) > 1 && job.triedCount() < len(wp.sessions) {
+					if job.Operation == "DOWNLOAD" {
+						cleanupPartialDownload(job, wp.KeepPartial)
+					}
+					wp.Queue.Add(job)
 					continue
 				}
+			}
+
+			// Out of inline attempts and out of alternate sessions — but
+			// not necessarily out of luck: park it for the end-of-batch
+			// retry pass if rounds remain. Transient server-side locks are
+			// usually gone by the time the rest of the queue has drained.
+			if err != nil && !userSkipped && err != core.ErrQuotaExceeded &&
+				err != core.ErrLocalDiskFull && wp.runCtx.Err() == nil &&
+				atomic.LoadInt32(&wp.round) < int32(wp.MaxRetryRounds) {
+				if job.Operation == "DOWNLOAD" {
+					cleanupPartialDownload(job, wp.KeepPartial)
+				}
+				wp.retryMu.Lock()
+				wp.retryPending = append(wp.retryPending, job)
+				GlobalMonitor.SetPendingRetry(int64(len(wp.retryPending)))
+				wp.retryMu.Unlock()
+				continue
+			}
+
+			job.Result.Duration = time.Since(started)
+			job.Result.Err = err
+			if err == core.ErrQuotaExceeded {
+				atomic.StoreInt32(&wp.quotaHit, 1)
+			}
+			if err == core.ErrLocalDiskFull {
+				atomic.StoreInt32(&wp.diskFull, 1)
+			}
+			wp.completedMu.Lock()
+			wp.completed = append(wp.completed, job)
+			wp.completedMu.Unlock()
+
+			if err != nil {
+				// Concise logging to avoid console spam
+				// log.Printf("[Worker %d] Fail: %v", workerID, err)
+				// Simple retry logic is inside transfer functions
+				if !userSkipped {
+					GlobalMonitor.IncFileFailed()
+				}
+				if job.Operation == "DOWNLOAD" {
+					cleanupPartialDownload(job, wp.KeepPartial)
+				}
+				continue
+			}
 
-				GlobalMonitor.IncFileDone()
+			if job.Operation == "UPLOAD" && wp.ForceFileMode != 0 {
+				_ = sess.Chmod(job.RemotePath, wp.ForceFileMode)
+			}
+			if job.Operation == "UPLOAD" && wp.PreserveXattrs {
+				if issue := preserveXattrs(sess, job.LocalPath, job.RemotePath); issue != "" {
+					wp.addXattrIssue(issue)
+				}
 			}
-		}(i, assignedSession)
+			if job.Operation == "DOWNLOAD" {
+				landed := job.LocalPath
+				if job.Result.FinalPath != "" {
+					landed = job.Result.FinalPath
+				}
+				if wp.PreserveFileModes {
+					if st, statErr := sess.Stat(job.RemotePath); statErr == nil {
+						_ = os.Chmod(landed, st.Mode().Perm())
+					}
+				} else if wp.DefaultFileMode != 0 {
+					_ = os.Chmod(landed, wp.DefaultFileMode)
+				}
+				if wp.PreserveXattrs {
+					if issue := restoreXattrs(sess, job.RemotePath, landed); issue != "" {
+						wp.addXattrIssue(issue)
+					}
+				}
+			}
+
+			GlobalMonitor.IncFileDone()
+		}
+	}(workerID, assignedSession)
+}
+
+func (wp *WorkerPool) addXattrIssue(issue string) {
+	wp.xattrMu.Lock()
+	wp.xattrIssues = append(wp.xattrIssues, issue)
+	wp.xattrMu.Unlock()
+}
+
+// XattrIssues lists everything that couldn't be preserved or restored.
+func (wp *WorkerPool) XattrIssues() []string {
+	wp.xattrMu.Lock()
+	defer wp.xattrMu.Unlock()
+	return append([]string(nil), wp.xattrIssues...)
+}
+
+// maxReconnectAttempts bounds how often one session gets rebuilt in place
+// during a single batch.
+const maxReconnectAttempts = 2
+
+// sessionDead double-checks that the tunnel really is gone — a connection
+// error string can also come from a mid-file hiccup the session survived.
+func sessionDead(sess *network.SftpSession) bool {
+	_, err := sess.Getwd()
+	return err != nil
+}
+
+// noteReconnect records one rebuild attempt for sess and says whether it's
+// still within budget.
+func (wp *WorkerPool) noteReconnect(sess *network.SftpSession) bool {
+	wp.reconnectsMu.Lock()
+	defer wp.reconnectsMu.Unlock()
+	if wp.reconnects == nil {
+		wp.reconnects = make(map[*network.SftpSession]int)
+	}
+	if wp.reconnects[sess] >= maxReconnectAttempts {
+		return false
+	}
+	wp.reconnects[sess]++
+	return true
+}
+
+// allSessionsDown reports whether not a single session answers a cheap
+// round-trip anymore — the signature of the network being gone, as opposed
+// to one bad file or one degraded tunnel.
+func (wp *WorkerPool) allSessionsDown() bool {
+	for _, sess := range wp.sessions {
+		if _, err := sess.Getwd(); err == nil {
+			return false
+		}
 	}
+	return true
+}
 
-	wp.Wg.Wait()
-	GlobalMonitor.SetRunning(false)
+// pauseUntilReconnected parks the batch while the network is gone. The first
+// worker in becomes the prober; the rest just wait for it to lift the pause.
+// Returns false when the deadline ran out (or the run was cancelled) with
+// the network still dark.
+func (wp *WorkerPool) pauseUntilReconnected() bool {
+	interval := wp.ProbeInterval
+	if interval <= 0 {
+		interval = 5 * time.Second
+	}
+
+	if !atomic.CompareAndSwapInt32(&wp.paused, 0, 1) {
+		// Someone else is probing; wait for their verdict.
+		for atomic.LoadInt32(&wp.paused) == 1 {
+			select {
+			case <-wp.runCtx.Done():
+				return false
+			case <-time.After(interval / 4):
+			}
+		}
+		return atomic.LoadInt32(&wp.pauseExpired) == 0
+	}
+
+	GlobalMonitor.SetPhase(PhasePaused)
+	defer func() {
+		GlobalMonitor.SetPhase(PhaseTransferring)
+		atomic.StoreInt32(&wp.paused, 0)
+	}()
+
+	started := time.Now()
+	for {
+		select {
+		case <-wp.runCtx.Done():
+			atomic.StoreInt32(&wp.pauseExpired, 1)
+			return false
+		case <-time.After(interval):
+		}
+		if !wp.allSessionsDown() {
+			return true
+		}
+		if wp.PauseDeadline > 0 && time.Since(started) > wp.PauseDeadline {
+			// Disarm before lifting the pause so neither the waiters nor
+			// future failures start the dance again.
+			atomic.StoreInt32(&wp.pauseExpired, 1)
+			return false
+		}
+	}
+}
+
+// Results returns the jobs this pool finished, in completion order. Call it
+// after StartUnleash returns; it copies the slice so callers can't race us.
+func (wp *WorkerPool) Results() []*TransferJob {
+	wp.completedMu.Lock()
+	defer wp.completedMu.Unlock()
+	out := make([]*TransferJob, len(wp.completed))
+	copy(out, wp.completed)
+	return out
+}
+
+// TransferError pairs a failed file with why it failed, for reporting.
+type TransferError struct {
+	Path      string
+	Operation string
+	Err       error
+}
+
+// Failures filters Results down to the jobs that ended in an error, so
+// callers don't finish a "successful" batch blind to what's missing.
+func (wp *WorkerPool) Failures() []TransferError {
+	var out []TransferError
+	for _, job := range wp.Results() {
+		if job.Result.Err != nil {
+			out = append(out, TransferError{
+				Path:      job.RemotePath,
+				Operation: job.Operation,
+				Err:       job.Result.Err,
+			})
+		}
+	}
+	return out
+}
+
+// cleanupPartialDownload disposes of the temp partial a failed download left
+// behind, if any: deleted by default, parked at "<name>.part" with
+// KeepPartial. Partials live under per-job ".fr-*.tmp" names, so this only
+// ever touches the job's own file — never the destination, which with
+// colliding jobs may hold another job's finished bytes.
+func cleanupPartialDownload(job *TransferJob, keep bool) {
+	part := job.Result.PartialPath
+	if part == "" {
+		return
+	}
+	job.Result.PartialPath = ""
+	if keep {
+		if os.Rename(part, job.LocalPath+".part") == nil {
+			return
+		}
+	}
+	_ = os.Remove(part)
 }
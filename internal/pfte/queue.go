@@ -16,13 +16,105 @@
 
 package pfte
 
-import "sync"
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"fileripper/internal/network"
+)
 
 // TransferJob represents a single unit of work.
 type TransferJob struct {
 	LocalPath  string
 	RemotePath string
-	Operation  string // "UPLOAD" or "DOWNLOAD"
+	// Operation is "UPLOAD", "DOWNLOAD", or "REMOTE" (server-to-server;
+	// the source-side remote path rides in LocalPath).
+	Operation string
+
+	// Result is filled in by the worker that ran the job. Embedded by value
+	// so the hot path never allocates for it.
+	Result JobResult
+
+	// tried records the sessions this job already exhausted its retries on,
+	// so a requeued job lands on a different tunnel. Only the worker
+	// currently holding the job touches it — no lock needed.
+	tried map[*network.SftpSession]bool
+}
+
+// markTried notes that sess has had (and failed) its shot at this job.
+func (j *TransferJob) markTried(sess *network.SftpSession) {
+	if j.tried == nil {
+		j.tried = make(map[*network.SftpSession]bool)
+	}
+	j.tried[sess] = true
+}
+
+// hasTried reports whether sess already failed this job.
+func (j *TransferJob) hasTried(sess *network.SftpSession) bool {
+	return j.tried[sess]
+}
+
+// triedCount is how many distinct sessions have failed this job.
+func (j *TransferJob) triedCount() int {
+	return len(j.tried)
+}
+
+// JobResult records what actually happened to a job: the raw material for
+// reports, retry summaries and per-file progress.
+type JobResult struct {
+	Bytes     int64         // bytes that went over the wire (retries included)
+	Duration  time.Duration // wall time spent on the job
+	Checksum  string        // CRC32 of the streamed bytes (empty for multipart)
+	Attempts  int           // how many tries it took (1 = clean first run)
+	Session   string        // host that carried the file
+	Multipart bool          // true when the multipart swarm was used
+	FinalPath string        // where a download actually landed (collision policy may rename)
+	Err       error         // final error, nil on success
+
+	// PartialPath is the temp file a failed download attempt left behind
+	// ("" = none). It always points at a per-job ".fr-*.tmp" name, never
+	// the destination, so disposing of it can't touch anyone else's file.
+	PartialPath string
+}
+
+// The setters below are nil-safe so the transfer functions can be called
+// without a result sink (legacy wrappers, one-off helpers) at zero cost.
+
+func (r *JobResult) addAttempt() {
+	if r != nil {
+		r.Attempts++
+	}
+}
+
+func (r *JobResult) addBytes(n int64) {
+	if r != nil {
+		r.Bytes += n
+	}
+}
+
+func (r *JobResult) setChecksum(sum uint32) {
+	if r != nil {
+		r.Checksum = fmt.Sprintf("%x", sum)
+	}
+}
+
+func (r *JobResult) setPartialPath(path string) {
+	if r != nil {
+		r.PartialPath = path
+	}
+}
+
+func (r *JobResult) setFinalPath(path string) {
+	if r != nil {
+		r.FinalPath = path
+	}
+}
+
+func (r *JobResult) setMultipart() {
+	if r != nil {
+		r.Multipart = true
+	}
 }
 
 // JobQueue is a thread-safe queue for transfer jobs.
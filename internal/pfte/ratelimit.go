@@ -0,0 +1,222 @@
+/*
+ * Copyright 2026 The FileRipper Team
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package pfte
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// GlobalRateLimit caps total throughput across every worker. The default is
+// unlimited; a limit set here is shared — 64 workers collectively respect
+// one budget instead of each getting their own.
+var GlobalRateLimit = newRateLimiter()
+
+// SetRateLimit sets the base throughput cap in bytes/sec (0 = unlimited).
+// Safe to call mid-transfer; the new limit applies to the next chunk.
+func SetRateLimit(bytesPerSec int64) {
+	GlobalRateLimit.SetLimit(bytesPerSec)
+}
+
+// SetRateSchedule installs time-of-day throttling windows on top of the base
+// limit. Typical use: full speed overnight, a tight cap during office hours.
+func SetRateSchedule(windows []RateWindow) error {
+	return GlobalRateLimit.SetSchedule(windows)
+}
+
+// LoadRateSchedule reads a RateConfig from a JSON file and applies it:
+//
+//	{"limit": 0, "windows": [{"start": "09:00", "end": "17:30", "limit": 1048576}]}
+func LoadRateSchedule(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	var cfg RateConfig
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return fmt.Errorf("invalid rate config %s: %v", path, err)
+	}
+	if err := GlobalRateLimit.SetSchedule(cfg.Windows); err != nil {
+		return err
+	}
+	GlobalRateLimit.SetLimit(cfg.Limit)
+	return nil
+}
+
+// RateWindow is one schedule rule: between Start and End (local "HH:MM",
+// End before Start wraps past midnight) throughput is capped at Limit
+// bytes/sec. Limit 0 means unlimited inside the window. When windows
+// overlap, the last matching rule wins.
+type RateWindow struct {
+	Start string `json:"start"`
+	End   string `json:"end"`
+	Limit int64  `json:"limit"`
+}
+
+// RateConfig is the on-disk schedule format: a base limit (applied whenever
+// no window matches) plus the windows that override it.
+type RateConfig struct {
+	Limit   int64        `json:"limit"`
+	Windows []RateWindow `json:"windows"`
+}
+
+// rateWindow is a parsed RateWindow: minutes-of-day instead of strings, so
+// matching the wall clock is two comparisons.
+type rateWindow struct {
+	startMin int
+	endMin   int
+	limit    int64
+}
+
+func (w rateWindow) contains(minuteOfDay int) bool {
+	if w.startMin == w.endMin {
+		return true // degenerate window = all day
+	}
+	if w.startMin < w.endMin {
+		return minuteOfDay >= w.startMin && minuteOfDay < w.endMin
+	}
+	// Wraps midnight (e.g. 22:00–06:00).
+	return minuteOfDay >= w.startMin || minuteOfDay < w.endMin
+}
+
+// rateLimiter is a token bucket whose capacity can change under it: every
+// wait() re-resolves the effective limit from the schedule, so a transfer
+// running across a window boundary slows down (or speeds up) in place.
+type rateLimiter struct {
+	mu        sync.Mutex
+	baseLimit int64 // bytes/sec when no window matches, 0 = unlimited
+	windows   []rateWindow
+
+	tokens float64   // bytes currently available
+	last   time.Time // last refill
+}
+
+func newRateLimiter() *rateLimiter {
+	return &rateLimiter{}
+}
+
+func (l *rateLimiter) SetLimit(bytesPerSec int64) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.baseLimit = bytesPerSec
+	l.tokens = 0
+	l.last = time.Time{}
+}
+
+func (l *rateLimiter) SetSchedule(windows []RateWindow) error {
+	parsed := make([]rateWindow, 0, len(windows))
+	for _, w := range windows {
+		start, err := parseMinuteOfDay(w.Start)
+		if err != nil {
+			return fmt.Errorf("rate window start %q: %v", w.Start, err)
+		}
+		end, err := parseMinuteOfDay(w.End)
+		if err != nil {
+			return fmt.Errorf("rate window end %q: %v", w.End, err)
+		}
+		if w.Limit < 0 {
+			return fmt.Errorf("rate window limit must be >= 0, got %d", w.Limit)
+		}
+		parsed = append(parsed, rateWindow{startMin: start, endMin: end, limit: w.Limit})
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.windows = parsed
+	l.tokens = 0
+	l.last = time.Time{}
+	return nil
+}
+
+func parseMinuteOfDay(s string) (int, error) {
+	t, err := time.Parse("15:04", s)
+	if err != nil {
+		return 0, fmt.Errorf("expected HH:MM")
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+// effectiveLimit resolves the cap for a given moment: the last matching
+// window wins, otherwise the base limit applies.
+func (l *rateLimiter) effectiveLimit(now time.Time) int64 {
+	minute := now.Hour()*60 + now.Minute()
+	limit := l.baseLimit
+	for _, w := range l.windows {
+		if w.contains(minute) {
+			limit = w.limit
+		}
+	}
+	return limit
+}
+
+// wait blocks until n bytes fit in the current budget (or ctx is done).
+// With no limit in effect it returns immediately.
+func (l *rateLimiter) wait(ctx context.Context, n int64) error {
+	for n > 0 {
+		l.mu.Lock()
+		now := time.Now()
+		limit := l.effectiveLimit(now)
+		if limit <= 0 {
+			l.mu.Unlock()
+			return nil
+		}
+
+		// Refill since the last look, capping the burst at one second's
+		// worth so an idle pause doesn't bank an unlimited spike.
+		if !l.last.IsZero() {
+			l.tokens += now.Sub(l.last).Seconds() * float64(limit)
+		}
+		l.last = now
+		if l.tokens > float64(limit) {
+			l.tokens = float64(limit)
+		}
+
+		// A chunk bigger than one second's budget can never fit the bucket
+		// whole, so take it a bucket-sized piece at a time. Re-resolving the
+		// limit between pieces keeps schedule changes honored mid-chunk.
+		piece := n
+		if piece > limit {
+			piece = limit
+		}
+
+		if l.tokens >= float64(piece) {
+			l.tokens -= float64(piece)
+			n -= piece
+			l.mu.Unlock()
+			continue
+		}
+
+		// Sleep just long enough for the deficit to refill, then re-check:
+		// the effective limit may have changed by then.
+		deficit := float64(piece) - l.tokens
+		sleep := time.Duration(deficit / float64(limit) * float64(time.Second))
+		l.mu.Unlock()
+
+		if sleep > time.Second {
+			sleep = time.Second
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(sleep):
+		}
+	}
+	return nil
+}
@@ -0,0 +1,161 @@
+/*
+ * Copyright 2026 The FileRipper Team
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package pfte
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func at(hhmm string) time.Time {
+	t, err := time.Parse("15:04", hhmm)
+	if err != nil {
+		panic(err)
+	}
+	return t
+}
+
+func TestRateScheduleEffectiveLimit(t *testing.T) {
+	l := newRateLimiter()
+	l.SetLimit(0) // unlimited outside windows
+	err := l.SetSchedule([]RateWindow{
+		{Start: "09:00", End: "17:30", Limit: 1 << 20}, // office hours: 1 MB/s
+		{Start: "22:00", End: "06:00", Limit: 0},       // overnight: explicit full speed
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		clock string
+		want  int64
+	}{
+		{"08:59", 0},
+		{"09:00", 1 << 20},
+		{"12:00", 1 << 20},
+		{"17:29", 1 << 20},
+		{"17:30", 0},
+		{"23:00", 0}, // inside the midnight-wrapping window
+		{"03:00", 0},
+	}
+	for _, c := range cases {
+		if got := l.effectiveLimit(at(c.clock)); got != c.want {
+			t.Errorf("at %s: effectiveLimit = %d, want %d", c.clock, got, c.want)
+		}
+	}
+}
+
+func TestRateScheduleRejectsBadWindows(t *testing.T) {
+	l := newRateLimiter()
+	if err := l.SetSchedule([]RateWindow{{Start: "9am", End: "17:00"}}); err == nil {
+		t.Error("bad start time should be rejected")
+	}
+	if err := l.SetSchedule([]RateWindow{{Start: "09:00", End: "17:00", Limit: -1}}); err == nil {
+		t.Error("negative limit should be rejected")
+	}
+}
+
+func TestLoadRateSchedule(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "rate.json")
+	cfg := `{"limit": 2048, "windows": [{"start": "09:00", "end": "17:00", "limit": 1024}]}`
+	if err := os.WriteFile(path, []byte(cfg), 0644); err != nil {
+		t.Fatal(err)
+	}
+	defer SetRateLimit(0)
+	defer SetRateSchedule(nil)
+
+	if err := LoadRateSchedule(path); err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	if got := GlobalRateLimit.effectiveLimit(at("12:00")); got != 1024 {
+		t.Errorf("inside window: limit = %d, want 1024", got)
+	}
+	if got := GlobalRateLimit.effectiveLimit(at("20:00")); got != 2048 {
+		t.Errorf("outside window: limit = %d, want 2048", got)
+	}
+
+	if err := LoadRateSchedule(filepath.Join(t.TempDir(), "missing.json")); err == nil {
+		t.Error("missing file should error")
+	}
+}
+
+func TestMultipartUploadRespectsRateLimit(t *testing.T) {
+	sessions, root := startTestEnv(t, 1)
+
+	size := int64(128 << 10)
+	local := filepath.Join(t.TempDir(), "big.bin")
+	if err := os.WriteFile(local, bytes.Repeat([]byte("r"), int(size)), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	SetRateLimit(256 << 10) // the file is half a second of budget
+	defer SetRateLimit(0)
+
+	started := time.Now()
+	res := &JobResult{}
+	if err := uploadMultipart(context.Background(), sessions[0], local, "big.bin", size, false, res); err != nil {
+		t.Fatalf("multipart upload: %v", err)
+	}
+	elapsed := time.Since(started)
+
+	// The bucket starts empty, so 128 KiB at 256 KiB/s can't finish much
+	// under half a second. Only the lower bound is asserted — upper bounds
+	// are how timing tests go flaky.
+	if elapsed < 300*time.Millisecond {
+		t.Errorf("upload took %v; the shared limiter apparently wasn't consulted", elapsed)
+	}
+
+	got, err := os.ReadFile(filepath.Join(root, "big.bin"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if int64(len(got)) != size {
+		t.Errorf("uploaded %d bytes, want %d", len(got), size)
+	}
+}
+
+func TestWaitServesChunksLargerThanTheLimit(t *testing.T) {
+	l := newRateLimiter()
+	l.SetLimit(64 << 10) // one 128 KiB chunk is two seconds of budget
+
+	done := make(chan error, 1)
+	started := time.Now()
+	go func() { done <- l.wait(context.Background(), 128<<10) }()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("wait: %v", err)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("wait never returned for a chunk larger than the per-second budget")
+	}
+	if elapsed := time.Since(started); elapsed < time.Second {
+		t.Errorf("wait returned after %v; two seconds of budget shouldn't clear that fast", elapsed)
+	}
+
+	// Cancellation must still cut a long wait short.
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	if err := l.wait(ctx, 1<<20); err != context.DeadlineExceeded {
+		t.Errorf("cancelled wait returned %v, want context.DeadlineExceeded", err)
+	}
+}
@@ -0,0 +1,108 @@
+/*
+ * Copyright 2026 The FileRipper Team
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package pfte
+
+import (
+	"encoding/json"
+	"os"
+	"sync"
+)
+
+// stateSuffix is appended to the local file's path for the chunk journal.
+// It sits next to the source so it travels with the file and is trivially
+// discovered on the next run.
+const stateSuffix = ".fr-chunks"
+
+// multipartState journals which chunks of a multipart upload completed, so
+// a restart re-sends only the missing ones. For a 100GB file over a flaky
+// link that's the difference between re-sending 6GB and re-sending all of it.
+type multipartState struct {
+	Size      int64   `json:"size"`
+	ChunkSize int64   `json:"chunk_size"`
+	Done      []int64 `json:"done"` // completed chunk offsets
+
+	path string
+	mu   sync.Mutex
+}
+
+// loadMultipartState reads the sidecar for localPath, returning nil when it
+// doesn't exist or doesn't match the current file (size changed = stale).
+func loadMultipartState(localPath string, size, chunkSize int64) *multipartState {
+	data, err := os.ReadFile(localPath + stateSuffix)
+	if err != nil {
+		return nil
+	}
+	var st multipartState
+	if err := json.Unmarshal(data, &st); err != nil {
+		return nil
+	}
+	if st.Size != size || st.ChunkSize != chunkSize {
+		return nil
+	}
+	st.path = localPath + stateSuffix
+	return &st
+}
+
+func newMultipartState(localPath string, size, chunkSize int64) *multipartState {
+	st := &multipartState{
+		Size:      size,
+		ChunkSize: chunkSize,
+		path:      localPath + stateSuffix,
+	}
+	st.persist()
+	return st
+}
+
+func (st *multipartState) isDone(offset int64) bool {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	for _, o := range st.Done {
+		if o == offset {
+			return true
+		}
+	}
+	return false
+}
+
+func (st *multipartState) markDone(offset int64) {
+	st.mu.Lock()
+	st.Done = append(st.Done, offset)
+	st.mu.Unlock()
+	st.persist()
+}
+
+func (st *multipartState) reset() {
+	st.mu.Lock()
+	st.Done = nil
+	st.mu.Unlock()
+	st.persist()
+}
+
+func (st *multipartState) persist() {
+	st.mu.Lock()
+	data, err := json.Marshal(st)
+	st.mu.Unlock()
+	if err != nil {
+		return
+	}
+	// Best effort: losing the journal only costs a re-send, never data.
+	_ = os.WriteFile(st.path, data, 0644)
+}
+
+func (st *multipartState) remove() {
+	_ = os.Remove(st.path)
+}
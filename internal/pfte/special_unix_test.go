@@ -0,0 +1,58 @@
+//go:build !windows
+
+/*
+ * Copyright 2026 The FileRipper Team
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package pfte
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+)
+
+// A fifo in the source tree used to hang the worker that opened it. The
+// enumeration must skip it (visibly) and never block.
+func TestUploadEnumerationSkipsFifo(t *testing.T) {
+	src := t.TempDir()
+	if err := os.WriteFile(filepath.Join(src, "normal.txt"), []byte("x"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := syscall.Mkfifo(filepath.Join(src, "pipe"), 0644); err != nil {
+		t.Skipf("mkfifo not supported here: %v", err)
+	}
+
+	engine := NewEngine()
+	_, jobs, _, err := engine.enumerateUpload(src+"/", "up")
+	if err != nil {
+		t.Fatalf("enumerate: %v", err)
+	}
+	if len(jobs) != 1 || jobs[0].RemotePath != "up/normal.txt" {
+		t.Errorf("only the regular file should be queued, got %v", jobs)
+	}
+	if len(engine.SkippedSpecial) != 1 || !strings.HasSuffix(engine.SkippedSpecial[0], "pipe") {
+		t.Errorf("SkippedSpecial = %v, want the fifo", engine.SkippedSpecial)
+	}
+
+	// And the strict flavor refuses outright.
+	engine.FailOnSpecial = true
+	if _, _, _, err := engine.enumerateUpload(src+"/", "up"); err == nil ||
+		!strings.Contains(err.Error(), "special_file") {
+		t.Errorf("FailOnSpecial should error mentioning special_file, got %v", err)
+	}
+}
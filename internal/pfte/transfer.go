@@ -18,28 +18,60 @@ package pfte
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"hash"
 	"hash/crc32"
 	"io"
 	"os"
+	"path"
+	"strings"
 	"sync"
+	"syscall"
 	"time"
 
+	"fileripper/internal/core"
 	"fileripper/internal/network"
+
+	"github.com/pkg/sftp"
 )
 
-const (
-	BufferSize         = 64 * 1024        // 64KB for standard streams
-	MultipartThreshold = 10 * 1024 * 1024 // 10MB. Files larger than this get split.
-	MultipartChunks    = 16               // The user requested 16 chunks for the tail file.
+// Transfer tunables. Package-level because the workers, multipart planner,
+// and checksummers all share them; adjust via the client's construction
+// options rather than editing here.
+var (
+	BufferSize               = 64 * 1024        // 64KB for standard streams
+	MultipartThreshold int64 = 10 * 1024 * 1024 // 10MB. Files larger than this get split.
+
+	// AdaptiveBuffers lets each stream's copy buffer grow past BufferSize
+	// on links that keep it full (high-BDP pipes love big reads), and fall
+	// back when the link stalls. MaxBufferSize caps the growth.
+	AdaptiveBuffers = true
+	MaxBufferSize   = 1024 * 1024
 )
 
+// adaptiveGrowAfter is how many consecutive buffer-filling reads count as
+// "sustained" before the buffer doubles — one lucky read proves nothing.
+const adaptiveGrowAfter = 4
+
+// adaptiveStall is a single read slow enough to call the link stalled.
+const adaptiveStall = 250 * time.Millisecond
+
+const MultipartChunks = 16 // The user requested 16 chunks for the tail file.
+
 // ProgressTracker wraps an io.Reader to update monitor and compute hash simultaneously.
+// Build one with newProgressTracker so the configured HashMode applies, and
+// read the digest with Sum32 (see hashing.go).
 type ProgressTracker struct {
 	Reader io.Reader
-	Hasher hash.Hash32
+	Hasher hash.Hash32 // nil when hashing is off
 	// Lock needed because multiple chunks might update metrics concurrently
 	Mu sync.Mutex
+
+	// Async mode: buffers travel to a dedicated hashing goroutine so the
+	// network read never blocks on the digest.
+	hashCh   chan []byte
+	hashDone chan struct{}
 }
 
 func (pt *ProgressTracker) Read(p []byte) (int, error) {
@@ -47,62 +79,510 @@ func (pt *ProgressTracker) Read(p []byte) (int, error) {
 	if n > 0 {
 		GlobalMonitor.AddBytes(int64(n))
 
-		// Hasher is not thread-safe, so if we used this in multipart we'd need locking.
-		// For multipart, we might skip hashing or handle it differently.
-		// For now, we lock just in case.
-		pt.Mu.Lock()
-		pt.Hasher.Write(p[:n])
-		pt.Mu.Unlock()
+		switch {
+		case pt.Hasher == nil:
+			// Hashing is off for this transfer.
+		case pt.hashCh != nil:
+			// The hashing goroutine owns the hasher; hand it a copy (the
+			// copy loop will reuse p before the hash catches up).
+			b := make([]byte, n)
+			copy(b, p[:n])
+			pt.hashCh <- b
+		default:
+			// Hasher is not thread-safe, so if we used this in multipart we'd need locking.
+			// For multipart, we might skip hashing or handle it differently.
+			// For now, we lock just in case.
+			pt.Mu.Lock()
+			pt.Hasher.Write(p[:n])
+			pt.Mu.Unlock()
+		}
 	}
 	return n, err
 }
 
+// MismatchPolicy decides what happens when a downloaded file fails its
+// checksum verification.
+type MismatchPolicy int
+
+const (
+	// MismatchRetry re-transfers the file, then fails if it keeps
+	// mismatching (the default).
+	MismatchRetry MismatchPolicy = iota
+	// MismatchFail aborts the file immediately and reports it.
+	MismatchFail
+	// MismatchQuarantine moves the bad file aside (.corrupt) and continues.
+	MismatchQuarantine
+	// MismatchKeep records a warning but accepts the file as-is.
+	MismatchKeep
+)
+
+func (p MismatchPolicy) String() string {
+	switch p {
+	case MismatchFail:
+		return "fail"
+	case MismatchQuarantine:
+		return "quarantine"
+	case MismatchKeep:
+		return "keep"
+	default:
+		return "retry"
+	}
+}
+
+// isQuotaErr recognizes "the destination is full" failures. SFTPv3 has no
+// dedicated status code for quota, so servers ship it as a generic
+// sftp.StatusError whose message names the real problem; we also catch the
+// classic POSIX phrasing for servers that pass it through verbatim.
+func isQuotaErr(err error) bool {
+	if err == nil {
+		return false
+	}
+	var st *sftp.StatusError
+	msg := strings.ToLower(err.Error())
+	if errors.As(err, &st) || strings.HasPrefix(msg, "sftp:") {
+		return strings.Contains(msg, "quota") || strings.Contains(msg, "no space") ||
+			strings.Contains(msg, "disk full")
+	}
+	return strings.Contains(msg, "quota exceeded") || strings.Contains(msg, "no space left")
+}
+
+// isLocalDiskFullErr is the local-side twin of isQuotaErr: the OS tells us
+// straight via ENOSPC, but wrapped errors sometimes only keep the message.
+func isLocalDiskFullErr(err error) bool {
+	if err == nil {
+		return false
+	}
+	if errors.Is(err, syscall.ENOSPC) {
+		return true
+	}
+	return strings.Contains(strings.ToLower(err.Error()), "no space left on device")
+}
+
 // DownloadFileWithProgress pulls a remote file safely.
-func DownloadFileWithProgress(ctx context.Context, session *network.SftpSession, remotePath, localPath string) error {
+func DownloadFileWithProgress(ctx context.Context, session *network.SftpSession, remotePath, localPath string, res *JobResult) error {
 	var lastErr error
-	buf := make([]byte, BufferSize)
+
+	// Big files get the multipart swarm, mirroring the upload side; any
+	// worker failure falls back silently to the single stream below.
+	if st, err := session.Stat(remotePath); err == nil && st.Size() >= MultipartThreshold {
+		res.addAttempt()
+		err := downloadMultipart(ctx, session, remotePath, localPath, st.Size(), res)
+		if err == nil {
+			res.setMultipart()
+			return nil
+		}
+		if isLocalDiskFullErr(err) {
+			return core.ErrLocalDiskFull
+		}
+	}
 
 	for attempt := 1; attempt <= 3; attempt++ {
-		lastErr = func() error {
-			src, err := session.SftpClient.Open(remotePath)
-			if err != nil {
-				return err
-			}
-			defer src.Close()
+		res.addAttempt()
+		var sum uint32
+		sum, lastErr = downloadOnce(ctx, session, remotePath, localPath, res)
+		if lastErr == nil {
+			res.setChecksum(sum)
+			return nil
+		}
+		if isLocalDiskFullErr(lastErr) {
+			// Retrying can't conjure up disk space, and neither can the next
+			// file in the queue. Surface the real problem once.
+			return core.ErrLocalDiskFull
+		}
+		GlobalMonitor.AddRetry(remotePath)
+	}
+	return lastErr
+}
 
-			dst, err := os.Create(localPath)
-			if err != nil {
-				return err
+// DownloadFileVerified downloads and then re-reads the local file, comparing
+// its checksum to the one streamed during transfer. What happens on a
+// mismatch is up to the policy.
+func DownloadFileVerified(ctx context.Context, session *network.SftpSession, remotePath, localPath string, policy MismatchPolicy, res *JobResult) error {
+	var lastErr error
+
+	for attempt := 1; attempt <= 3; attempt++ {
+		res.addAttempt()
+		var streamed uint32
+		streamed, lastErr = downloadOnce(ctx, session, remotePath, localPath, res)
+		if lastErr != nil {
+			if isLocalDiskFullErr(lastErr) {
+				return core.ErrLocalDiskFull
 			}
-			defer dst.Close()
+			GlobalMonitor.AddRetry(remotePath)
+			continue
+		}
+
+		if currentHashMode() == HashOff {
+			// Nothing was hashed on the wire, so there's nothing to verify
+			// against. The user opted out; don't fake a comparison.
+			return nil
+		}
+
+		landed := localPath
+		if res != nil && res.FinalPath != "" {
+			landed = res.FinalPath
+		}
+		onDisk, err := CalculateChecksum(landed)
+		if err != nil {
+			lastErr = err
+			GlobalMonitor.AddRetry(remotePath)
+			continue
+		}
+		if onDisk == fmt.Sprintf("%x", streamed) {
+			res.setChecksum(streamed)
+			return nil
+		}
+
+		// Checksum mismatch: act per policy.
+		GlobalMonitor.RecordMismatch(landed, policy.String())
+		switch policy {
+		case MismatchKeep:
+			return nil
+		case MismatchQuarantine:
+			_ = os.Rename(landed, landed+".corrupt")
+			return nil
+		case MismatchFail:
+			_ = os.Remove(landed)
+			return core.ErrChecksumMismatch
+		default: // MismatchRetry: scrap it and go again
+			_ = os.Remove(landed)
+			lastErr = core.ErrChecksumMismatch
+			GlobalMonitor.AddRetry(remotePath)
+		}
+	}
+	return lastErr
+}
+
+// downloadOnce performs a single download attempt, returning the CRC32 of
+// the bytes that went over the wire. The bytes go to a uniquely-suffixed temp
+// file first and only move to localPath once complete, so two workers aimed
+// at the same name can never interleave writes; where they actually landed is
+// recorded in res.FinalPath (the collision policy may pick a different name).
+// downloadMultipart mirrors uploadMultipart for the pull direction: the
+// local temp file is pre-allocated at full size, and N workers each Seek a
+// byte range on their own remote handle and WriteAt it into place. Chunk
+// checksums are combined positionally so the result matches a single
+// stream's, and verified against a re-read before the rename.
+func downloadMultipart(ctx context.Context, session *network.SftpSession, remotePath, localPath string, size int64, res *JobResult) error {
+	chunkSize := size / int64(MultipartChunks)
+	chunks := planChunks(size, chunkSize, MultipartChunks)
+
+	tmpPath := tempDownloadPath(localPath)
+	dst, err := os.Create(tmpPath)
+	if err != nil {
+		return err
+	}
+	if err := dst.Truncate(size); err != nil {
+		dst.Close()
+		_ = os.Remove(tmpPath)
+		return err
+	}
+
+	hashing := currentHashMode() != HashOff
+	chunkSums := make([]uint32, len(chunks))
+
+	var wg sync.WaitGroup
+	errChan := make(chan error, len(chunks))
+
+	for i, c := range chunks {
+		wg.Add(1)
+		go func(idx int, offset, length int64) {
+			defer wg.Done()
 
-			tracker := &ProgressTracker{
-				Reader: src,
-				Hasher: crc32.NewIEEE(),
+			if err := GlobalFDLimit.acquire(ctx); err != nil {
+				errChan <- err
+				return
 			}
+			defer GlobalFDLimit.release()
 
-			// (We use a custom copy loop to support context cancellation)
-			_, err = copyWithContext(ctx, dst, tracker, buf)
+			// Own handle per worker: Seek positions are per-handle state.
+			src, err := session.Open(remotePath)
 			if err != nil {
-				return err
+				errChan <- err
+				return
+			}
+			defer src.Close()
+			if _, err := src.Seek(offset, io.SeekStart); err != nil {
+				errChan <- err
+				return
 			}
 
-			// Preserve mtime if possible
-			if stat, err := session.SftpClient.Stat(remotePath); err == nil {
-				_ = os.Chtimes(localPath, time.Now(), stat.ModTime())
+			var chunkSum uint32
+			buf := make([]byte, 32*1024)
+			remaining := length
+			for remaining > 0 {
+				select {
+				case <-ctx.Done():
+					errChan <- ctx.Err()
+					return
+				default:
+				}
+
+				want := int64(len(buf))
+				if remaining < want {
+					want = remaining
+				}
+				nr, readErr := src.Read(buf[:want])
+				if nr > 0 {
+					if err := GlobalRateLimit.wait(ctx, int64(nr)); err != nil {
+						errChan <- err
+						return
+					}
+					if _, werr := dst.WriteAt(buf[:nr], offset+(length-remaining)); werr != nil {
+						errChan <- werr
+						return
+					}
+					remaining -= int64(nr)
+					GlobalMonitor.AddBytes(int64(nr))
+					res.addBytes(int64(nr))
+					if hashing {
+						chunkSum = crc32.Update(chunkSum, crc32.IEEETable, buf[:nr])
+					}
+				}
+				if readErr != nil {
+					if readErr == io.EOF && remaining == 0 {
+						break
+					}
+					errChan <- readErr
+					return
+				}
 			}
-			return nil
-		}()
+			chunkSums[idx] = chunkSum
+		}(i, c.offset, c.length)
+	}
+
+	wg.Wait()
+	close(errChan)
+
+	if len(errChan) > 0 {
+		err := <-errChan
+		dst.Close()
+		// A sparse, hole-riddled partial is useless to the single-stream
+		// fallback — scrap it rather than leave a mystery file around.
+		_ = os.Remove(tmpPath)
+		return err
+	}
+	if err := dst.Close(); err != nil {
+		_ = os.Remove(tmpPath)
+		return err
+	}
+
+	if hashing {
+		var combined uint32
+		for i, c := range chunks {
+			combined = crc32CombineIEEE(combined, chunkSums[i], c.length)
+		}
+		onDisk, err := CalculateChecksum(tmpPath)
+		if err != nil {
+			_ = os.Remove(tmpPath)
+			return err
+		}
+		if onDisk != fmt.Sprintf("%x", combined) {
+			_ = os.Remove(tmpPath)
+			return core.ErrChecksumMismatch
+		}
+		res.setChecksum(combined)
+	}
+
+	if stat, err := session.Stat(remotePath); err == nil {
+		_ = os.Chtimes(tmpPath, time.Now(), stat.ModTime())
+	}
+	finalPath, err := finalizeDownload(tmpPath, localPath, res)
+	if err != nil {
+		return err
+	}
+	res.setFinalPath(finalPath)
+	return nil
+}
 
+func downloadOnce(ctx context.Context, session *network.SftpSession, remotePath, localPath string, res *JobResult) (uint32, error) {
+	if err := GlobalFDLimit.acquire(ctx); err != nil {
+		return 0, err
+	}
+	defer GlobalFDLimit.release()
+
+	buf := make([]byte, BufferSize)
+
+	src, err := session.Open(remotePath)
+	if err != nil {
+		return 0, err
+	}
+	defer src.Close()
+
+	tmpPath := tempDownloadPath(localPath)
+	dst, err := os.Create(tmpPath)
+	if err != nil {
+		return 0, err
+	}
+
+	tracker := newProgressTracker(src)
+
+	// (We use a custom copy loop to support context cancellation)
+	written, err := copyWithContext(ctx, dst, tracker, buf)
+	res.addBytes(written)
+	if closeErr := dst.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		// Park the partial under its own temp name for the retry/KeepPartial
+		// machinery. The real name must never see truncated bytes — a reader
+		// could pick them up mid-retry, and a kill between attempts would
+		// leave them there for good. Disk-full partials just go away: nobody
+		// can grow them anyway.
+		if res == nil || isLocalDiskFullErr(err) || pathClaimedByOther(localPath, res) {
+			_ = os.Remove(tmpPath)
+		} else {
+			if prev := res.PartialPath; prev != "" {
+				_ = os.Remove(prev)
+			}
+			res.setPartialPath(tmpPath)
+		}
+		return 0, err
+	}
+
+	// Preserve mtime if possible (the rename below keeps it)
+	if stat, err := session.Stat(remotePath); err == nil {
+		_ = os.Chtimes(tmpPath, time.Now(), stat.ModTime())
+	}
+
+	finalPath, err := finalizeDownload(tmpPath, localPath, res)
+	if err != nil {
+		return 0, err
+	}
+	// A partial parked by an earlier failed attempt is obsolete now.
+	if res != nil && res.PartialPath != "" {
+		_ = os.Remove(res.PartialPath)
+		res.setPartialPath("")
+	}
+	res.setFinalPath(finalPath)
+	return tracker.Sum32(), nil
+}
+
+// partSuffix marks a resumable partial download, namespaced like our other
+// sidecars (.fr-chunks, .fr-xattr) so it never collides with user data.
+const partSuffix = ".fr-part"
+
+// DownloadFileResumable is DownloadFileWithProgress with byte-level resume:
+// an interrupted download leaves its partial at localPath + ".fr-part", and
+// the next run (or the next retry of this one) appends from where it
+// stopped instead of starting over. The streamed checksum only covers what
+// this run transferred, so resumed downloads report no checksum — pair with
+// verification when integrity matters more than the saved bytes.
+func DownloadFileResumable(ctx context.Context, session *network.SftpSession, remotePath, localPath string, res *JobResult) error {
+	var lastErr error
+
+	for attempt := 1; attempt <= 3; attempt++ {
+		res.addAttempt()
+		lastErr = downloadResumeOnce(ctx, session, remotePath, localPath, res)
 		if lastErr == nil {
 			return nil
 		}
+		if isLocalDiskFullErr(lastErr) {
+			return core.ErrLocalDiskFull
+		}
+		// The partial survives between attempts: each retry continues the
+		// download rather than re-fetching what already landed.
+		GlobalMonitor.AddRetry(remotePath)
 	}
 	return lastErr
 }
 
+func downloadResumeOnce(ctx context.Context, session *network.SftpSession, remotePath, localPath string, res *JobResult) error {
+	if err := GlobalFDLimit.acquire(ctx); err != nil {
+		return err
+	}
+	defer GlobalFDLimit.release()
+
+	stat, err := session.Stat(remotePath)
+	if err != nil {
+		return err
+	}
+
+	partPath := localPath + partSuffix
+	var offset int64
+	if pst, err := os.Stat(partPath); err == nil {
+		switch {
+		case pst.Size() > stat.Size():
+			// The remote shrank since the partial was written — whatever we
+			// have can't be a prefix of it. Start over.
+			_ = os.Remove(partPath)
+		default:
+			offset = pst.Size()
+		}
+	}
+
+	if offset < stat.Size() {
+		src, err := session.Open(remotePath)
+		if err != nil {
+			return err
+		}
+		defer src.Close()
+		if offset > 0 {
+			if _, err := src.Seek(offset, io.SeekStart); err != nil {
+				return err
+			}
+			// The bytes already on disk count as progress, or the dashboard
+			// would sit at a misleading zero for a mostly-done file.
+			GlobalMonitor.AddBytes(offset)
+		}
+
+		dst, err := os.OpenFile(partPath, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+		if err != nil {
+			return err
+		}
+
+		tracker := newProgressTracker(src)
+		buf := make([]byte, BufferSize)
+		written, err := copyWithContext(ctx, dst, tracker, buf)
+		res.addBytes(written)
+		if closeErr := dst.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			// Keep the partial — resuming it is the whole point — except
+			// when the disk filled up and nobody can grow it anyway.
+			if isLocalDiskFullErr(err) || pathClaimedByOther(localPath, res) {
+				_ = os.Remove(partPath)
+			}
+			return err
+		}
+	} else {
+		// The partial already holds every byte; only the rename is left.
+		GlobalMonitor.AddBytes(offset)
+	}
+
+	_ = os.Chtimes(partPath, time.Now(), stat.ModTime())
+	finalPath, err := finalizeDownload(partPath, localPath, res)
+	if err != nil {
+		return err
+	}
+	res.setFinalPath(finalPath)
+	return nil
+}
+
 // UploadFileWithProgress decides whether to use Single Stream or Multipart Swarm.
-func UploadFileWithProgress(ctx context.Context, session *network.SftpSession, localPath, remotePath string) error {
+func UploadFileWithProgress(ctx context.Context, session *network.SftpSession, localPath, remotePath string, res *JobResult) error {
+	return uploadFile(ctx, session, localPath, remotePath, false, res)
+}
+
+// UploadFileResumable is UploadFileWithProgress with per-chunk resume: an
+// interrupted multipart upload re-sends only the chunks that never finished.
+func UploadFileResumable(ctx context.Context, session *network.SftpSession, localPath, remotePath string, res *JobResult) error {
+	return uploadFile(ctx, session, localPath, remotePath, true, res)
+}
+
+// uploadTmpSuffix marks an upload still in flight. The real remotePath only
+// ever appears via rename, so downstream consumers never see half a file.
+const uploadTmpSuffix = ".fr-tmp"
+
+// promoteUpload moves a finished temp upload into place. SFTP's rename
+// refuses to overwrite on many servers, so any previous file goes first.
+func promoteUpload(session *network.SftpSession, tmpPath, remotePath string) error {
+	_ = session.Remove(remotePath)
+	return session.Rename(tmpPath, remotePath)
+}
+
+func uploadFile(ctx context.Context, session *network.SftpSession, localPath, remotePath string, resume bool, res *JobResult) error {
 	// 1. Check file size
 	info, err := os.Stat(localPath)
 	if err != nil {
@@ -110,28 +590,50 @@ func UploadFileWithProgress(ctx context.Context, session *network.SftpSession, l
 	}
 	fileSize := info.Size()
 
+	// Everything lands at a temp sibling first; remotePath itself changes
+	// only on the final rename.
+	tmpPath := remotePath + uploadTmpSuffix
+
 	// 2. Decision Matrix
 	if fileSize >= MultipartThreshold {
 		// Try Multipart upload for large files to kill the "tail effect"
-		err := uploadMultipart(ctx, session, localPath, remotePath, fileSize)
+		res.addAttempt()
+		err := uploadMultipart(ctx, session, localPath, tmpPath, fileSize, resume, res)
 		if err == nil {
+			if err := promoteUpload(session, tmpPath, remotePath); err != nil {
+				return err
+			}
+			res.setMultipart()
 			return nil
 		}
+		if isQuotaErr(err) {
+			// A full disk won't fit the file single-stream either. Scrap the
+			// partial so the user isn't left with a truncated mystery file.
+			_ = session.Remove(tmpPath)
+			return core.ErrQuotaExceeded
+		}
 		// If multipart fails (e.g. server locks file), fall back silently to single stream
 		// fmt.Printf(">> Turbo Failed (%v). Reverting to single stream.\n", err)
 	}
 
 	// 3. Fallback / Standard Upload
-	return uploadSingleStream(ctx, session, localPath, remotePath)
+	return uploadSingleStream(ctx, session, localPath, remotePath, res)
 }
 
 // uploadSingleStream is the robust, standard upload logic.
-func uploadSingleStream(ctx context.Context, session *network.SftpSession, localPath, remotePath string) error {
+func uploadSingleStream(ctx context.Context, session *network.SftpSession, localPath, remotePath string, res *JobResult) error {
 	var lastErr error
 	buf := make([]byte, BufferSize)
+	tmpPath := remotePath + uploadTmpSuffix
 
 	for attempt := 1; attempt <= 3; attempt++ {
+		res.addAttempt()
 		lastErr = func() error {
+			if err := GlobalFDLimit.acquire(ctx); err != nil {
+				return err
+			}
+			defer GlobalFDLimit.release()
+
 			src, err := os.Open(localPath)
 			if err != nil {
 				return err
@@ -143,67 +645,376 @@ func uploadSingleStream(ctx context.Context, session *network.SftpSession, local
 				return err
 			}
 
-			dst, err := session.SftpClient.Create(remotePath)
+			dst, err := createWithParents(session, tmpPath)
 			if err != nil {
 				return err
 			}
 			defer dst.Close()
 
-			tracker := &ProgressTracker{
-				Reader: src,
-				Hasher: crc32.NewIEEE(),
-			}
+			tracker := newProgressTracker(src)
 
-			_, err = copyWithContext(ctx, dst, tracker, buf)
+			written, err := copyWithContext(ctx, dst, tracker, buf)
+			res.addBytes(written)
 			if err != nil {
 				return err
 			}
+			res.setChecksum(tracker.Sum32())
 
-			// Sync timestamps and permissions
-			_ = session.SftpClient.Chtimes(remotePath, time.Now(), info.ModTime())
-			_ = session.SftpClient.Chmod(remotePath, info.Mode())
+			// Sync timestamps and permissions while the file is still ours
+			_ = session.Chtimes(tmpPath, time.Now(), info.ModTime())
+			_ = session.Chmod(tmpPath, info.Mode())
 
-			return nil
+			// Everything's in place: one rename makes it visible.
+			return promoteUpload(session, tmpPath, remotePath)
 		}()
 
 		if lastErr == nil {
 			break
 		}
+		if isQuotaErr(lastErr) {
+			// Retrying won't free space — stop immediately, remove the
+			// partial, and report the real problem instead of "flaky network".
+			_ = session.Remove(tmpPath)
+			return core.ErrQuotaExceeded
+		}
+		GlobalMonitor.AddRetry(remotePath)
+	}
+	if lastErr != nil {
+		// Nobody is coming back for this temp file.
+		_ = session.Remove(tmpPath)
+	}
+	return lastErr
+}
+
+// CopyRemoteWithProgress streams one file straight from the src session
+// into the dst session — remote to remote, no local staging, so the bytes
+// cross the wire once instead of twice. Same atomicity as uploads: they
+// land at dstPath + ".fr-tmp" and one rename makes them visible. The
+// recorded checksum is of the bytes as they passed through.
+func CopyRemoteWithProgress(ctx context.Context, src, dst *network.SftpSession, srcPath, dstPath string, res *JobResult) error {
+	var lastErr error
+	buf := make([]byte, BufferSize)
+	tmpPath := dstPath + uploadTmpSuffix
+
+	for attempt := 1; attempt <= 3; attempt++ {
+		res.addAttempt()
+		lastErr = func() error {
+			if err := GlobalFDLimit.acquire(ctx); err != nil {
+				return err
+			}
+			defer GlobalFDLimit.release()
+
+			from, err := src.Open(srcPath)
+			if err != nil {
+				return err
+			}
+			defer from.Close()
+
+			info, err := src.Stat(srcPath)
+			if err != nil {
+				return err
+			}
+
+			to, err := createWithParents(dst, tmpPath)
+			if err != nil {
+				return err
+			}
+			defer to.Close()
+
+			tracker := newProgressTracker(from)
+
+			written, err := copyWithContext(ctx, to, tracker, buf)
+			res.addBytes(written)
+			if err != nil {
+				return err
+			}
+			res.setChecksum(tracker.Sum32())
+
+			// Carry the source's timestamps and mode across while the file
+			// is still ours.
+			_ = dst.Chtimes(tmpPath, time.Now(), info.ModTime())
+			_ = dst.Chmod(tmpPath, info.Mode())
+
+			return promoteUpload(dst, tmpPath, dstPath)
+		}()
+
+		if lastErr == nil {
+			return nil
+		}
+		if isQuotaErr(lastErr) {
+			// The destination is full; retrying won't change that.
+			_ = dst.Remove(tmpPath)
+			return core.ErrQuotaExceeded
+		}
+		GlobalMonitor.AddRetry(srcPath)
 	}
+	// Nobody is coming back for this temp file.
+	_ = dst.Remove(tmpPath)
 	return lastErr
 }
 
+// AppendFile ships only the local bytes beyond what the remote already has,
+// opening the remote with O_APPEND — the log-shipping primitive. The remote
+// size is the offset (no sidecar to lose); a remote larger than the local
+// file means the file was rotated or replaced, which is reported rather than
+// guessed at. Distinct from resume: resume rebuilds an identical file, this
+// follows append-only growth.
+func AppendFile(ctx context.Context, session *network.SftpSession, localPath, remotePath string, res *JobResult) error {
+	if err := GlobalFDLimit.acquire(ctx); err != nil {
+		return err
+	}
+	defer GlobalFDLimit.release()
+	res.addAttempt()
+
+	src, err := os.Open(localPath)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	info, err := src.Stat()
+	if err != nil {
+		return err
+	}
+
+	offset := int64(0)
+	if rst, err := session.Stat(remotePath); err == nil {
+		offset = rst.Size()
+	}
+	if offset > info.Size() {
+		return fmt.Errorf("remote_ahead_of_local: %s has %d bytes remotely but %d locally (rotated?)",
+			remotePath, offset, info.Size())
+	}
+	if offset == info.Size() {
+		return nil // nothing new to ship
+	}
+	if _, err := src.Seek(offset, io.SeekStart); err != nil {
+		return err
+	}
+
+	dst, err := session.OpenFile(remotePath, os.O_WRONLY|os.O_CREATE|os.O_APPEND)
+	if err != nil {
+		return err
+	}
+	defer dst.Close()
+
+	// pkg/sftp writes at its own tracked offset (starting at 0) rather than
+	// honoring O_APPEND for plain Writes, so position the handle explicitly.
+	if _, err := dst.Seek(offset, io.SeekStart); err != nil {
+		return err
+	}
+
+	tracker := newProgressTracker(src)
+
+	buf := make([]byte, BufferSize)
+	written, err := copyWithContext(ctx, dst, tracker, buf)
+	res.addBytes(written)
+	if err != nil {
+		if isQuotaErr(err) {
+			return core.ErrQuotaExceeded
+		}
+		return err
+	}
+	res.setChecksum(tracker.Sum32())
+	return nil
+}
+
+// chunkRange is one slice of a multipart upload: offset into the file and
+// how many bytes belong to this chunk.
+type chunkRange struct {
+	offset int64
+	length int64
+}
+
+// planChunks splits size bytes into at most count contiguous ranges of
+// chunkSize bytes, the final one absorbing the remainder of the integer
+// division. Guarantees: no zero-length chunk ever comes back, the ranges
+// cover the file exactly once, and a size too small to split produces a
+// single full-file range. Off-by-one math here corrupts files, hence the
+// paranoia (and the tests).
+func planChunks(size, chunkSize int64, count int) []chunkRange {
+	if size <= 0 || count <= 0 {
+		return nil
+	}
+	if chunkSize <= 0 {
+		return []chunkRange{{offset: 0, length: size}}
+	}
+	ranges := make([]chunkRange, 0, count)
+	for i := 0; i < count; i++ {
+		start := int64(i) * chunkSize
+		end := start + chunkSize
+		if i == count-1 {
+			end = size // last chunk takes the remainder
+		}
+		if end > size {
+			end = size
+		}
+		if end <= start {
+			continue // nothing left for this worker
+		}
+		ranges = append(ranges, chunkRange{offset: start, length: end - start})
+	}
+	return ranges
+}
+
+// resumeVerifyBytes caps how much of the remote partial gets re-read before
+// a resume: enough to catch a foreign writer, cheap enough to not negate the
+// point of resuming.
+const resumeVerifyBytes = 1 << 20
+
+// resumePrefixIntact checks that the first bytes of the remote partial still
+// equal the local file's, comparing CRC32s over min(remoteSize, the verify
+// cap). Any doubt — read error, mismatch — returns false: restarting from
+// zero is always safe, appending to a stranger's bytes never is.
+func resumePrefixIntact(ctx context.Context, session *network.SftpSession, localPath, remotePath string, remoteSize int64) bool {
+	n := remoteSize
+	if n > resumeVerifyBytes {
+		n = resumeVerifyBytes
+	}
+
+	local, err := os.Open(localPath)
+	if err != nil {
+		return false
+	}
+	defer local.Close()
+	remote, err := session.Open(remotePath)
+	if err != nil {
+		return false
+	}
+	defer remote.Close()
+
+	buf := make([]byte, BufferSize)
+	localSum := crc32.NewIEEE()
+	if _, err := copyWithContext(ctx, localSum, io.LimitReader(local, n), buf); err != nil {
+		return false
+	}
+	remoteSum := crc32.NewIEEE()
+	if _, err := copyWithContext(ctx, remoteSum, io.LimitReader(remote, n), buf); err != nil {
+		return false
+	}
+	return localSum.Sum32() == remoteSum.Sum32()
+}
+
+// isNotExistErr matches both the local flavor and the strings SFTP servers
+// send for a missing path.
+func isNotExistErr(err error) bool {
+	if err == nil {
+		return false
+	}
+	if errors.Is(err, os.ErrNotExist) {
+		return true
+	}
+	return strings.Contains(strings.ToLower(err.Error()), "no such file")
+}
+
+// createWithParents opens remotePath for writing, and when the open fails
+// because the parent directory doesn't exist, creates the parents and tries
+// once more. The pre-creation phase covers the normal case; this covers its
+// gaps — a partially failed phase, or directories only discovered through
+// symlink resolution.
+func createWithParents(session *network.SftpSession, remotePath string) (network.RemoteFile, error) {
+	dst, err := session.Create(remotePath)
+	if err == nil || !isNotExistErr(err) {
+		return dst, err
+	}
+	dir := path.Dir(remotePath)
+	if dir == "." || dir == "/" {
+		return nil, err
+	}
+	if mkErr := session.MkdirAll(dir); mkErr != nil {
+		return nil, err // report the original failure, not the fallout
+	}
+	return session.Create(remotePath)
+}
+
 // uploadMultipart splits the file and uploads parts in parallel.
-func uploadMultipart(ctx context.Context, session *network.SftpSession, localPath, remotePath string, size int64) error {
+// With resume on, completed chunk offsets are journaled in a sidecar file so
+// a restarted upload only re-sends what never finished.
+func uploadMultipart(ctx context.Context, session *network.SftpSession, localPath, remotePath string, size int64, resume bool, res *JobResult) error {
 	// Calculate chunk size
 	chunkSize := size / int64(MultipartChunks)
+	chunks := planChunks(size, chunkSize, MultipartChunks)
 
-	// Create the remote file once to ensure it exists and is truncated
-	f, err := session.SftpClient.Create(remotePath)
-	if err != nil {
-		return err
+	var state *multipartState
+	if resume {
+		state = loadMultipartState(localPath, size, chunkSize)
+	}
+
+	if state == nil {
+		// Fresh run: create the remote file once to ensure it exists and is truncated
+		f, err := createWithParents(session, remotePath)
+		if err != nil {
+			return err
+		}
+		f.Close() // Close it, workers will open their own handles
+
+		if resume {
+			state = newMultipartState(localPath, size, chunkSize)
+		}
+	} else {
+		// Resuming: the remote partial must still be plausible AND still be
+		// ours — someone else writing to the file since the interrupted run
+		// means blindly continuing would corrupt it. Length first (free),
+		// then a checksum of the remote prefix against the local bytes.
+		st, err := session.Stat(remotePath)
+		intact := err == nil && st.Size() <= size
+		if intact && st.Size() > 0 {
+			intact = resumePrefixIntact(ctx, session, localPath, remotePath, st.Size())
+		}
+		if !intact {
+			state.reset()
+			f, err := session.Create(remotePath)
+			if err != nil {
+				return err
+			}
+			f.Close()
+		}
 	}
-	f.Close() // Close it, workers will open their own handles
 
 	var wg sync.WaitGroup
-	errChan := make(chan error, MultipartChunks)
+	errChan := make(chan error, len(chunks))
+
+	// Per-chunk checksums, combined positionally after the swarm finishes
+	// so the result equals what a single stream would have hashed.
+	hashing := currentHashMode() != HashOff
+	chunkSums := make([]uint32, len(chunks))
 
-	// Launch 16 mini-workers
-	for i := 0; i < MultipartChunks; i++ {
+	// Launch the mini-workers, one per chunk
+	for i, c := range chunks {
 		wg.Add(1)
 
-		start := int64(i) * chunkSize
-		end := start + chunkSize
-		if i == MultipartChunks-1 {
-			end = size // Last chunk takes the remainder
+		if state != nil && state.isDone(c.offset) {
+			GlobalMonitor.AddBytes(c.length) // already on the wire last run
+			if !hashing {
+				wg.Done()
+				continue
+			}
+			// The bytes went up in an earlier run; hash the local range so
+			// the combined checksum still covers the whole file.
+			go func(idx int, offset, length int64) {
+				defer wg.Done()
+				sum, err := crcOfLocalRange(localPath, offset, length)
+				if err != nil {
+					errChan <- err
+					return
+				}
+				chunkSums[idx] = sum
+			}(i, c.offset, c.length)
+			continue
 		}
 
-		go func(offset, length int64) {
+		go func(idx int, offset, length int64) {
 			defer wg.Done()
 
+			if err := GlobalFDLimit.acquire(ctx); err != nil {
+				errChan <- err
+				return
+			}
+			defer GlobalFDLimit.release()
+
 			// Each worker needs its own file handle for thread safety on Seek
 			// NOTE: Some SFTP servers dislike multiple handles to the same file.
-			remoteFile, err := session.SftpClient.OpenFile(remotePath, os.O_WRONLY)
+			remoteFile, err := session.OpenFile(remotePath, os.O_WRONLY)
 			if err != nil {
 				errChan <- err
 				return
@@ -229,14 +1040,14 @@ func uploadMultipart(ctx context.Context, session *network.SftpSession, localPat
 				return
 			}
 
-			// Limit the reader to this chunk's length
-			partReader := io.LimitReader(localFile, length-offset) // logic fix below
-			// Actually LimitReader takes size, not end pos.
-			partReader = io.LimitReader(localFile, length)
+			// length is already end-start, so after the absolute Seek this
+			// reads exactly [offset, offset+length) — the remainder chunk
+			// included.
+			partReader := io.LimitReader(localFile, length)
 
-			// We wrap for stats updating
-			// Note: Hasher is skipped in multipart for speed/complexity reasons
-			// (Merging 16 partial hashes is complex). Integrity relies on TCP/SSH here.
+			// Each worker hashes its own chunk as it streams; the partial
+			// sums are merged with a positional CRC combine afterwards.
+			var chunkSum uint32
 			buf := make([]byte, 32*1024)
 
 			// Custom copy loop to update monitor
@@ -250,6 +1061,12 @@ func uploadMultipart(ctx context.Context, session *network.SftpSession, localPat
 
 				n, readErr := partReader.Read(buf)
 				if n > 0 {
+					// Pace against the shared budget before the bytes hit
+					// the wire — all chunk workers draw from one bucket.
+					if err := GlobalRateLimit.wait(ctx, int64(n)); err != nil {
+						errChan <- err
+						return
+					}
 					// Write to remote
 					_, writeErr := remoteFile.Write(buf[:n])
 					if writeErr != nil {
@@ -258,6 +1075,10 @@ func uploadMultipart(ctx context.Context, session *network.SftpSession, localPat
 					}
 					// Update global stats
 					GlobalMonitor.AddBytes(int64(n))
+					res.addBytes(int64(n))
+					if hashing {
+						chunkSum = crc32.Update(chunkSum, crc32.IEEETable, buf[:n])
+					}
 				}
 				if readErr == io.EOF {
 					break
@@ -267,7 +1088,12 @@ func uploadMultipart(ctx context.Context, session *network.SftpSession, localPat
 					return
 				}
 			}
-		}(start, end-start)
+
+			chunkSums[idx] = chunkSum
+			if state != nil {
+				state.markDone(offset)
+			}
+		}(i, c.offset, c.length)
 	}
 
 	wg.Wait()
@@ -278,27 +1104,54 @@ func uploadMultipart(ctx context.Context, session *network.SftpSession, localPat
 		return <-errChan
 	}
 
+	if hashing {
+		// Stitch the chunk sums together in offset order and check the
+		// result against a fresh read of the local file. A mismatch means
+		// a worker shipped bytes that don't match what's on disk now —
+		// fail the swarm so the caller falls back to single stream.
+		var combined uint32
+		for i, c := range chunks {
+			combined = crc32CombineIEEE(combined, chunkSums[i], c.length)
+		}
+		onDisk, err := CalculateChecksum(localPath)
+		if err != nil {
+			return err
+		}
+		if onDisk != fmt.Sprintf("%x", combined) {
+			return core.ErrChecksumMismatch
+		}
+		res.setChecksum(combined)
+	}
+
 	// Sync metadata after successful multipart swarm
 	if info, err := os.Stat(localPath); err == nil {
-		_ = session.SftpClient.Chtimes(remotePath, time.Now(), info.ModTime())
-		_ = session.SftpClient.Chmod(remotePath, info.Mode())
+		_ = session.Chtimes(remotePath, time.Now(), info.ModTime())
+		_ = session.Chmod(remotePath, info.Mode())
 	}
 
+	if state != nil {
+		state.remove()
+	}
 	return nil
 }
 
 // Legacy wrappers (now with context)
 func UploadFile(ctx context.Context, session *network.SftpSession, localPath, remotePath string) error {
-	return UploadFileWithProgress(ctx, session, localPath, remotePath)
+	return UploadFileWithProgress(ctx, session, localPath, remotePath, nil)
 }
 
 func DownloadFile(ctx context.Context, session *network.SftpSession, remotePath, localPath string) error {
-	return DownloadFileWithProgress(ctx, session, remotePath, localPath)
+	return DownloadFileWithProgress(ctx, session, remotePath, localPath, nil)
 }
 
-// copyWithContext is a helper to allow cancellation during io.Copy
+// copyWithContext is a helper to allow cancellation during io.Copy.
+// With AdaptiveBuffers on, the buffer sizes itself to the link: reads that
+// keep filling it mean the pipe has more to give, so it doubles (up to
+// MaxBufferSize); a short or stalled read drops it back down. The caller's
+// buf is only the starting size.
 func copyWithContext(ctx context.Context, dst io.Writer, src io.Reader, buf []byte) (int64, error) {
 	var written int64
+	fullReads := 0
 	for {
 		select {
 		case <-ctx.Done():
@@ -306,8 +1159,14 @@ func copyWithContext(ctx context.Context, dst io.Writer, src io.Reader, buf []by
 		default:
 		}
 
+		readStart := time.Now()
 		nr, er := src.Read(buf)
 		if nr > 0 {
+			// Pace the chunk against the shared throughput budget (no-op
+			// when unthrottled).
+			if err := GlobalRateLimit.wait(ctx, int64(nr)); err != nil {
+				return written, err
+			}
 			nw, ew := dst.Write(buf[0:nr])
 			if nw > 0 {
 				written += int64(nw)
@@ -318,6 +1177,28 @@ func copyWithContext(ctx context.Context, dst io.Writer, src io.Reader, buf []by
 			if nr != nw {
 				return written, io.ErrShortWrite
 			}
+
+			if AdaptiveBuffers {
+				switch {
+				case nr == len(buf) && len(buf) < MaxBufferSize:
+					if fullReads++; fullReads >= adaptiveGrowAfter {
+						next := len(buf) * 2
+						if next > MaxBufferSize {
+							next = MaxBufferSize
+						}
+						buf = make([]byte, next)
+						fullReads = 0
+					}
+				case nr < len(buf)/2 || time.Since(readStart) > adaptiveStall:
+					// The link isn't keeping up with the buffer; back off.
+					fullReads = 0
+					if len(buf)/2 >= BufferSize {
+						buf = buf[:len(buf)/2]
+					}
+				default:
+					fullReads = 0
+				}
+			}
 		}
 		if er != nil {
 			if er == io.EOF {
@@ -0,0 +1,1389 @@
+/*
+ * Copyright 2026 The FileRipper Team
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package pfte
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"syscall"
+	"testing"
+	"testing/iotest"
+	"time"
+
+	"fileripper/internal/network"
+	"fileripper/internal/sftptest"
+)
+
+// startTestEnv boots an in-process SFTP server rooted at a temp dir and
+// returns connected sessions against it plus the server root.
+func startTestEnv(t *testing.T, sessionCount int) ([]*network.SftpSession, string) {
+	t.Helper()
+
+	root := t.TempDir()
+	srv, err := sftptest.Start(root)
+	if err != nil {
+		t.Fatalf("starting test server: %v", err)
+	}
+	t.Cleanup(srv.Close)
+
+	var sessions []*network.SftpSession
+	for i := 0; i < sessionCount; i++ {
+		sess := network.NewSession(srv.Host, srv.Port, sftptest.User, sftptest.Password)
+		if err := sess.Connect(); err != nil {
+			t.Fatalf("connect: %v", err)
+		}
+		if err := sess.OpenSFTP(); err != nil {
+			t.Fatalf("open sftp: %v", err)
+		}
+		t.Cleanup(sess.Close)
+		sessions = append(sessions, sess)
+	}
+	return sessions, root
+}
+
+// writeTree lays out files (path -> content) under dir.
+func writeTree(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for rel, content := range files {
+		full := filepath.Join(dir, filepath.FromSlash(rel))
+		if err := os.MkdirAll(filepath.Dir(full), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(full, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestUploadRoundTrip(t *testing.T) {
+	sessions, root := startTestEnv(t, 2)
+
+	srcFiles := map[string]string{
+		"a.txt":          "hello",
+		"sub/b.txt":      "world",
+		"sub/deep/c.bin": "binary-ish \x00\x01\x02 content",
+		"empty.txt":      "",
+		"spaced name %#": "odd but legal",
+	}
+	src := filepath.Join(t.TempDir(), "project")
+	writeTree(t, src, srcFiles)
+
+	engine := NewEngine()
+	engine.Mode = ModeConservative
+
+	if err := engine.StartTransfer(context.Background(), sessions, "UPLOAD", src, "up"); err != nil {
+		t.Fatalf("upload: %v", err)
+	}
+
+	for rel, want := range srcFiles {
+		got, err := os.ReadFile(filepath.Join(root, "up", "project", filepath.FromSlash(rel)))
+		if err != nil {
+			t.Errorf("missing uploaded file %s: %v", rel, err)
+			continue
+		}
+		if !bytes.Equal(got, []byte(want)) {
+			t.Errorf("content mismatch for %s: got %q want %q", rel, got, want)
+		}
+	}
+}
+
+func TestDownloadRoundTrip(t *testing.T) {
+	sessions, root := startTestEnv(t, 2)
+	t.Chdir(t.TempDir()) // downloads land in ./dump
+
+	remoteFiles := map[string]string{
+		"data/report.txt":       "quarterly numbers",
+		"data/logs/app.log":     "line1\nline2\n",
+		"data/nested/deep/x.db": "xxxx",
+	}
+	writeTree(t, root, remoteFiles)
+
+	engine := NewEngine()
+	engine.Mode = ModeConservative
+
+	if err := engine.StartTransfer(context.Background(), sessions, "DOWNLOAD", "data", ""); err != nil {
+		t.Fatalf("download: %v", err)
+	}
+
+	for rel, want := range remoteFiles {
+		got, err := os.ReadFile(filepath.Join("dump", filepath.FromSlash(rel)))
+		if err != nil {
+			t.Errorf("missing downloaded file %s: %v", rel, err)
+			continue
+		}
+		if !bytes.Equal(got, []byte(want)) {
+			t.Errorf("content mismatch for %s: got %q want %q", rel, got, want)
+		}
+	}
+}
+
+func TestUploadContentsOnly(t *testing.T) {
+	sessions, root := startTestEnv(t, 1)
+
+	src := filepath.Join(t.TempDir(), "project")
+	writeTree(t, src, map[string]string{"a.txt": "x", "sub/b.txt": "y"})
+
+	engine := NewEngine()
+	engine.Mode = ModeConservative
+
+	// Default: the "project" level is kept under the destination.
+	if err := engine.StartTransfer(context.Background(), sessions, "UPLOAD", src, "keep"); err != nil {
+		t.Fatalf("upload: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(root, "keep", "project", "a.txt")); err != nil {
+		t.Errorf("expected top dir preserved: %v", err)
+	}
+
+	// ContentsOnly: files land directly under the destination.
+	engine.ContentsOnly = true
+	if err := engine.StartTransfer(context.Background(), sessions, "UPLOAD", src, "flat"); err != nil {
+		t.Fatalf("upload: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(root, "flat", "a.txt")); err != nil {
+		t.Errorf("expected contents at dest root: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(root, "flat", "sub", "b.txt")); err != nil {
+		t.Errorf("expected nested contents at dest root: %v", err)
+	}
+}
+
+func TestUploadPreservesDirModes(t *testing.T) {
+	sessions, root := startTestEnv(t, 1)
+
+	src := filepath.Join(t.TempDir(), "drop")
+	restricted := filepath.Join(src, "inbox")
+	if err := os.MkdirAll(restricted, 0700); err != nil {
+		t.Fatal(err)
+	}
+	// An empty dir with a restricted mode is the interesting case.
+	if err := os.Chmod(restricted, 0700); err != nil {
+		t.Fatal(err)
+	}
+
+	engine := NewEngine()
+	engine.Mode = ModeConservative
+	engine.PreserveDirModes = true
+
+	if err := engine.StartTransfer(context.Background(), sessions, "UPLOAD", src, "out"); err != nil {
+		t.Fatalf("upload: %v", err)
+	}
+
+	info, err := os.Stat(filepath.Join(root, "out", "drop", "inbox"))
+	if err != nil {
+		t.Fatalf("empty dir not created: %v", err)
+	}
+	if info.Mode().Perm() != 0700 {
+		t.Errorf("dir mode not preserved: got %o want 0700", info.Mode().Perm())
+	}
+}
+
+func TestSingleFileUploadDownload(t *testing.T) {
+	sessions, root := startTestEnv(t, 1)
+	t.Chdir(t.TempDir())
+
+	local := filepath.Join(t.TempDir(), "one.txt")
+	if err := os.WriteFile(local, []byte("single file"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	engine := NewEngine()
+	engine.Mode = ModeConservative
+
+	if err := engine.UploadSpecificFile(context.Background(), sessions, local, "one.txt"); err != nil {
+		t.Fatalf("upload specific: %v", err)
+	}
+	got, err := os.ReadFile(filepath.Join(root, "one.txt"))
+	if err != nil || string(got) != "single file" {
+		t.Fatalf("uploaded file wrong: %q, %v", got, err)
+	}
+
+	if err := engine.DownloadSpecificFile(context.Background(), sessions, "one.txt", "back.txt"); err != nil {
+		t.Fatalf("download specific: %v", err)
+	}
+	got, err = os.ReadFile("back.txt")
+	if err != nil || string(got) != "single file" {
+		t.Fatalf("downloaded file wrong: %q, %v", got, err)
+	}
+}
+
+func TestUploadSpecificFileCreatesParentDir(t *testing.T) {
+	sessions, root := startTestEnv(t, 1)
+
+	local := filepath.Join(t.TempDir(), "f.txt")
+	if err := os.WriteFile(local, []byte("data"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	engine := NewEngine()
+	engine.Mode = ModeConservative
+
+	if err := engine.UploadSpecificFile(context.Background(), sessions, local, "new/deep/dir/f.txt"); err != nil {
+		t.Fatalf("upload specific: %v", err)
+	}
+	got, err := os.ReadFile(filepath.Join(root, "new", "deep", "dir", "f.txt"))
+	if err != nil || string(got) != "data" {
+		t.Fatalf("file not uploaded into created dir: %q, %v", got, err)
+	}
+}
+
+func TestDownloadExcludePrunesSubtree(t *testing.T) {
+	sessions, root := startTestEnv(t, 1)
+	t.Chdir(t.TempDir())
+
+	writeTree(t, root, map[string]string{
+		"data/keep.txt":                    "keep me",
+		"data/node_modules/pkg/index.js":   "module.exports = {}",
+		"data/node_modules/pkg/deep/d.js":  "nested",
+		"data/node_modules/other/thing.js": "more",
+	})
+	// A symlink inside the excluded tree: if the walk ever enumerates it,
+	// the engine records it in SkippedSymlinks — our canary for "pruned vs
+	// walked and filtered".
+	if err := os.Symlink("pkg", filepath.Join(root, "data", "node_modules", "link")); err != nil {
+		t.Fatalf("symlink: %v", err)
+	}
+
+	engine := NewEngine()
+	engine.Mode = ModeConservative
+	engine.Excludes = []string{"node_modules"}
+
+	if err := engine.StartTransfer(context.Background(), sessions, "DOWNLOAD", "data", ""); err != nil {
+		t.Fatalf("download: %v", err)
+	}
+
+	if _, err := os.Stat(filepath.Join("dump", "data", "keep.txt")); err != nil {
+		t.Errorf("expected keep.txt to download: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join("dump", "data", "node_modules")); !os.IsNotExist(err) {
+		t.Errorf("excluded subtree was downloaded (stat err = %v)", err)
+	}
+	if len(engine.SkippedSymlinks) != 0 {
+		t.Errorf("excluded subtree was enumerated: symlink canary recorded %v", engine.SkippedSymlinks)
+	}
+}
+
+func TestMatchesExclude(t *testing.T) {
+	cases := []struct {
+		patterns []string
+		rel      string
+		want     bool
+	}{
+		{[]string{"node_modules"}, "node_modules", true},
+		{[]string{"node_modules"}, "sub/node_modules", true},
+		{[]string{"*.log"}, "logs/app.log", true},
+		{[]string{"*.log"}, "app.log.txt", false},
+		{[]string{"cache/*"}, "cache/blob", true},
+		{[]string{"cache/*"}, "other/blob", false},
+		{[]string{"["}, "anything", false}, // malformed pattern never matches
+		{nil, "whatever", false},
+	}
+	for _, c := range cases {
+		if got := matchesExclude(c.patterns, c.rel); got != c.want {
+			t.Errorf("matchesExclude(%v, %q) = %v, want %v", c.patterns, c.rel, got, c.want)
+		}
+	}
+}
+
+func TestUploadForceModes(t *testing.T) {
+	sessions, root := startTestEnv(t, 1)
+
+	src := filepath.Join(t.TempDir(), "assets")
+	writeTree(t, src, map[string]string{
+		"index.html":   "<html/>",
+		"css/site.css": "body{}",
+	})
+	// Deliberately wrong source modes, as if unpacked from a zip.
+	if err := os.Chmod(filepath.Join(src, "index.html"), 0777); err != nil {
+		t.Fatal(err)
+	}
+
+	engine := NewEngine()
+	engine.Mode = ModeConservative
+	engine.ForceFileMode = 0644
+	engine.ForceDirMode = 0755
+
+	if err := engine.StartTransfer(context.Background(), sessions, "UPLOAD", src, "web"); err != nil {
+		t.Fatalf("upload: %v", err)
+	}
+
+	st, err := os.Stat(filepath.Join(root, "web", "assets", "index.html"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if st.Mode().Perm() != 0644 {
+		t.Errorf("file mode = %o, want 644", st.Mode().Perm())
+	}
+	st, err = os.Stat(filepath.Join(root, "web", "assets", "css"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if st.Mode().Perm() != 0755 {
+		t.Errorf("dir mode = %o, want 755", st.Mode().Perm())
+	}
+}
+
+func TestDownloadReportsBrokenSymlink(t *testing.T) {
+	sessions, root := startTestEnv(t, 1)
+	t.Chdir(t.TempDir())
+
+	writeTree(t, root, map[string]string{"data/ok.txt": "fine"})
+	if err := os.Symlink("missing-target", filepath.Join(root, "data", "dangling")); err != nil {
+		t.Fatalf("symlink: %v", err)
+	}
+
+	engine := NewEngine()
+	engine.Mode = ModeConservative
+	engine.FollowRemoteSymlinks = true
+
+	if err := engine.StartTransfer(context.Background(), sessions, "DOWNLOAD", "data", ""); err != nil {
+		t.Fatalf("download: %v", err)
+	}
+
+	if _, err := os.Stat(filepath.Join("dump", "data", "ok.txt")); err != nil {
+		t.Errorf("regular file missing: %v", err)
+	}
+	if len(engine.SkippedSymlinks) != 1 {
+		t.Fatalf("expected the dangling link on the report, got %v", engine.SkippedSymlinks)
+	}
+	link := engine.SkippedSymlinks[0]
+	if link.Target != "missing-target" || !strings.Contains(link.Reason, "broken") {
+		t.Errorf("unexpected report entry: %+v", link)
+	}
+}
+
+func TestDownloadSkipExisting(t *testing.T) {
+	sessions, root := startTestEnv(t, 1)
+	t.Chdir(t.TempDir())
+
+	writeTree(t, root, map[string]string{
+		"data/a.txt": "alpha",
+		"data/b.txt": "bravo",
+		"data/c.txt": "charlie",
+	})
+
+	engine := NewEngine()
+	engine.Mode = ModeConservative
+	if err := engine.StartTransfer(context.Background(), sessions, "DOWNLOAD", "data", ""); err != nil {
+		t.Fatalf("first download: %v", err)
+	}
+
+	// Plant a sentinel with identical size+mtime: if the rerun re-fetched
+	// the file it would overwrite this.
+	aPath := filepath.Join("dump", "data", "a.txt")
+	st, err := os.Stat(aPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(aPath, []byte("XLPHA"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(aPath, st.ModTime(), st.ModTime()); err != nil {
+		t.Fatal(err)
+	}
+	// And delete another file so the rerun has real work to do.
+	if err := os.Remove(filepath.Join("dump", "data", "b.txt")); err != nil {
+		t.Fatal(err)
+	}
+
+	engine.SkipExisting = true
+	if err := engine.StartTransfer(context.Background(), sessions, "DOWNLOAD", "data", ""); err != nil {
+		t.Fatalf("second download: %v", err)
+	}
+
+	stats := GlobalMonitor.GetStats()
+	if stats.SkippedFiles != 2 {
+		t.Errorf("skipped = %d, want 2", stats.SkippedFiles)
+	}
+	if stats.TotalFiles != 1 {
+		t.Errorf("queued = %d, want 1 (only the deleted file)", stats.TotalFiles)
+	}
+	got, err := os.ReadFile(aPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != "XLPHA" {
+		t.Errorf("up-to-date file was re-downloaded: %q", got)
+	}
+	if _, err := os.Stat(filepath.Join("dump", "data", "b.txt")); err != nil {
+		t.Errorf("missing file was not re-fetched: %v", err)
+	}
+}
+
+func TestDownloadFileModePolicy(t *testing.T) {
+	sessions, root := startTestEnv(t, 1)
+
+	writeTree(t, root, map[string]string{
+		"bin/run.sh": "#!/bin/sh\necho hi\n",
+		"bin/key":    "secret",
+	})
+	if err := os.Chmod(filepath.Join(root, "bin", "run.sh"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chmod(filepath.Join(root, "bin", "key"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	// Preserve: the script keeps +x, the key stays private.
+	t.Chdir(t.TempDir())
+	engine := NewEngine()
+	engine.Mode = ModeConservative
+	engine.PreserveFileModes = true
+	if err := engine.StartTransfer(context.Background(), sessions, "DOWNLOAD", "bin", ""); err != nil {
+		t.Fatalf("download: %v", err)
+	}
+	for rel, want := range map[string]os.FileMode{"run.sh": 0o755, "key": 0o600} {
+		st, err := os.Stat(filepath.Join("dump", "bin", rel))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := st.Mode().Perm(); got != want {
+			t.Errorf("%s: mode = %o, want %o", rel, got, want)
+		}
+	}
+
+	// Default mode: everything lands at the configured permissions.
+	t.Chdir(t.TempDir())
+	engine = NewEngine()
+	engine.Mode = ModeConservative
+	engine.DefaultFileMode = 0o640
+	if err := engine.StartTransfer(context.Background(), sessions, "DOWNLOAD", "bin", ""); err != nil {
+		t.Fatalf("download: %v", err)
+	}
+	for _, rel := range []string{"run.sh", "key"} {
+		st, err := os.Stat(filepath.Join("dump", "bin", rel))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := st.Mode().Perm(); got != os.FileMode(0o640) {
+			t.Errorf("%s: mode = %o, want 640", rel, got)
+		}
+	}
+}
+
+func TestPlanChunksEdgeSizes(t *testing.T) {
+	sizes := []int64{
+		MultipartThreshold,     // exactly on the split boundary
+		MultipartThreshold + 1, // one past it (remainder of 1)
+		MultipartThreshold - 1,
+		MultipartChunks,     // one byte per chunk
+		MultipartChunks - 1, // fewer bytes than chunks
+		1,
+		17*1024*1024 + 13, // not divisible by anything interesting
+	}
+	for _, size := range sizes {
+		chunkSize := size / int64(MultipartChunks)
+		chunks := planChunks(size, chunkSize, MultipartChunks)
+
+		var covered int64
+		for i, c := range chunks {
+			if c.length <= 0 {
+				t.Errorf("size %d: chunk %d has length %d", size, i, c.length)
+			}
+			if c.offset != covered {
+				t.Errorf("size %d: chunk %d starts at %d, want %d (gap or overlap)", size, i, c.offset, covered)
+			}
+			covered += c.length
+		}
+		if covered != size {
+			t.Errorf("size %d: chunks cover %d bytes", size, covered)
+		}
+	}
+
+	if got := planChunks(0, 0, MultipartChunks); got != nil {
+		t.Errorf("zero-length file should produce no chunks, got %v", got)
+	}
+}
+
+func TestPlanChunksRemainderLandsInFinalChunk(t *testing.T) {
+	size := int64(MultipartChunks*1000 + 7)
+	chunkSize := size / int64(MultipartChunks)
+	chunks := planChunks(size, chunkSize, MultipartChunks)
+	if len(chunks) != MultipartChunks {
+		t.Fatalf("got %d chunks, want %d", len(chunks), MultipartChunks)
+	}
+	last := chunks[len(chunks)-1]
+	if last.length != chunkSize+7 {
+		t.Errorf("final chunk length = %d, want %d", last.length, chunkSize+7)
+	}
+}
+
+func TestUploadMultipartBoundarySizes(t *testing.T) {
+	sessions, root := startTestEnv(t, 1)
+	src := t.TempDir()
+
+	for name, size := range map[string]int64{
+		"exact.bin": MultipartThreshold,
+		"plus1.bin": MultipartThreshold + 1,
+		// Not divisible by MultipartChunks: the remainder chunk must be
+		// read with exactly its own length, not the rounded one.
+		"odd.bin": MultipartThreshold + 12345,
+	} {
+		data := make([]byte, size)
+		for i := range data {
+			data[i] = byte(i % 251)
+		}
+		if err := os.WriteFile(filepath.Join(src, name), data, 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := UploadFile(context.Background(), sessions[0], filepath.Join(src, name), name); err != nil {
+			t.Fatalf("%s: upload: %v", name, err)
+		}
+		got, err := os.ReadFile(filepath.Join(root, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(got, data) {
+			t.Errorf("%s: uploaded bytes differ from source", name)
+		}
+	}
+}
+
+func TestDownloadTrailingSlashMeansContents(t *testing.T) {
+	sessions, root := startTestEnv(t, 1)
+	writeTree(t, root, map[string]string{
+		"data/a.txt":     "alpha",
+		"data/sub/b.txt": "bravo",
+	})
+
+	// "data" downloads the directory itself...
+	t.Chdir(t.TempDir())
+	engine := NewEngine()
+	engine.Mode = ModeConservative
+	if err := engine.StartTransfer(context.Background(), sessions, "DOWNLOAD", "data", ""); err != nil {
+		t.Fatalf("download data: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join("dump", "data", "sub", "b.txt")); err != nil {
+		t.Errorf("\"data\" should nest under dump/data: %v", err)
+	}
+
+	// ..."data/" downloads its contents straight into dump.
+	t.Chdir(t.TempDir())
+	engine = NewEngine()
+	engine.Mode = ModeConservative
+	if err := engine.StartTransfer(context.Background(), sessions, "DOWNLOAD", "data/", ""); err != nil {
+		t.Fatalf("download data/: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join("dump", "sub", "b.txt")); err != nil {
+		t.Errorf("\"data/\" should land contents directly under dump: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join("dump", "data")); err == nil {
+		t.Error("\"data/\" should not create a dump/data folder")
+	}
+}
+
+func TestMaxDepthLimitsDownload(t *testing.T) {
+	sessions, root := startTestEnv(t, 1)
+	writeTree(t, root, map[string]string{
+		"data/top.txt":          "t",
+		"data/sub/mid.txt":      "m",
+		"data/sub/deep/low.txt": "l",
+	})
+
+	t.Chdir(t.TempDir())
+	engine := NewEngine()
+	engine.Mode = ModeConservative
+	engine.MaxDepth = 1
+	if err := engine.StartTransfer(context.Background(), sessions, "DOWNLOAD", "data", ""); err != nil {
+		t.Fatalf("download: %v", err)
+	}
+
+	if _, err := os.Stat(filepath.Join("dump", "data", "top.txt")); err != nil {
+		t.Errorf("depth-0 file missing: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join("dump", "data", "sub", "mid.txt")); err != nil {
+		t.Errorf("depth-1 file missing: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join("dump", "data", "sub", "deep")); err != nil {
+		t.Errorf("the directory at the cut should still be created: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join("dump", "data", "sub", "deep", "low.txt")); err == nil {
+		t.Error("depth-2 file should not have been descended into")
+	}
+}
+
+func TestMaxDepthLimitsUploadEnumeration(t *testing.T) {
+	src := t.TempDir()
+	for p, content := range map[string]string{
+		"top.txt":          "t",
+		"sub/mid.txt":      "m",
+		"sub/deep/low.txt": "l",
+	} {
+		full := filepath.Join(src, p)
+		if err := os.MkdirAll(filepath.Dir(full), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(full, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	engine := NewEngine()
+	engine.MaxDepth = 0
+	_, jobs, _, err := engine.enumerateUpload(src+"/", "up")
+	if err != nil {
+		t.Fatalf("enumerate: %v", err)
+	}
+	var got []string
+	for _, j := range jobs {
+		got = append(got, j.RemotePath)
+	}
+	if len(got) != 1 || got[0] != "up/top.txt" {
+		t.Errorf("depth 0 should queue only the top-level file, got %v", got)
+	}
+
+	engine.MaxDepth = 1
+	_, jobs, _, err = engine.enumerateUpload(src+"/", "up")
+	if err != nil {
+		t.Fatalf("enumerate: %v", err)
+	}
+	if len(jobs) != 2 {
+		t.Errorf("depth 1 should queue 2 files, got %d", len(jobs))
+	}
+}
+
+func TestAppendFileShipsOnlyNewBytes(t *testing.T) {
+	sessions, root := startTestEnv(t, 1)
+	writeTree(t, root, map[string]string{"app.log": "line one\n"})
+
+	local := filepath.Join(t.TempDir(), "app.log")
+	if err := os.WriteFile(local, []byte("line one\nline two\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	var res JobResult
+	if err := AppendFile(context.Background(), sessions[0], local, "app.log", &res); err != nil {
+		t.Fatalf("append: %v", err)
+	}
+	got, err := os.ReadFile(filepath.Join(root, "app.log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != "line one\nline two\n" {
+		t.Errorf("remote content = %q; prior content must stay intact", got)
+	}
+	if res.Bytes != int64(len("line two\n")) {
+		t.Errorf("shipped %d bytes, want only the %d new ones", res.Bytes, len("line two\n"))
+	}
+
+	// Nothing new: a no-op, not a rewrite.
+	res = JobResult{}
+	if err := AppendFile(context.Background(), sessions[0], local, "app.log", &res); err != nil {
+		t.Fatalf("append (no-op): %v", err)
+	}
+	if res.Bytes != 0 {
+		t.Errorf("no-op append shipped %d bytes", res.Bytes)
+	}
+
+	// A remote ahead of the local file means rotation — refuse.
+	if err := os.WriteFile(local, []byte("short"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := AppendFile(context.Background(), sessions[0], local, "app.log", &res); err == nil {
+		t.Error("append with a shrunken local file should error, not truncate or guess")
+	}
+
+	// A missing remote is simply created from offset zero.
+	res = JobResult{}
+	if err := AppendFile(context.Background(), sessions[0], local, "fresh.log", &res); err != nil {
+		t.Fatalf("append to new file: %v", err)
+	}
+	if got, err := os.ReadFile(filepath.Join(root, "fresh.log")); err != nil || string(got) != "short" {
+		t.Errorf("fresh.log = %q (%v), want %q", got, err, "short")
+	}
+}
+
+func TestTouchSyncFixesDriftedTimestamps(t *testing.T) {
+	sessions, root := startTestEnv(t, 1)
+	writeTree(t, root, map[string]string{
+		"tree/same.txt":    "identical bytes",
+		"tree/drifted.txt": "also identical",
+		"tree/changed.txt": "remote version",
+	})
+
+	local := t.TempDir()
+	for p, content := range map[string]string{
+		"same.txt":    "identical bytes",
+		"drifted.txt": "also identical",
+		"changed.txt": "local version!", // same size, different bytes
+	} {
+		if err := os.WriteFile(filepath.Join(local, p), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	wantTime := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	oldTime := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	for _, name := range []string{"same.txt", "drifted.txt", "changed.txt"} {
+		if err := os.Chtimes(filepath.Join(local, name), wantTime, wantTime); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// same.txt already agrees; drifted.txt and changed.txt are years off.
+	if err := os.Chtimes(filepath.Join(root, "tree", "same.txt"), wantTime, wantTime); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"drifted.txt", "changed.txt"} {
+		if err := os.Chtimes(filepath.Join(root, "tree", name), oldTime, oldTime); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	engine := NewEngine()
+	corrected, err := engine.TouchSync(context.Background(), sessions, local, "tree")
+	if err != nil {
+		t.Fatalf("touch sync: %v", err)
+	}
+	if corrected != 1 {
+		t.Errorf("corrected %d timestamps, want 1 (only drifted.txt)", corrected)
+	}
+
+	st, err := os.Stat(filepath.Join(root, "tree", "drifted.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d := st.ModTime().Sub(wantTime); d < -mtimeTolerance || d > mtimeTolerance {
+		t.Errorf("drifted.txt mtime = %v, want ~%v", st.ModTime(), wantTime)
+	}
+
+	// Content mismatch must be left alone entirely: bytes AND mtime.
+	st, err = os.Stat(filepath.Join(root, "tree", "changed.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !st.ModTime().Equal(oldTime) {
+		t.Errorf("changed.txt mtime was touched despite differing content")
+	}
+	if got, _ := os.ReadFile(filepath.Join(root, "tree", "changed.txt")); string(got) != "remote version" {
+		t.Errorf("changed.txt content altered: %q", got)
+	}
+}
+
+func TestUploadCreatesMissingParentsLazily(t *testing.T) {
+	sessions, root := startTestEnv(t, 1)
+
+	local := filepath.Join(t.TempDir(), "file.txt")
+	if err := os.WriteFile(local, []byte("lazy parents"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// No pre-creation phase ran: the nested remote directories don't exist.
+	var res JobResult
+	err := UploadFileWithProgress(context.Background(), sessions[0], local, "deep/nested/dir/file.txt", &res)
+	if err != nil {
+		t.Fatalf("upload into missing dirs: %v", err)
+	}
+	got, err := os.ReadFile(filepath.Join(root, "deep", "nested", "dir", "file.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != "lazy parents" {
+		t.Errorf("remote content = %q", got)
+	}
+	if res.Attempts != 1 {
+		t.Errorf("lazy creation should happen within the attempt, got %d attempts", res.Attempts)
+	}
+}
+
+func TestResumeRestartsWhenRemotePartialTampered(t *testing.T) {
+	sessions, root := startTestEnv(t, 1)
+
+	size := int64(MultipartThreshold + 4096)
+	local := filepath.Join(t.TempDir(), "big.bin")
+	content := make([]byte, size)
+	for i := range content {
+		content[i] = byte(i * 31)
+	}
+	if err := os.WriteFile(local, content, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	chunkSize := size / int64(MultipartChunks)
+	chunks := planChunks(size, chunkSize, MultipartChunks)
+
+	// Simulate an interrupted run: chunk 0 journaled as done, its bytes on
+	// the remote — then a foreign writer mangles them.
+	state := newMultipartState(local, size, chunkSize)
+	state.markDone(chunks[0].offset)
+	tampered := append([]byte(nil), content[:chunks[0].length]...)
+	tampered[100] ^= 0xFF
+	// In-flight uploads live at the temp sibling until the final rename.
+	if err := os.WriteFile(filepath.Join(root, "big.bin"+uploadTmpSuffix), tampered, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	var res JobResult
+	if err := UploadFileResumable(context.Background(), sessions[0], local, "big.bin", &res); err != nil {
+		t.Fatalf("resume upload: %v", err)
+	}
+	got, err := os.ReadFile(filepath.Join(root, "big.bin"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, content) {
+		t.Fatal("remote bytes corrupt: the tampered prefix must have forced a restart")
+	}
+	// A restart re-sends everything, including the journaled chunk.
+	if res.Bytes != size {
+		t.Errorf("shipped %d bytes, want the full %d (restart from zero)", res.Bytes, size)
+	}
+
+	// Control: an intact partial is actually resumed, not re-sent.
+	state = newMultipartState(local, size, chunkSize)
+	state.markDone(chunks[0].offset)
+	if err := os.WriteFile(filepath.Join(root, "big.bin"+uploadTmpSuffix), content[:chunks[0].length], 0644); err != nil {
+		t.Fatal(err)
+	}
+	res = JobResult{}
+	if err := UploadFileResumable(context.Background(), sessions[0], local, "big.bin", &res); err != nil {
+		t.Fatalf("resume upload (intact): %v", err)
+	}
+	if got, _ := os.ReadFile(filepath.Join(root, "big.bin")); !bytes.Equal(got, content) {
+		t.Fatal("resumed upload produced wrong bytes")
+	}
+	if res.Bytes != size-chunks[0].length {
+		t.Errorf("shipped %d bytes, want %d (chunk 0 skipped)", res.Bytes, size-chunks[0].length)
+	}
+}
+
+func TestIsLocalDiskFullErr(t *testing.T) {
+	cases := []struct {
+		err  error
+		want bool
+	}{
+		{nil, false},
+		{syscall.ENOSPC, true},
+		{fmt.Errorf("write /tmp/x: %w", syscall.ENOSPC), true},
+		{errors.New("write /tmp/x: no space left on device"), true},
+		{errors.New("sftp: \"Quota exceeded\" (SSH_FX_FAILURE)"), false},
+		{errors.New("connection reset by peer"), false},
+	}
+	for _, c := range cases {
+		if got := isLocalDiskFullErr(c.err); got != c.want {
+			t.Errorf("isLocalDiskFullErr(%v) = %v, want %v", c.err, got, c.want)
+		}
+	}
+}
+
+func TestHashModesAgreeOnTheDigest(t *testing.T) {
+	defer SetHashMode(HashInline)
+	payload := bytes.Repeat([]byte("fileripper"), 100_000)
+	want := crc32.ChecksumIEEE(payload)
+
+	for _, mode := range []HashMode{HashInline, HashAsync} {
+		SetHashMode(mode)
+		pt := newProgressTracker(bytes.NewReader(payload))
+		if _, err := io.Copy(io.Discard, pt); err != nil {
+			t.Fatalf("%v: %v", mode, err)
+		}
+		if got := pt.Sum32(); got != want {
+			t.Errorf("%v mode: digest %08x, want %08x", mode, got, want)
+		}
+	}
+
+	SetHashMode(HashOff)
+	pt := newProgressTracker(bytes.NewReader(payload))
+	if _, err := io.Copy(io.Discard, pt); err != nil {
+		t.Fatal(err)
+	}
+	if got := pt.Sum32(); got != 0 {
+		t.Errorf("off mode should report no digest, got %08x", got)
+	}
+}
+
+// benchmarkHashMode pushes an in-memory payload through a tracker — the
+// closest thing to a fast loopback transfer with the network factored out.
+func benchmarkHashMode(b *testing.B, mode HashMode) {
+	defer SetHashMode(HashInline)
+	SetHashMode(mode)
+	payload := make([]byte, 16<<20)
+	b.SetBytes(int64(len(payload)))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		pt := newProgressTracker(bytes.NewReader(payload))
+		if _, err := io.Copy(io.Discard, pt); err != nil {
+			b.Fatal(err)
+		}
+		pt.Sum32()
+	}
+}
+
+func BenchmarkHashInline(b *testing.B) { benchmarkHashMode(b, HashInline) }
+func BenchmarkHashAsync(b *testing.B)  { benchmarkHashMode(b, HashAsync) }
+func BenchmarkHashOff(b *testing.B)    { benchmarkHashMode(b, HashOff) }
+
+func TestRepairRedownloadsOnlyDamagedFiles(t *testing.T) {
+	sessions, root := startTestEnv(t, 1)
+	writeTree(t, root, map[string]string{
+		"data/good.txt":          "intact content",
+		"data/truncated.bin":     "full original payload",
+		"data/sub/corrupted.dat": "real bytes",
+		"data/sub/missing.txt":   "never arrived",
+	})
+
+	local := t.TempDir()
+	writeTree(t, local, map[string]string{
+		"good.txt":          "intact content",
+		"truncated.bin":     "full orig",  // cut short
+		"sub/corrupted.dat": "fake bytes", // same size, different content
+	})
+	goodPath := filepath.Join(local, "good.txt")
+	goodBefore, err := os.Stat(goodPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	engine := NewEngine()
+	engine.Mode = ModeConservative
+	report, err := engine.Repair(context.Background(), sessions, local, "data")
+	if err != nil {
+		t.Fatalf("repair: %v", err)
+	}
+
+	if report.Checked != 4 {
+		t.Errorf("checked = %d, want 4", report.Checked)
+	}
+	sort.Strings(report.Repaired)
+	want := []string{"sub/corrupted.dat", "sub/missing.txt", "truncated.bin"}
+	if len(report.Repaired) != len(want) {
+		t.Fatalf("repaired = %v, want %v", report.Repaired, want)
+	}
+	for i := range want {
+		if report.Repaired[i] != want[i] {
+			t.Fatalf("repaired = %v, want %v", report.Repaired, want)
+		}
+	}
+
+	for rel, content := range map[string]string{
+		"good.txt":          "intact content",
+		"truncated.bin":     "full original payload",
+		"sub/corrupted.dat": "real bytes",
+		"sub/missing.txt":   "never arrived",
+	} {
+		got, err := os.ReadFile(filepath.Join(local, filepath.FromSlash(rel)))
+		if err != nil || string(got) != content {
+			t.Errorf("%s after repair = %q (%v), want %q", rel, got, err, content)
+		}
+	}
+
+	// The good file must not have been rewritten.
+	goodAfter, err := os.Stat(goodPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !goodAfter.ModTime().Equal(goodBefore.ModTime()) {
+		t.Error("good.txt was rewritten even though its checksum matched")
+	}
+}
+
+func TestWorkerReconnectsDroppedSession(t *testing.T) {
+	sessions, root := startTestEnv(t, 1)
+	local := t.TempDir()
+
+	writeTree(t, root, map[string]string{
+		"data/one.txt": "survives the blip",
+		"data/two.txt": "so does this",
+	})
+
+	queue := NewQueue()
+	for _, name := range []string{"one.txt", "two.txt"} {
+		queue.Add(&TransferJob{
+			LocalPath:  filepath.Join(local, name),
+			RemotePath: "data/" + name,
+			Operation:  "DOWNLOAD",
+		})
+	}
+
+	// Kill the tunnel out from under the worker: the first SFTP call fails
+	// with a connection error, and the pool must rebuild the session in
+	// place instead of failing the batch.
+	sessions[0].SshClient.Close()
+
+	pool := NewWorkerPool(1, queue)
+	pool.StartUnleash(context.Background(), sessions)
+
+	for _, job := range pool.Results() {
+		if job.Result.Err != nil {
+			t.Errorf("%s failed despite reconnect: %v", job.RemotePath, job.Result.Err)
+		}
+	}
+	for _, name := range []string{"one.txt", "two.txt"} {
+		got, err := os.ReadFile(filepath.Join(local, name))
+		if err != nil {
+			t.Errorf("missing %s after reconnect: %v", name, err)
+			continue
+		}
+		if len(got) == 0 {
+			t.Errorf("%s is empty after reconnect", name)
+		}
+	}
+}
+
+func TestCancelledContextStopsTheSwarm(t *testing.T) {
+	sessions, root := startTestEnv(t, 1)
+	local := t.TempDir()
+
+	files := map[string]string{}
+	for i := 0; i < 20; i++ {
+		files[fmt.Sprintf("data/f%02d.txt", i)] = "payload"
+	}
+	writeTree(t, root, files)
+
+	queue := NewQueue()
+	for name := range files {
+		queue.Add(&TransferJob{
+			LocalPath:  filepath.Join(local, filepath.Base(name)),
+			RemotePath: name,
+			Operation:  "DOWNLOAD",
+		})
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel() // already dead before the first pop
+
+	pool := NewWorkerPool(2, queue)
+	pool.StartUnleash(ctx, sessions)
+
+	results := pool.Results()
+	if len(results) != len(files) {
+		t.Fatalf("results = %d, want %d (every job accounted for)", len(results), len(files))
+	}
+	for _, job := range results {
+		if !errors.Is(job.Result.Err, context.Canceled) {
+			t.Errorf("%s: err = %v, want context.Canceled", job.RemotePath, job.Result.Err)
+		}
+	}
+}
+
+func TestDownloadResumeAppendsToPartial(t *testing.T) {
+	sessions, root := startTestEnv(t, 1)
+	local := filepath.Join(t.TempDir(), "big.bin")
+
+	content := bytes.Repeat([]byte("0123456789abcdef"), 4096) // 64 KiB
+	writeTree(t, root, map[string]string{"big.bin": string(content)})
+
+	// A previous run got halfway: the partial holds the first 32 KiB.
+	half := len(content) / 2
+	if err := os.WriteFile(local+partSuffix, content[:half], 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	res := &JobResult{}
+	if err := DownloadFileResumable(context.Background(), sessions[0], "big.bin", local, res); err != nil {
+		t.Fatalf("resume: %v", err)
+	}
+
+	got, err := os.ReadFile(local)
+	if err != nil {
+		t.Fatalf("final file missing: %v", err)
+	}
+	if !bytes.Equal(got, content) {
+		t.Error("resumed file does not match the remote content")
+	}
+	if res.Bytes != int64(len(content)-half) {
+		t.Errorf("transferred %d bytes, want %d (just the missing tail)", res.Bytes, len(content)-half)
+	}
+	if _, err := os.Stat(local + partSuffix); err == nil {
+		t.Error("partial should be renamed away on success")
+	}
+}
+
+func TestDownloadResumeDiscardsStalePartial(t *testing.T) {
+	sessions, root := startTestEnv(t, 1)
+	local := filepath.Join(t.TempDir(), "small.txt")
+
+	writeTree(t, root, map[string]string{"small.txt": "tiny now"})
+
+	// The remote shrank since this partial was written; it can't be a
+	// prefix anymore and must be thrown away, not appended to.
+	if err := os.WriteFile(local+partSuffix, bytes.Repeat([]byte("x"), 1024), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	res := &JobResult{}
+	if err := DownloadFileResumable(context.Background(), sessions[0], "small.txt", local, res); err != nil {
+		t.Fatalf("resume after shrink: %v", err)
+	}
+	got, err := os.ReadFile(local)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != "tiny now" {
+		t.Errorf("got %q, want the fresh remote content", got)
+	}
+}
+
+func TestUploadIsAtomicViaTempRename(t *testing.T) {
+	sessions, root := startTestEnv(t, 1)
+	local := filepath.Join(t.TempDir(), "data.txt")
+	if err := os.WriteFile(local, []byte("fresh content"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// A consumer is already reading the old version; it must see either
+	// the old bytes or the new bytes, never a truncated in-between.
+	if err := os.WriteFile(filepath.Join(root, "data.txt"), []byte("old version"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	var res JobResult
+	if err := UploadFileWithProgress(context.Background(), sessions[0], local, "data.txt", &res); err != nil {
+		t.Fatalf("upload: %v", err)
+	}
+
+	got, err := os.ReadFile(filepath.Join(root, "data.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != "fresh content" {
+		t.Errorf("got %q, want the uploaded content", got)
+	}
+	if _, err := os.Stat(filepath.Join(root, "data.txt"+uploadTmpSuffix)); err == nil {
+		t.Error("temp sibling left behind after a successful upload")
+	}
+}
+
+func TestSkipExistingUploadsOnlyMissingFiles(t *testing.T) {
+	sessions, root := startTestEnv(t, 1)
+
+	src := filepath.Join(t.TempDir(), "mirror")
+	writeTree(t, src, map[string]string{
+		"same.txt": "unchanged",
+		"new.txt":  "only local",
+	})
+
+	engine := NewEngine()
+	engine.Mode = ModeConservative
+	engine.SkipExisting = true
+
+	// First pass ships everything.
+	if err := engine.StartTransfer(context.Background(), sessions, "UPLOAD", src, "up"); err != nil {
+		t.Fatalf("first upload: %v", err)
+	}
+
+	// Second pass with one extra file: the unchanged ones stay home.
+	writeTree(t, src, map[string]string{"extra.txt": "appeared later"})
+	if err := engine.StartTransfer(context.Background(), sessions, "UPLOAD", src, "up"); err != nil {
+		t.Fatalf("second upload: %v", err)
+	}
+
+	sent := map[string]bool{}
+	for _, job := range engine.LastResults {
+		if job.Result.Err != nil {
+			t.Errorf("%s: %v", job.RemotePath, job.Result.Err)
+		}
+		sent[filepath.Base(job.RemotePath)] = true
+	}
+	if len(sent) != 1 || !sent["extra.txt"] {
+		t.Errorf("second pass sent %v, want just extra.txt", sent)
+	}
+	if _, err := os.Stat(filepath.Join(root, "up", "mirror", "extra.txt")); err != nil {
+		t.Errorf("extra.txt missing remotely: %v", err)
+	}
+}
+
+func TestDownloadFileVerifiedRecordsMatchingChecksum(t *testing.T) {
+	sessions, root := startTestEnv(t, 1)
+	local := filepath.Join(t.TempDir(), "verified.bin")
+
+	content := []byte("bytes worth double-checking")
+	writeTree(t, root, map[string]string{"verified.bin": string(content)})
+
+	var res JobResult
+	if err := DownloadFileVerified(context.Background(), sessions[0], "verified.bin", local, MismatchRetry, &res); err != nil {
+		t.Fatalf("verified download: %v", err)
+	}
+	if got, _ := os.ReadFile(local); !bytes.Equal(got, content) {
+		t.Error("content mismatch after verified download")
+	}
+	if want := fmt.Sprintf("%x", crc32.ChecksumIEEE(content)); res.Checksum != want {
+		t.Errorf("recorded checksum %s, want %s", res.Checksum, want)
+	}
+
+	// With hashing off there is nothing to compare — the download must
+	// still succeed rather than fake a verification.
+	SetHashMode(HashOff)
+	defer SetHashMode(HashInline)
+	res = JobResult{}
+	if err := DownloadFileVerified(context.Background(), sessions[0], "verified.bin", local, MismatchRetry, &res); err != nil {
+		t.Fatalf("verified download with hashing off: %v", err)
+	}
+	if res.Checksum != "" {
+		t.Errorf("checksum = %q, want none when hashing is off", res.Checksum)
+	}
+}
+
+func TestCrc32CombineMatchesSingleStream(t *testing.T) {
+	a := bytes.Repeat([]byte("first part "), 4096)
+	b := bytes.Repeat([]byte("second!"), 999)
+	c := []byte("tail")
+
+	whole := crc32.ChecksumIEEE(bytes.Join([][]byte{a, b, c}, nil))
+	combined := crc32.ChecksumIEEE(a)
+	combined = crc32CombineIEEE(combined, crc32.ChecksumIEEE(b), int64(len(b)))
+	combined = crc32CombineIEEE(combined, crc32.ChecksumIEEE(c), int64(len(c)))
+	if combined != whole {
+		t.Errorf("combined = %08x, want %08x", combined, whole)
+	}
+
+	// Zero-length second part is a no-op.
+	if got := crc32CombineIEEE(whole, 0, 0); got != whole {
+		t.Errorf("zero-length combine changed the sum: %08x", got)
+	}
+}
+
+func TestMultipartUploadReportsWholeFileChecksum(t *testing.T) {
+	sessions, root := startTestEnv(t, 1)
+
+	content := bytes.Repeat([]byte("multipart hash material\n"), 1<<19) // well past the threshold
+	local := filepath.Join(t.TempDir(), "big.bin")
+	if err := os.WriteFile(local, content, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	var res JobResult
+	if err := UploadFileWithProgress(context.Background(), sessions[0], local, "big.bin", &res); err != nil {
+		t.Fatalf("upload: %v", err)
+	}
+	if !res.Multipart {
+		t.Fatal("expected the multipart path for a file this size")
+	}
+	want := fmt.Sprintf("%x", crc32.ChecksumIEEE(content))
+	if res.Checksum != want {
+		t.Errorf("checksum = %s, want %s (same as a single stream)", res.Checksum, want)
+	}
+	if got, _ := os.ReadFile(filepath.Join(root, "big.bin")); !bytes.Equal(got, content) {
+		t.Error("uploaded bytes differ from the source")
+	}
+}
+
+func TestMultipartDownloadMatchesSingleStream(t *testing.T) {
+	sessions, root := startTestEnv(t, 1)
+	local := filepath.Join(t.TempDir(), "restore.bin")
+
+	content := bytes.Repeat([]byte("fifty gigabyte backups start small\n"), 1<<19) // ~17 MB
+	if err := os.WriteFile(filepath.Join(root, "restore.bin"), content, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	var res JobResult
+	if err := DownloadFileWithProgress(context.Background(), sessions[0], "restore.bin", local, &res); err != nil {
+		t.Fatalf("download: %v", err)
+	}
+	if !res.Multipart {
+		t.Fatal("expected the multipart path for a file this size")
+	}
+	got, err := os.ReadFile(local)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, content) {
+		t.Fatal("multipart download produced different bytes")
+	}
+	if want := fmt.Sprintf("%x", crc32.ChecksumIEEE(content)); res.Checksum != want {
+		t.Errorf("checksum = %s, want %s", res.Checksum, want)
+	}
+	if res.Bytes != int64(len(content)) {
+		t.Errorf("transferred %d bytes, want %d", res.Bytes, len(content))
+	}
+}
+
+// chunkSizeRecorder notes the largest single Write it receives — a window
+// into how big the copy buffer actually got.
+type chunkSizeRecorder struct {
+	max int
+}
+
+func (w *chunkSizeRecorder) Write(p []byte) (int, error) {
+	if len(p) > w.max {
+		w.max = len(p)
+	}
+	return len(p), nil
+}
+
+// latencyReader simulates a high-BDP link: every Read costs a fixed round
+// trip but hands over as much as the buffer can take.
+type latencyReader struct {
+	remaining int64
+	delay     time.Duration
+}
+
+func (r *latencyReader) Read(p []byte) (int, error) {
+	if r.remaining <= 0 {
+		return 0, io.EOF
+	}
+	if r.delay > 0 {
+		time.Sleep(r.delay)
+	}
+	n := int64(len(p))
+	if n > r.remaining {
+		n = r.remaining
+	}
+	r.remaining -= n
+	return int(n), nil
+}
+
+func TestAdaptiveBufferGrowsOnFastLinksOnly(t *testing.T) {
+	buf := make([]byte, BufferSize)
+	rec := &chunkSizeRecorder{}
+	src := &latencyReader{remaining: 8 << 20}
+	if _, err := copyWithContext(context.Background(), rec, src, buf); err != nil {
+		t.Fatal(err)
+	}
+	if rec.max <= BufferSize {
+		t.Errorf("buffer never grew past %d on a link that always fills it", BufferSize)
+	}
+	if rec.max > MaxBufferSize {
+		t.Errorf("buffer grew to %d, past the %d cap", rec.max, MaxBufferSize)
+	}
+
+	// A source that only ever has a trickle must not trigger growth.
+	rec = &chunkSizeRecorder{}
+	if _, err := copyWithContext(context.Background(), rec, iotest.OneByteReader(&latencyReader{remaining: 1 << 20}), make([]byte, BufferSize)); err != nil {
+		t.Fatal(err)
+	}
+	if rec.max > BufferSize {
+		t.Errorf("buffer grew to %d on a trickling link", rec.max)
+	}
+}
+
+// benchmarkBDPCopy streams 32MB over a link where every read costs a round
+// trip — the case adaptive buffers exist for. Fewer, bigger reads win.
+func benchmarkBDPCopy(b *testing.B, adaptive bool) {
+	defer func(prev bool) { AdaptiveBuffers = prev }(AdaptiveBuffers)
+	AdaptiveBuffers = adaptive
+	const payload = 32 << 20
+	b.SetBytes(payload)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		src := &latencyReader{remaining: payload, delay: 100 * time.Microsecond}
+		if _, err := copyWithContext(context.Background(), io.Discard, src, make([]byte, BufferSize)); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkCopyFixedBuffer(b *testing.B)    { benchmarkBDPCopy(b, false) }
+func BenchmarkCopyAdaptiveBuffer(b *testing.B) { benchmarkBDPCopy(b, true) }
@@ -0,0 +1,107 @@
+/*
+ * Copyright 2026 The FileRipper Team
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package pfte
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"fileripper/internal/network"
+)
+
+// Extended attributes don't travel over SFTP — the protocol simply has no
+// slot for them. When xattr preservation is on, each file's attributes ride
+// along in a small JSON sidecar next to the remote file, and a download that
+// finds the sidecar replays them onto the local copy. Platforms or
+// filesystems without xattr support degrade to "nothing to do" on the read
+// side and a reported issue on the write side, never a failed transfer.
+
+// xattrSuffix names the sidecar: payroll.db is accompanied by
+// payroll.db.fr-xattr.
+const xattrSuffix = ".fr-xattr"
+
+// xattrSidecar is the sidecar's JSON shape. Values are base64 via the
+// standard []byte marshaling — xattr values are arbitrary bytes.
+type xattrSidecar struct {
+	Xattrs map[string][]byte `json:"xattrs"`
+}
+
+// preserveXattrs ships localPath's extended attributes to a sidecar next to
+// remotePath. Returns a human-readable issue when attributes existed but
+// couldn't be preserved, empty otherwise.
+func preserveXattrs(session *network.SftpSession, localPath, remotePath string) string {
+	attrs, err := listXattrs(localPath)
+	if err != nil {
+		return fmt.Sprintf("%s: could not read xattrs: %v", localPath, err)
+	}
+	if len(attrs) == 0 {
+		return ""
+	}
+
+	data, err := json.Marshal(xattrSidecar{Xattrs: attrs})
+	if err != nil {
+		return fmt.Sprintf("%s: could not encode xattrs: %v", localPath, err)
+	}
+
+	dst, err := session.Create(remotePath + xattrSuffix)
+	if err != nil {
+		return fmt.Sprintf("%s: could not write xattr sidecar: %v", remotePath, err)
+	}
+	_, werr := dst.Write(data)
+	cerr := dst.Close()
+	if werr != nil || cerr != nil {
+		return fmt.Sprintf("%s: could not write xattr sidecar: %v", remotePath, firstErr(werr, cerr))
+	}
+	return ""
+}
+
+// restoreXattrs applies the sidecar next to remotePath (if there is one)
+// onto localPath. A missing sidecar means the file never had attributes —
+// that's not an issue. Returns a human-readable issue when restoring failed.
+func restoreXattrs(session *network.SftpSession, remotePath, localPath string) string {
+	src, err := session.Open(remotePath + xattrSuffix)
+	if err != nil {
+		return "" // no sidecar, nothing to restore
+	}
+	defer src.Close()
+
+	data, err := io.ReadAll(io.LimitReader(src, 1<<20))
+	if err != nil {
+		return fmt.Sprintf("%s: could not read xattr sidecar: %v", remotePath, err)
+	}
+	var sidecar xattrSidecar
+	if err := json.Unmarshal(data, &sidecar); err != nil {
+		return fmt.Sprintf("%s: invalid xattr sidecar: %v", remotePath, err)
+	}
+
+	for name, value := range sidecar.Xattrs {
+		if err := setXattr(localPath, name, value); err != nil {
+			return fmt.Sprintf("%s: could not restore xattr %s: %v", localPath, name, err)
+		}
+	}
+	return ""
+}
+
+func firstErr(errs ...error) error {
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
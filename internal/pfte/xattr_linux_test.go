@@ -0,0 +1,93 @@
+//go:build linux
+
+/*
+ * Copyright 2026 The FileRipper Team
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package pfte
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+)
+
+// setTestXattr puts a user.* attribute on path, skipping the test when the
+// filesystem under TMPDIR doesn't do xattrs (tmpfs usually does).
+func setTestXattr(t *testing.T, path, name string, value []byte) {
+	t.Helper()
+	if err := syscall.Setxattr(path, name, value, 0); err != nil {
+		if err == syscall.ENOTSUP || err == syscall.EOPNOTSUPP {
+			t.Skipf("filesystem does not support xattrs: %v", err)
+		}
+		t.Fatalf("setxattr %s: %v", path, err)
+	}
+}
+
+func TestXattrsRideAlongInSidecars(t *testing.T) {
+	sessions, root := startTestEnv(t, 1)
+	t.Chdir(t.TempDir()) // downloads land in ./dump
+
+	src := filepath.Join(t.TempDir(), "project")
+	writeTree(t, src, map[string]string{
+		"tagged.txt": "has attributes",
+		"plain.txt":  "has none",
+	})
+	setTestXattr(t, filepath.Join(src, "tagged.txt"), "user.fr-test", []byte("v1"))
+
+	engine := NewEngine()
+	engine.Mode = ModeConservative
+	engine.PreserveXattrs = true
+
+	if err := engine.StartTransfer(context.Background(), sessions, "UPLOAD", src, "up"); err != nil {
+		t.Fatalf("upload: %v", err)
+	}
+	if len(engine.Warnings) != 0 {
+		t.Fatalf("unexpected warnings: %v", engine.Warnings)
+	}
+
+	// Only the file that actually had attributes gets a sidecar.
+	sidecar := filepath.Join(root, "up", "project", "tagged.txt"+xattrSuffix)
+	if _, err := os.Stat(sidecar); err != nil {
+		t.Fatalf("missing sidecar: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(root, "up", "project", "plain.txt"+xattrSuffix)); err == nil {
+		t.Error("plain.txt has no xattrs and should have no sidecar")
+	}
+
+	if err := engine.StartTransfer(context.Background(), sessions, "DOWNLOAD", "up/project", ""); err != nil {
+		t.Fatalf("download: %v", err)
+	}
+	if len(engine.Warnings) != 0 {
+		t.Fatalf("unexpected warnings: %v", engine.Warnings)
+	}
+
+	landed := filepath.Join("dump", "project", "tagged.txt")
+	value := make([]byte, 2)
+	if _, err := syscall.Getxattr(landed, "user.fr-test", value); err != nil {
+		t.Fatalf("xattr was not restored: %v", err)
+	}
+	if !bytes.Equal(value, []byte("v1")) {
+		t.Errorf("restored xattr = %q, want %q", value, "v1")
+	}
+
+	// The sidecar itself is metadata and must not land as a regular file.
+	if _, err := os.Stat(filepath.Join("dump", "project", "tagged.txt"+xattrSuffix)); err == nil {
+		t.Error("sidecar was materialized as a regular download")
+	}
+}
@@ -17,11 +17,18 @@
 package server
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"log"
 	"net/http"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
 	"sync"
+	"time"
 
 	"fileripper/internal/network"
 	"fileripper/internal/pfte"
@@ -32,8 +39,89 @@ import (
 var (
 	activeSession *network.SftpSession
 	sessionMu     sync.Mutex
+
+	// sessionRegistry holds every live connection by the ID handed back
+	// from /api/connect, so the UI can talk to two servers at once.
+	// activeSession doubles as the default entry — the most recent connect
+	// — which keeps requests without a session_id working exactly as they
+	// did before the registry existed.
+	sessionRegistry = map[string]*registeredSession{}
+	sessionSeq      int
+
+	// connState is what the UI gets told about the session. It exists so a
+	// dead socket doesn't keep reading as "connected" until some request
+	// fails; the progress poll re-probes the link every few seconds.
+	connState       = ConnDisconnected
+	lastHealthProbe time.Time
+)
+
+// registeredSession is one live connection plus the metadata the UI wants
+// for its session picker.
+type registeredSession struct {
+	session     *network.SftpSession
+	host        string
+	port        int
+	user        string
+	connectedAt time.Time
+}
+
+// resolveSession maps a request's session_id to a live session. An empty ID
+// means the default (most recently connected) session. Callers hold
+// sessionMu. The error text goes to the UI verbatim.
+func resolveSession(id string) (*network.SftpSession, error) {
+	if id == "" {
+		if activeSession == nil {
+			return nil, fmt.Errorf("Not connected")
+		}
+		return activeSession, nil
+	}
+	entry, ok := sessionRegistry[id]
+	if !ok {
+		return nil, fmt.Errorf("Unknown session %q", id)
+	}
+	return entry.session, nil
+}
+
+// ConnectionState is the session's health as reported to daemon clients.
+type ConnectionState int
+
+const (
+	ConnDisconnected ConnectionState = iota
+	ConnConnected
+	ConnReconnecting // reserved for keepalive/auto-reconnect to report through
 )
 
+func (c ConnectionState) String() string {
+	switch c {
+	case ConnConnected:
+		return "connected"
+	case ConnReconnecting:
+		return "reconnecting"
+	default:
+		return "disconnected"
+	}
+}
+
+// healthProbeInterval is how often the progress poll actually touches the
+// server. Polls come every ~200ms; a round-trip per poll would be abuse.
+const healthProbeInterval = 5 * time.Second
+
+// connectionHealth reports the session state, cheaply most of the time and
+// with a real server round-trip at most once per interval. Callers hold
+// sessionMu.
+func connectionHealth() ConnectionState {
+	if activeSession == nil || activeSession.SftpClient == nil {
+		return ConnDisconnected
+	}
+	if connState == ConnConnected && time.Since(lastHealthProbe) >= healthProbeInterval {
+		lastHealthProbe = time.Now()
+		if _, err := activeSession.Getwd(); err != nil {
+			connState = ConnDisconnected
+		}
+	}
+	return connState
+}
+
 // StartDaemon initializes the local REST API.
 // Flutter will talk to this port to command the Core.
 func StartDaemon(port int) {
@@ -42,12 +130,24 @@ func StartDaemon(port int) {
 	// Auth & Session Management
 	http.HandleFunc("/api/connect", handleConnect)
 	http.HandleFunc("/api/disconnect", handleDisconnect)
+	http.HandleFunc("/api/sessions", handleSessions)
+	http.HandleFunc("/api/test", handleTestConnection)
+	http.HandleFunc("/api/trust-host", handleTrustHost)
 
 	// File System Operations
 	http.HandleFunc("/api/files", handleListFiles)
+	http.HandleFunc("/api/tree", handleTree)
+	http.HandleFunc("/api/plan", handlePlan)
+	http.HandleFunc("/api/mkdir", handleMkdir)
+
+	// Transfers
+	http.HandleFunc("/api/transfer", handleTransfer)
+	http.HandleFunc("/api/cancel", handleCancelTransfer)
 
 	// Real-time Monitoring
 	http.HandleFunc("/api/progress", handleProgress)
+	http.HandleFunc("/api/progress/stream", handleProgressStream)
+	http.HandleFunc("/api/workers", handleScaleWorkers)
 
 	addr := fmt.Sprintf("127.0.0.1:%d", port)
 
@@ -64,10 +164,41 @@ type ConnectRequest struct {
 	Password string `json:"password"`
 }
 
+type PlanRequest struct {
+	Operation string `json:"operation"` // UPLOAD or DOWNLOAD
+	Source    string `json:"source"`
+	Dest      string `json:"dest"`
+	// IncludeFiles pulls the full file/dir lists into the response; off by
+	// default so a million-file tree doesn't come back as a giant body.
+	IncludeFiles bool `json:"include_files"`
+
+	SessionID string `json:"session_id,omitempty"` // empty = default session
+}
+
 type FileResponse struct {
 	Name  string `json:"name"`
 	Size  int64  `json:"size"`
 	IsDir bool   `json:"is_dir"`
+
+	// Added for the file-manager view; the original fields stay as-is so
+	// old consumers keep working.
+	ModTime   string `json:"mod_time"` // RFC3339
+	Mode      string `json:"mode"`     // symbolic, e.g. "-rw-r--r--"
+	IsSymlink bool   `json:"is_symlink"`
+	Target    string `json:"target,omitempty"` // symlink target, when readable
+}
+
+// TreeEntry is one NDJSON line of /api/tree: a file with its size, or —
+// once its subtree is fully walked — a directory with the aggregate size of
+// everything underneath it.
+type TreeEntry struct {
+	Type string `json:"type"` // "file", "dir", or "summary"
+	Path string `json:"path,omitempty"`
+	Size int64  `json:"size"`
+
+	// Summary-only fields.
+	Entries   int  `json:"entries,omitempty"`
+	Truncated bool `json:"truncated,omitempty"`
 }
 
 type ApiResponse struct {
@@ -90,21 +221,45 @@ func handleConnect(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	finishConnect(w, req, "")
+}
+
+// finishConnect performs the verified handshake plus SFTP setup and installs
+// the session. pinned carries a fingerprint the user just approved via
+// /api/trust-host; it's empty on a first attempt.
+func finishConnect(w http.ResponseWriter, req ConnectRequest, pinned string) {
 	sessionMu.Lock()
 	defer sessionMu.Unlock()
 
-	// Clean up previous session if the user reconnects
-	if activeSession != nil {
-		activeSession.Close()
-	}
+	// Earlier sessions stay registered: connecting to a second server must
+	// not drop the first. The newest connection just becomes the default.
 
 	fmt.Printf(">> API: Connect request to %s@%s:%d\n", req.User, req.Host, req.Port)
 
 	// 1. Init Session
 	session := network.NewSession(req.Host, req.Port, req.User, req.Password)
 
-	// 2. SSH Handshake
-	if err := session.Connect(); err != nil {
+	// Capture the server banner (if any) so the UI can show it.
+	var banner string
+	session.Banner = func(message string) error {
+		banner = message
+		return nil
+	}
+
+	// 2. SSH Handshake, host key checked against the trust store. An
+	// unknown host is not an error — the request parks until the UI calls
+	// /api/trust-host with the user's decision.
+	seen, err := checkedConnect(session, req, pinned)
+	if err == errHostKeyUnknown {
+		sendJSON(w, false, "Host key verification required", map[string]any{
+			"pending":     true,
+			"host":        req.Host,
+			"port":        req.Port,
+			"fingerprint": seen,
+		})
+		return
+	}
+	if err != nil {
 		sendJSON(w, false, "Connection failed: "+err.Error(), nil)
 		return
 	}
@@ -117,64 +272,754 @@ func handleConnect(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	sessionSeq++
+	id := fmt.Sprintf("session-%d", sessionSeq)
+	sessionRegistry[id] = &registeredSession{
+		session:     session,
+		host:        req.Host,
+		port:        req.Port,
+		user:        req.User,
+		connectedAt: time.Now(),
+	}
 	activeSession = session
-	sendJSON(w, true, "Connected successfully", nil)
+	connState = ConnConnected
+	lastHealthProbe = time.Now()
+	data := map[string]any{"session_id": id}
+	if banner != "" {
+		data["banner"] = banner
+	}
+	sendJSON(w, true, "Connected successfully", data)
+}
+
+func handleTestConnection(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req ConnectRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		sendJSON(w, false, "Invalid JSON body", nil)
+		return
+	}
+
+	// A probe only; it never touches or replaces the active session.
+	session := network.NewSession(req.Host, req.Port, req.User, req.Password)
+	result := session.TestConnection()
+
+	sendJSON(w, result.Authenticated, "Connection test finished", result)
 }
 
 func handleDisconnect(w http.ResponseWriter, r *http.Request) {
+	// Optional body: {"session_id": "..."} picks one session; an empty or
+	// absent body drops the default one, as it always did.
+	var req struct {
+		SessionID string `json:"session_id"`
+	}
+	json.NewDecoder(r.Body).Decode(&req)
+
 	sessionMu.Lock()
 	defer sessionMu.Unlock()
 
+	if req.SessionID != "" {
+		entry, ok := sessionRegistry[req.SessionID]
+		if !ok {
+			sendJSON(w, false, fmt.Sprintf("Unknown session %q", req.SessionID), nil)
+			return
+		}
+		entry.session.Close()
+		delete(sessionRegistry, req.SessionID)
+		if activeSession == entry.session {
+			activeSession = nil
+			connState = ConnDisconnected
+		}
+		sendJSON(w, true, "Disconnected", nil)
+		return
+	}
+
 	if activeSession != nil {
 		activeSession.Close()
+		for id, entry := range sessionRegistry {
+			if entry.session == activeSession {
+				delete(sessionRegistry, id)
+			}
+		}
 		activeSession = nil
 	}
+	connState = ConnDisconnected
 	sendJSON(w, true, "Disconnected", nil)
 }
 
+// SessionInfo is one row of GET /api/sessions.
+type SessionInfo struct {
+	ID          string `json:"id"`
+	Host        string `json:"host"`
+	Port        int    `json:"port"`
+	User        string `json:"user"`
+	ConnectedAt string `json:"connected_at"` // RFC3339
+	Default     bool   `json:"default"`      // the one used when no session_id is given
+}
+
+func handleSessions(w http.ResponseWriter, r *http.Request) {
+	sessionMu.Lock()
+	defer sessionMu.Unlock()
+
+	list := make([]SessionInfo, 0, len(sessionRegistry))
+	for id, entry := range sessionRegistry {
+		list = append(list, SessionInfo{
+			ID:          id,
+			Host:        entry.host,
+			Port:        entry.port,
+			User:        entry.user,
+			ConnectedAt: entry.connectedAt.Format(time.RFC3339),
+			Default:     entry.session == activeSession,
+		})
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].ID < list[j].ID })
+	sendJSON(w, true, "OK", list)
+}
+
 func handleListFiles(w http.ResponseWriter, r *http.Request) {
 	sessionMu.Lock()
 	defer sessionMu.Unlock()
 
-	if activeSession == nil || activeSession.SftpClient == nil {
+	session, err := resolveSession(r.URL.Query().Get("session_id"))
+	if err != nil {
+		sendJSON(w, false, err.Error(), nil)
+		return
+	}
+	if !session.Ready() {
 		sendJSON(w, false, "Not connected", nil)
 		return
 	}
 
 	// Get path from query param (e.g., /api/files?path=/var/www)
 	// Default to root (.)
-	path := r.URL.Query().Get("path")
-	if path == "" {
-		path = "."
+	dirPath := r.URL.Query().Get("path")
+	if dirPath == "" {
+		dirPath = "."
 	}
 
-	fmt.Printf(">> API: Listing files in '%s'\n", path)
+	// Pagination (?offset=&limit=) so a huge directory costs one bounded
+	// page, not a giant response. limit 0 = everything, as before.
+	offset, limit := 0, 0
+	if v := r.URL.Query().Get("offset"); v != "" {
+		parsed, err := strconv.Atoi(v)
+		if err != nil || parsed < 0 {
+			sendJSON(w, false, "offset must be a non-negative integer", nil)
+			return
+		}
+		offset = parsed
+	}
+	if v := r.URL.Query().Get("limit"); v != "" {
+		parsed, err := strconv.Atoi(v)
+		if err != nil || parsed < 0 {
+			sendJSON(w, false, "limit must be a non-negative integer", nil)
+			return
+		}
+		limit = parsed
+	}
 
-	files, err := activeSession.SftpClient.ReadDir(path)
+	fmt.Printf(">> API: Listing files in '%s'\n", dirPath)
+
+	stream, err := session.ReadDirStream(dirPath)
 	if err != nil {
 		sendJSON(w, false, "Failed to list directory: "+err.Error(), nil)
 		return
 	}
+	defer stream.Close()
 
-	// Map generic FileInfo to JSON struct
+	ctx := r.Context()
 	var fileList []FileResponse
-	for _, f := range files {
-		fileList = append(fileList, FileResponse{
-			Name:  f.Name(),
-			Size:  f.Size(),
-			IsDir: f.IsDir(),
-		})
+	skipped := 0
+	for {
+		select {
+		case <-ctx.Done():
+			return // client hung up; stop pulling entries on their behalf
+		default:
+		}
+
+		f, err := stream.Next()
+		if err != nil {
+			break // io.EOF or a mid-listing failure: serve what we have
+		}
+		if skipped < offset {
+			skipped++
+			continue
+		}
+		if limit > 0 && len(fileList) >= limit {
+			break // page is full; don't pull the rest of the directory
+		}
+
+		entry := FileResponse{
+			Name:    f.Name(),
+			Size:    f.Size(),
+			IsDir:   f.IsDir(),
+			ModTime: f.ModTime().Format(time.RFC3339),
+			Mode:    f.Mode().String(),
+		}
+		if f.Mode()&os.ModeSymlink != 0 {
+			entry.IsSymlink = true
+			if target, err := session.ReadLink(path.Join(dirPath, f.Name())); err == nil {
+				entry.Target = target
+			}
+		}
+		fileList = append(fileList, entry)
 	}
 
 	sendJSON(w, true, "OK", fileList)
 }
 
+// treeMaxEntries caps a single /api/tree walk so a pathological (or
+// maliciously deep) tree can't pin the daemon forever. The summary line
+// says when the cap was hit.
+const treeMaxEntries = 100000
+
+// treeMaxDepth is the default depth bound when the client doesn't pass one.
+const treeMaxDepth = 16
+
+func handleTree(w http.ResponseWriter, r *http.Request) {
+	sessionMu.Lock()
+	defer sessionMu.Unlock()
+
+	session, err := resolveSession(r.URL.Query().Get("session_id"))
+	if err != nil {
+		sendJSON(w, false, err.Error(), nil)
+		return
+	}
+	if !session.Ready() {
+		sendJSON(w, false, "Not connected", nil)
+		return
+	}
+
+	root := r.URL.Query().Get("path")
+	if root == "" {
+		root = "."
+	}
+	depth := treeMaxDepth
+	if d := r.URL.Query().Get("depth"); d != "" {
+		parsed, err := strconv.Atoi(d)
+		if err != nil || parsed < 1 {
+			sendJSON(w, false, "depth must be a positive integer", nil)
+			return
+		}
+		depth = parsed
+	}
+
+	if _, err := session.Stat(root); err != nil {
+		sendJSON(w, false, "Failed to stat path: "+err.Error(), nil)
+		return
+	}
+
+	fmt.Printf(">> API: Streaming tree of '%s' (depth %d)\n", root, depth)
+
+	// NDJSON: one entry per line, flushed as we go, so the UI renders a
+	// million-file tree without either side holding it in memory.
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	flusher, _ := w.(http.Flusher)
+	enc := json.NewEncoder(w)
+	emit := func(e TreeEntry) {
+		enc.Encode(e)
+		if flusher != nil {
+			flusher.Flush()
+		}
+	}
+
+	cleanRoot := path.Clean(root)
+	dirSizes := make(map[string]int64)
+	entries := 0
+	truncated := false
+	var totalBytes int64
+
+	ctx := r.Context()
+	walker := session.Walk(root)
+	for walker.Step() {
+		select {
+		case <-ctx.Done():
+			return // client went away; stop walking on their behalf
+		default:
+		}
+		if walker.Err() != nil {
+			continue
+		}
+		rel := treeRelPath(cleanRoot, walker.Path())
+		if rel == "." {
+			continue
+		}
+		stat := walker.Stat()
+
+		if entries >= treeMaxEntries {
+			truncated = true
+			break
+		}
+
+		if stat.IsDir() {
+			dirSizes[rel] = 0 // make empty dirs show up in the rollup
+			if strings.Count(rel, "/")+1 >= depth {
+				walker.SkipDir()
+			}
+			continue
+		}
+		if stat.Mode()&os.ModeSymlink != 0 {
+			continue
+		}
+
+		emit(TreeEntry{Type: "file", Path: rel, Size: stat.Size()})
+		entries++
+		totalBytes += stat.Size()
+		for d := path.Dir(rel); d != "." && d != "/"; d = path.Dir(d) {
+			dirSizes[d] += stat.Size()
+		}
+	}
+
+	// Directories come last: their aggregate size isn't known until the
+	// walk underneath them finished.
+	dirs := make([]string, 0, len(dirSizes))
+	for d := range dirSizes {
+		dirs = append(dirs, d)
+	}
+	sort.Strings(dirs)
+	for _, d := range dirs {
+		emit(TreeEntry{Type: "dir", Path: d, Size: dirSizes[d]})
+	}
+
+	emit(TreeEntry{Type: "summary", Size: totalBytes, Entries: entries, Truncated: truncated})
+}
+
+// MkdirRequest is the body of /api/mkdir: one path, or several at once for
+// pre-scaffolding a destination. Recursive maps to MkdirAll.
+type MkdirRequest struct {
+	Path      string   `json:"path,omitempty"`
+	Paths     []string `json:"paths,omitempty"`
+	Recursive bool     `json:"recursive"`
+	SessionID string   `json:"session_id,omitempty"` // empty = default session
+}
+
+// cleanMkdirPath validates one requested directory path. Traversal segments
+// are rejected rather than silently cleaned away — a UI sending ".." has a
+// bug we want surfaced, not papered over.
+func cleanMkdirPath(p string) (string, error) {
+	p = strings.TrimSpace(p)
+	if p == "" {
+		return "", fmt.Errorf("empty path")
+	}
+	cleaned := path.Clean(strings.ReplaceAll(p, "\\", "/"))
+	if cleaned == ".." || strings.HasPrefix(cleaned, "../") {
+		return "", fmt.Errorf("path escapes the remote root: %q", p)
+	}
+	return cleaned, nil
+}
+
+// handleMkdir creates one or more remote directories. Idempotent: a
+// directory that already exists is a success, like mkdir -p. Batches are
+// created in parallel, same worker count the engine uses for its own
+// directory scaffolding.
+func handleMkdir(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req MkdirRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		sendJSON(w, false, "Invalid JSON body", nil)
+		return
+	}
+
+	paths := req.Paths
+	if req.Path != "" {
+		paths = append(paths, req.Path)
+	}
+	if len(paths) == 0 {
+		sendJSON(w, false, "No path given", nil)
+		return
+	}
+	cleaned := make([]string, 0, len(paths))
+	for _, p := range paths {
+		c, err := cleanMkdirPath(p)
+		if err != nil {
+			sendJSON(w, false, err.Error(), nil)
+			return
+		}
+		cleaned = append(cleaned, c)
+	}
+
+	sessionMu.Lock()
+	defer sessionMu.Unlock()
+	session, err := resolveSession(req.SessionID)
+	if err != nil {
+		sendJSON(w, false, err.Error(), nil)
+		return
+	}
+	if !session.Ready() {
+		sendJSON(w, false, "Not connected", nil)
+		return
+	}
+
+	mkdir := func(p string) error {
+		// Idempotence: an existing directory is what the caller wanted.
+		if st, err := session.Stat(p); err == nil && st.IsDir() {
+			return nil
+		}
+		if !req.Recursive {
+			// Non-recursive means "this one level only": a missing parent
+			// is the caller's error, not something to scaffold silently.
+			if parent := path.Dir(p); parent != "." && parent != "/" {
+				if st, err := session.Stat(parent); err != nil || !st.IsDir() {
+					return fmt.Errorf("parent %s does not exist (use recursive)", parent)
+				}
+			}
+		}
+		return session.MkdirAll(p)
+	}
+
+	type mkdirResult struct {
+		path string
+		err  error
+	}
+	jobs := make(chan string, len(cleaned))
+	results := make(chan mkdirResult, len(cleaned))
+	for _, p := range cleaned {
+		jobs <- p
+	}
+	close(jobs)
+
+	workers := pfte.DirCreationWorkers
+	if workers > len(cleaned) {
+		workers = len(cleaned)
+	}
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for p := range jobs {
+				results <- mkdirResult{path: p, err: mkdir(p)}
+			}
+		}()
+	}
+	wg.Wait()
+	close(results)
+
+	var failed []string
+	for res := range results {
+		if res.err != nil {
+			failed = append(failed, fmt.Sprintf("%s: %v", res.path, res.err))
+		}
+	}
+	if len(failed) > 0 {
+		sort.Strings(failed)
+		sendJSON(w, false, "Some directories could not be created", map[string]any{"failed": failed})
+		return
+	}
+	sendJSON(w, true, fmt.Sprintf("Created %d director(y/ies)", len(cleaned)), nil)
+}
+
+// treeRelPath strips the walk root off a remote path, mirroring how the
+// engine computes relative layouts.
+func treeRelPath(root, p string) string {
+	p = path.Clean(p)
+	if p == root {
+		return "."
+	}
+	return strings.TrimPrefix(strings.TrimPrefix(p, root), "/")
+}
+
+func handlePlan(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req PlanRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		sendJSON(w, false, "Invalid JSON body", nil)
+		return
+	}
+	if req.Operation != "UPLOAD" && req.Operation != "DOWNLOAD" {
+		sendJSON(w, false, "Operation must be UPLOAD or DOWNLOAD", nil)
+		return
+	}
+
+	sessionMu.Lock()
+	defer sessionMu.Unlock()
+
+	session, err := resolveSession(req.SessionID)
+	if err != nil {
+		sendJSON(w, false, err.Error(), nil)
+		return
+	}
+	if !session.Ready() {
+		sendJSON(w, false, "Not connected", nil)
+		return
+	}
+
+	fmt.Printf(">> API: Planning %s of '%s'\n", req.Operation, req.Source)
+
+	// A throwaway engine: planning must not touch the monitor's queue or
+	// whatever transfer settings a real run is using.
+	engine := pfte.NewEngine()
+	sessions := []*network.SftpSession{session}
+	plan, err := engine.BuildPlan(r.Context(), sessions, req.Operation, req.Source, req.Dest, req.IncludeFiles)
+	if err != nil {
+		sendJSON(w, false, "Planning failed: "+err.Error(), nil)
+		return
+	}
+
+	sendJSON(w, true, "OK", plan)
+}
+
+// TransferRequest kicks off a real transfer against the active session.
+// Same shape as PlanRequest minus the planning knobs.
+type TransferRequest struct {
+	Operation string `json:"operation"` // UPLOAD or DOWNLOAD
+	Source    string `json:"source"`
+	Dest      string `json:"dest"`
+	SessionID string `json:"session_id,omitempty"` // empty = default session
+}
+
+// Transfer state for the daemon. One transfer at a time: the engine's global
+// monitor is a single set of counters, so a second concurrent run would make
+// the progress poll gibberish. Identity and outcome live here; the live
+// numbers come from pfte.GlobalMonitor as always.
+var (
+	transferMu      sync.Mutex
+	transferSeq     int
+	runningTransfer string // transfer ID while one is in flight, "" otherwise
+	transferCancel  context.CancelFunc
+	lastTransferID  string
+	lastTransferErr error
+)
+
+// handleTransfer launches Engine.StartTransfer in the background against the
+// active session and hands back a transfer ID immediately. The UI follows
+// along via /api/progress.
+func handleTransfer(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req TransferRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		sendJSON(w, false, "Invalid JSON body", nil)
+		return
+	}
+	if req.Operation != "UPLOAD" && req.Operation != "DOWNLOAD" {
+		sendJSON(w, false, "Operation must be UPLOAD or DOWNLOAD", nil)
+		return
+	}
+	if req.Source == "" {
+		sendJSON(w, false, "Source is required", nil)
+		return
+	}
+
+	sessionMu.Lock()
+	session, err := resolveSession(req.SessionID)
+	sessionMu.Unlock()
+	if err != nil {
+		sendJSON(w, false, err.Error(), nil)
+		return
+	}
+	if !session.Ready() {
+		sendJSON(w, false, "Not connected", nil)
+		return
+	}
+
+	transferMu.Lock()
+	if runningTransfer != "" {
+		id := runningTransfer
+		transferMu.Unlock()
+		sendJSON(w, false, "A transfer is already running", map[string]any{"transfer_id": id})
+		return
+	}
+	transferSeq++
+	id := fmt.Sprintf("transfer-%d", transferSeq)
+	ctx, cancel := context.WithCancel(context.Background())
+	runningTransfer = id
+	transferCancel = cancel
+	transferMu.Unlock()
+
+	fmt.Printf(">> API: Starting %s '%s' -> '%s' (%s)\n", req.Operation, req.Source, req.Dest, id)
+
+	go func() {
+		// A fresh engine per transfer, same as the CLI: settings from one
+		// run must not bleed into the next.
+		engine := pfte.NewEngine()
+		err := engine.StartTransfer(ctx, []*network.SftpSession{session}, req.Operation, req.Source, req.Dest)
+		cancel()
+
+		transferMu.Lock()
+		runningTransfer = ""
+		transferCancel = nil
+		lastTransferID = id
+		lastTransferErr = err
+		transferMu.Unlock()
+		if err != nil {
+			fmt.Printf(">> API: Transfer %s failed: %v\n", id, err)
+		} else {
+			fmt.Printf(">> API: Transfer %s finished\n", id)
+		}
+	}()
+
+	sendJSON(w, true, "Transfer started", map[string]any{"transfer_id": id})
+}
+
+// handleCancelTransfer aborts the daemon-launched transfer, if one is
+// running. Cancelling the context stops the worker loop and any in-flight
+// copy; the transfer goroutine then records the outcome as usual.
+func handleCancelTransfer(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	transferMu.Lock()
+	id, cancel := runningTransfer, transferCancel
+	transferMu.Unlock()
+	if id == "" || cancel == nil {
+		sendJSON(w, false, "No transfer is currently running", nil)
+		return
+	}
+
+	fmt.Printf(">> API: Cancelling transfer %s\n", id)
+	cancel()
+	// Flip the flag immediately so the next progress poll already says
+	// stopped, even if the workers take a moment to wind down.
+	pfte.GlobalMonitor.SetRunning(false)
+	sendJSON(w, true, "Transfer cancelled", map[string]any{"transfer_id": id})
+}
+
+// WorkersRequest asks for a new live worker count.
+type WorkersRequest struct {
+	Count int `json:"count"`
+}
+
+func handleScaleWorkers(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req WorkersRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		sendJSON(w, false, "Invalid JSON body", nil)
+		return
+	}
+	if req.Count < 1 {
+		sendJSON(w, false, "count must be >= 1", nil)
+		return
+	}
+
+	if !pfte.ScaleWorkers(req.Count) {
+		sendJSON(w, false, "No transfer is currently running", nil)
+		return
+	}
+	fmt.Printf(">> API: Scaled workers to %d\n", req.Count)
+	sendJSON(w, true, "Worker count updated", nil)
+}
+
+// ProgressResponse is the transfer snapshot plus session health, so one
+// poll drives both the progress bar and the connection indicator.
+type ProgressResponse struct {
+	pfte.TransferStats
+	Connection string `json:"connection"`
+
+	// The daemon-launched transfer the counters belong to, if any.
+	TransferID    string `json:"transfer_id,omitempty"`
+	TransferState string `json:"transfer_state,omitempty"` // "running", "done", "failed"
+	TransferError string `json:"transfer_error,omitempty"`
+}
+
+// progressSnapshot assembles the full progress picture: monitor counters,
+// session health, and the daemon transfer state. Shared by the poll and the
+// stream endpoint.
+func progressSnapshot() ProgressResponse {
+	stats := pfte.GlobalMonitor.GetStats()
+
+	sessionMu.Lock()
+	health := connectionHealth()
+	sessionMu.Unlock()
+
+	resp := ProgressResponse{TransferStats: stats, Connection: health.String()}
+	transferMu.Lock()
+	switch {
+	case runningTransfer != "":
+		resp.TransferID, resp.TransferState = runningTransfer, "running"
+	case lastTransferErr != nil:
+		resp.TransferID, resp.TransferState = lastTransferID, "failed"
+		resp.TransferError = lastTransferErr.Error()
+	case lastTransferID != "":
+		resp.TransferID, resp.TransferState = lastTransferID, "done"
+	}
+	transferMu.Unlock()
+	return resp
+}
+
 func handleProgress(w http.ResponseWriter, r *http.Request) {
 	// Flutter will poll this endpoint frequently (e.g. 200ms).
 	// We return a snapshot of the atomic counters from the engine.
-	stats := pfte.GlobalMonitor.GetStats()
+	sendJSON(w, true, "OK", progressSnapshot())
+}
+
+// streamTick is the pacing of /api/progress/stream: check for movement at
+// ~10Hz, which is smooth for a progress bar and negligible for the daemon.
+const streamTick = 100 * time.Millisecond
 
-	sendJSON(w, true, "OK", stats)
+// handleProgressStream is the push flavour of /api/progress: Server-Sent
+// Events, one ProgressResponse JSON frame whenever the numbers move. A
+// finished transfer gets one last frame so the bar lands on 100%, then the
+// stream ends; otherwise it runs until the client hangs up.
+func handleProgressStream(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+
+	enc := json.NewEncoder(w)
+	emit := func(snap ProgressResponse) {
+		fmt.Fprintf(w, "data: ")
+		enc.Encode(snap)
+		fmt.Fprintf(w, "\n")
+		flusher.Flush()
+	}
+
+	// First frame immediately, so the UI has something to draw before any
+	// bytes move.
+	last := progressSnapshot()
+	emit(last)
+
+	ticker := time.NewTicker(streamTick)
+	defer ticker.Stop()
+	ctx := r.Context()
+	for {
+		select {
+		case <-ctx.Done():
+			return // client went away; stop the goroutine with it
+		case <-ticker.C:
+		}
+
+		snap := progressSnapshot()
+		moved := snap.BytesDone != last.BytesDone ||
+			snap.FilesDone != last.FilesDone ||
+			snap.TransferState != last.TransferState ||
+			snap.Connection != last.Connection
+		if !moved {
+			continue
+		}
+		emit(snap)
+
+		// The final frame: a transfer we were following just stopped.
+		if last.TransferState == "running" && snap.TransferState != "running" {
+			return
+		}
+		last = snap
+	}
 }
 
 // -- Helpers --
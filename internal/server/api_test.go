@@ -0,0 +1,803 @@
+/*
+ * Copyright 2026 The FileRipper Team
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package server
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"fileripper/internal/network"
+	"fileripper/internal/pfte"
+	"fileripper/internal/sftptest"
+)
+
+func TestFileResponseEncodesSpecialNames(t *testing.T) {
+	// The UI must receive filenames byte-for-byte, no matter how weird.
+	names := []string{
+		"my report (final).pdf",
+		"100% done #2.txt",
+		"résumé 日本語.doc",
+		"it's \"quoted\".txt",
+		"trailing.dot.",
+	}
+
+	for _, name := range names {
+		in := FileResponse{Name: name, Size: 42}
+		data, err := json.Marshal(in)
+		if err != nil {
+			t.Fatalf("marshal %q: %v", name, err)
+		}
+		var out FileResponse
+		if err := json.Unmarshal(data, &out); err != nil {
+			t.Fatalf("unmarshal %q: %v", name, err)
+		}
+		if out.Name != name {
+			t.Errorf("name round-trip: got %q, want %q", out.Name, name)
+		}
+	}
+}
+
+func TestFileResponseCarriesMetadata(t *testing.T) {
+	in := FileResponse{
+		Name:      "current",
+		Size:      0,
+		ModTime:   "2026-08-01T12:30:00Z",
+		Mode:      "Lrwxrwxrwx",
+		IsSymlink: true,
+		Target:    "releases/v42",
+	}
+	data, err := json.Marshal(in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded map[string]any
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	for key, want := range map[string]any{
+		"mod_time":   "2026-08-01T12:30:00Z",
+		"mode":       "Lrwxrwxrwx",
+		"is_symlink": true,
+		"target":     "releases/v42",
+	} {
+		if decoded[key] != want {
+			t.Errorf("%s = %v, want %v", key, decoded[key], want)
+		}
+	}
+	// Legacy keys must survive for old consumers.
+	for _, key := range []string{"name", "size", "is_dir"} {
+		if _, ok := decoded[key]; !ok {
+			t.Errorf("legacy key %q missing from payload", key)
+		}
+	}
+}
+
+// withTestSession swaps the daemon's active session for one backed by an
+// in-process SFTP server rooted at a temp dir, restoring it afterwards.
+func withTestSession(t *testing.T) string {
+	t.Helper()
+	root := t.TempDir()
+	srv, err := sftptest.Start(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(srv.Close)
+
+	sess := network.NewSession(srv.Host, srv.Port, sftptest.User, sftptest.Password)
+	if err := sess.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	if err := sess.OpenSFTP(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(sess.Close)
+
+	sessionMu.Lock()
+	prev, prevState := activeSession, connState
+	activeSession = sess
+	connState = ConnConnected
+	lastHealthProbe = time.Now()
+	sessionMu.Unlock()
+	t.Cleanup(func() {
+		sessionMu.Lock()
+		activeSession, connState = prev, prevState
+		sessionMu.Unlock()
+	})
+	return root
+}
+
+func TestTreeStreamsSubtreeWithRollup(t *testing.T) {
+	root := withTestSession(t)
+	for rel, content := range map[string]string{
+		"proj/a.txt":       "12345",
+		"proj/sub/b.txt":   "1234567890",
+		"proj/sub/c.txt":   "12",
+		"proj/deep/x/y.go": "1234",
+	} {
+		full := filepath.Join(root, filepath.FromSlash(rel))
+		if err := os.MkdirAll(filepath.Dir(full), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(full, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	req := httptest.NewRequest("GET", "/api/tree?path=proj", nil)
+	rec := httptest.NewRecorder()
+	handleTree(rec, req)
+
+	if ct := rec.Header().Get("Content-Type"); ct != "application/x-ndjson" {
+		t.Fatalf("Content-Type = %q (body: %s)", ct, rec.Body.String())
+	}
+
+	files := map[string]int64{}
+	dirs := map[string]int64{}
+	var summary TreeEntry
+	scanner := bufio.NewScanner(rec.Body)
+	for scanner.Scan() {
+		var e TreeEntry
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			t.Fatalf("bad NDJSON line %q: %v", scanner.Text(), err)
+		}
+		switch e.Type {
+		case "file":
+			files[e.Path] = e.Size
+		case "dir":
+			dirs[e.Path] = e.Size
+		case "summary":
+			summary = e
+		}
+	}
+
+	if len(files) != 4 {
+		t.Errorf("files = %v, want 4 entries", files)
+	}
+	if files["sub/b.txt"] != 10 {
+		t.Errorf("sub/b.txt size = %d, want 10", files["sub/b.txt"])
+	}
+	if dirs["sub"] != 12 {
+		t.Errorf("dir rollup for sub = %d, want 12", dirs["sub"])
+	}
+	if dirs["deep"] != 4 || dirs["deep/x"] != 4 {
+		t.Errorf("nested rollups = %v, want deep=4 deep/x=4", dirs)
+	}
+	if summary.Entries != 4 || summary.Size != 21 || summary.Truncated {
+		t.Errorf("summary = %+v, want 4 entries / 21 bytes / not truncated", summary)
+	}
+}
+
+func TestTreeDepthBound(t *testing.T) {
+	root := withTestSession(t)
+	for _, rel := range []string{"proj/top.txt", "proj/sub/mid.txt", "proj/sub/deeper/low.txt"} {
+		full := filepath.Join(root, filepath.FromSlash(rel))
+		if err := os.MkdirAll(filepath.Dir(full), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(full, []byte("x"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	req := httptest.NewRequest("GET", "/api/tree?path=proj&depth=1", nil)
+	rec := httptest.NewRecorder()
+	handleTree(rec, req)
+
+	body := rec.Body.String()
+	if strings.Contains(body, "mid.txt") || strings.Contains(body, "low.txt") {
+		t.Errorf("depth=1 should not descend into sub/: %s", body)
+	}
+	if !strings.Contains(body, "top.txt") {
+		t.Errorf("depth=1 should still list the top level: %s", body)
+	}
+}
+
+func TestProgressReportsConnectionState(t *testing.T) {
+	progressConnection := func() string {
+		req := httptest.NewRequest("GET", "/api/progress", nil)
+		rec := httptest.NewRecorder()
+		handleProgress(rec, req)
+
+		var resp ApiResponse
+		if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("bad progress payload: %v", err)
+		}
+		data, ok := resp.Data.(map[string]any)
+		if !ok {
+			t.Fatalf("progress data = %T, want object", resp.Data)
+		}
+		conn, _ := data["connection"].(string)
+		return conn
+	}
+
+	if got := progressConnection(); got != "disconnected" {
+		t.Errorf("without a session: connection = %q, want disconnected", got)
+	}
+
+	withTestSession(t)
+	if got := progressConnection(); got != "connected" {
+		t.Errorf("with a live session: connection = %q, want connected", got)
+	}
+
+	// Kill the socket under the daemon and force the next poll to probe:
+	// the stale "connected" must not survive.
+	sessionMu.Lock()
+	activeSession.Close()
+	lastHealthProbe = time.Time{}
+	sessionMu.Unlock()
+	if got := progressConnection(); got != "disconnected" {
+		t.Errorf("after the socket died: connection = %q, want disconnected", got)
+	}
+}
+
+// hugeDirFS fakes a directory with a million entries, generated lazily, and
+// counts how many the caller actually pulled. The embedded interface covers
+// the RemoteFS methods this test never touches.
+type hugeDirFS struct {
+	network.RemoteFS
+	entries int
+	pulled  int
+}
+
+func (f *hugeDirFS) ReadDirStream(dir string) (network.DirStream, error) {
+	return &hugeDirStream{fs: f}, nil
+}
+
+type hugeDirStream struct {
+	fs   *hugeDirFS
+	next int
+}
+
+func (d *hugeDirStream) Next() (os.FileInfo, error) {
+	if d.next >= d.fs.entries {
+		return nil, io.EOF
+	}
+	d.fs.pulled++
+	info := fakeInfo{name: fmt.Sprintf("file-%07d.dat", d.next)}
+	d.next++
+	return info, nil
+}
+
+func (d *hugeDirStream) Close() error { return nil }
+
+// fakeInfo is the minimal os.FileInfo for a plain file.
+type fakeInfo struct{ name string }
+
+func (i fakeInfo) Name() string       { return i.name }
+func (i fakeInfo) Size() int64        { return 1 }
+func (i fakeInfo) Mode() os.FileMode  { return 0644 }
+func (i fakeInfo) ModTime() time.Time { return time.Unix(0, 0) }
+func (i fakeInfo) IsDir() bool        { return false }
+func (i fakeInfo) Sys() interface{}   { return nil }
+
+func TestListFilesPaginatesWithoutSlurping(t *testing.T) {
+	fs := &hugeDirFS{entries: 1_000_000}
+	sessionMu.Lock()
+	prev := activeSession
+	activeSession = &network.SftpSession{Hostname: "fake", FS: fs}
+	sessionMu.Unlock()
+	t.Cleanup(func() {
+		sessionMu.Lock()
+		activeSession = prev
+		sessionMu.Unlock()
+	})
+
+	req := httptest.NewRequest("GET", "/api/files?path=/big&offset=500&limit=25", nil)
+	rec := httptest.NewRecorder()
+	handleListFiles(rec, req)
+
+	var resp ApiResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("bad response body: %v", err)
+	}
+	if !resp.Success {
+		t.Fatalf("list failed: %s", resp.Message)
+	}
+	page, ok := resp.Data.([]interface{})
+	if !ok {
+		t.Fatalf("expected a list, got %T", resp.Data)
+	}
+	if len(page) != 25 {
+		t.Fatalf("expected 25 entries, got %d", len(page))
+	}
+	first := page[0].(map[string]interface{})
+	if first["name"] != "file-0000500.dat" {
+		t.Errorf("page starts at %v, want file-0000500.dat", first["name"])
+	}
+
+	// The whole point: a full page must not cost a full listing.
+	if fs.pulled > 526 {
+		t.Errorf("handler pulled %d entries for a 25-entry page", fs.pulled)
+	}
+
+	// Bad pagination params are rejected, not silently ignored.
+	req = httptest.NewRequest("GET", "/api/files?path=/big&offset=-1", nil)
+	rec = httptest.NewRecorder()
+	handleListFiles(rec, req)
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("bad response body: %v", err)
+	}
+	if resp.Success {
+		t.Error("negative offset should be rejected")
+	}
+}
+
+func TestConnectParksUnknownHostUntilTrusted(t *testing.T) {
+	t.Setenv("HOME", t.TempDir()) // isolate ~/.fileripper/known_hosts.json
+
+	srv, err := sftptest.Start(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Close()
+
+	sessionMu.Lock()
+	prev, prevState := activeSession, connState
+	activeSession, pendingTrust = nil, nil
+	sessionMu.Unlock()
+	defer func() {
+		sessionMu.Lock()
+		if activeSession != nil {
+			activeSession.Close()
+		}
+		activeSession, connState, pendingTrust = prev, prevState, nil
+		sessionMu.Unlock()
+	}()
+
+	connectBody := fmt.Sprintf(`{"host":%q,"port":%d,"user":%q,"password":%q}`,
+		srv.Host, srv.Port, sftptest.User, sftptest.Password)
+	post := func(path, body string, handler http.HandlerFunc) ApiResponse {
+		req := httptest.NewRequest("POST", path, strings.NewReader(body))
+		rec := httptest.NewRecorder()
+		handler(rec, req)
+		var resp ApiResponse
+		if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("bad response from %s: %v", path, err)
+		}
+		return resp
+	}
+
+	// 1. Unknown host: the connect parks and hands back the fingerprint.
+	resp := post("/api/connect", connectBody, handleConnect)
+	if resp.Success {
+		t.Fatalf("unknown host should not connect straight away: %+v", resp)
+	}
+	data, _ := resp.Data.(map[string]any)
+	if data["pending"] != true {
+		t.Fatalf("expected a pending host-key decision, got %+v", resp)
+	}
+	fingerprint, _ := data["fingerprint"].(string)
+	if !strings.HasPrefix(fingerprint, "SHA256:") {
+		t.Fatalf("fingerprint = %q, want a SHA256 one", fingerprint)
+	}
+
+	// 2. Trust permanently: the connection completes and the decision sticks.
+	resp = post("/api/trust-host", `{"decision":"permanent"}`, handleTrustHost)
+	if !resp.Success {
+		t.Fatalf("trust-host: %+v", resp)
+	}
+	sessionMu.Lock()
+	connected := activeSession != nil && activeSession.SftpClient != nil
+	sessionMu.Unlock()
+	if !connected {
+		t.Fatal("trusting the host should have completed the SFTP connection")
+	}
+
+	// 3. Reconnects go straight through now.
+	resp = post("/api/connect", connectBody, handleConnect)
+	if !resp.Success {
+		t.Fatalf("known host should connect directly: %+v", resp)
+	}
+
+	// 4. A changed key is refused outright — no dialog for a MITM.
+	path, err := trustStorePath()
+	if err != nil {
+		t.Fatal(err)
+	}
+	store, err := loadTrustStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	store[trustKey(srv.Host, srv.Port)] = "SHA256:somethingelseentirely"
+	if err := saveTrustStore(path, store); err != nil {
+		t.Fatal(err)
+	}
+	resp = post("/api/connect", connectBody, handleConnect)
+	if resp.Success || !strings.Contains(resp.Message, "mismatch") {
+		t.Errorf("changed host key should fail with a mismatch, got %+v", resp)
+	}
+
+	// 5. trust-host with nothing pending is an error, not a crash.
+	resp = post("/api/trust-host", `{"decision":"once"}`, handleTrustHost)
+	if resp.Success {
+		t.Errorf("no pending decision should be an error, got %+v", resp)
+	}
+}
+
+func TestMkdirIsIdempotentAndBatched(t *testing.T) {
+	root := withTestSession(t)
+
+	post := func(body string) ApiResponse {
+		req := httptest.NewRequest("POST", "/api/mkdir", strings.NewReader(body))
+		rec := httptest.NewRecorder()
+		handleMkdir(rec, req)
+		var resp ApiResponse
+		if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("bad mkdir response: %v", err)
+		}
+		return resp
+	}
+
+	// Single recursive create, twice: both succeed (mkdir -p semantics).
+	for i := 0; i < 2; i++ {
+		if resp := post(`{"path":"projects/2026/reports","recursive":true}`); !resp.Success {
+			t.Fatalf("attempt %d: %+v", i+1, resp)
+		}
+	}
+	if st, err := os.Stat(filepath.Join(root, "projects", "2026", "reports")); err != nil || !st.IsDir() {
+		t.Fatalf("directory was not created: %v", err)
+	}
+
+	// Batch variant.
+	if resp := post(`{"paths":["batch/a","batch/b","batch/c"],"recursive":true}`); !resp.Success {
+		t.Fatalf("batch: %+v", resp)
+	}
+	for _, d := range []string{"a", "b", "c"} {
+		if st, err := os.Stat(filepath.Join(root, "batch", d)); err != nil || !st.IsDir() {
+			t.Errorf("batch dir %s missing: %v", d, err)
+		}
+	}
+
+	// Non-recursive with a missing parent must refuse.
+	if resp := post(`{"path":"nowhere/deep"}`); resp.Success {
+		t.Error("missing parent without recursive should fail")
+	}
+
+	// Traversal is rejected before touching the session.
+	if resp := post(`{"path":"../escape","recursive":true}`); resp.Success {
+		t.Error("traversal path should be rejected")
+	}
+}
+
+func TestTransferEndpointRunsInBackground(t *testing.T) {
+	root := withTestSession(t)
+
+	src := t.TempDir()
+	if err := os.WriteFile(filepath.Join(src, "payload.txt"), []byte("over the wire"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	post := func(body string) ApiResponse {
+		req := httptest.NewRequest("POST", "/api/transfer", strings.NewReader(body))
+		rec := httptest.NewRecorder()
+		handleTransfer(rec, req)
+		var resp ApiResponse
+		if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("bad transfer response: %v", err)
+		}
+		return resp
+	}
+
+	// Bad operation is rejected before anything launches.
+	if resp := post(`{"operation":"SIDEWAYS","source":"x"}`); resp.Success {
+		t.Error("bogus operation should be rejected")
+	}
+
+	// Trailing slash: rsync semantics, upload the contents, not the dir.
+	body := fmt.Sprintf(`{"operation":"UPLOAD","source":%q,"dest":"landed"}`, src+"/")
+	resp := post(body)
+	if !resp.Success {
+		t.Fatalf("transfer did not start: %+v", resp)
+	}
+	data, _ := resp.Data.(map[string]any)
+	id, _ := data["transfer_id"].(string)
+	if id == "" {
+		t.Fatalf("no transfer ID in %+v", resp)
+	}
+
+	// Poll progress until the job reports done, like the UI would.
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		req := httptest.NewRequest("GET", "/api/progress", nil)
+		rec := httptest.NewRecorder()
+		handleProgress(rec, req)
+		var pr ApiResponse
+		if err := json.Unmarshal(rec.Body.Bytes(), &pr); err != nil {
+			t.Fatalf("bad progress payload: %v", err)
+		}
+		pd, _ := pr.Data.(map[string]any)
+		state, _ := pd["transfer_state"].(string)
+		if state == "done" && pd["transfer_id"] == id {
+			break
+		}
+		if state == "failed" {
+			t.Fatalf("transfer failed: %v", pd["transfer_error"])
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("transfer never finished (state %q)", state)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+
+	got, err := os.ReadFile(filepath.Join(root, "landed", "payload.txt"))
+	if err != nil || string(got) != "over the wire" {
+		t.Fatalf("uploaded file wrong: %q, %v", got, err)
+	}
+
+	// A second transfer while one is marked running is refused.
+	transferMu.Lock()
+	runningTransfer = "transfer-held"
+	transferMu.Unlock()
+	defer func() {
+		transferMu.Lock()
+		runningTransfer = ""
+		transferMu.Unlock()
+	}()
+	if resp := post(body); resp.Success {
+		t.Error("concurrent transfer should be rejected")
+	}
+}
+
+func TestCancelEndpointStopsTheRunningTransfer(t *testing.T) {
+	post := func() ApiResponse {
+		req := httptest.NewRequest("POST", "/api/cancel", nil)
+		rec := httptest.NewRecorder()
+		handleCancelTransfer(rec, req)
+		var resp ApiResponse
+		if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("bad cancel response: %v", err)
+		}
+		return resp
+	}
+
+	// Nothing running: the caller is told so.
+	if resp := post(); resp.Success {
+		t.Error("cancel with no transfer should be refused")
+	}
+
+	// Wire up a fake in-flight transfer and make sure cancel reaches its
+	// context.
+	ctx, cancel := context.WithCancel(context.Background())
+	transferMu.Lock()
+	runningTransfer, transferCancel = "transfer-test", cancel
+	transferMu.Unlock()
+	defer func() {
+		transferMu.Lock()
+		runningTransfer, transferCancel = "", nil
+		transferMu.Unlock()
+	}()
+
+	resp := post()
+	if !resp.Success {
+		t.Fatalf("cancel: %+v", resp)
+	}
+	data, _ := resp.Data.(map[string]any)
+	if data["transfer_id"] != "transfer-test" {
+		t.Errorf("cancelled the wrong transfer: %+v", resp)
+	}
+	select {
+	case <-ctx.Done():
+	default:
+		t.Error("cancel endpoint did not cancel the transfer context")
+	}
+}
+
+func TestProgressStreamPushesFramesAndEnds(t *testing.T) {
+	pfte.GlobalMonitor.Reset(1, 100)
+	transferMu.Lock()
+	runningTransfer, lastTransferID, lastTransferErr = "transfer-sse", "", nil
+	transferMu.Unlock()
+	defer func() {
+		transferMu.Lock()
+		runningTransfer, lastTransferID, lastTransferErr = "", "", nil
+		transferMu.Unlock()
+		pfte.GlobalMonitor.Reset(0, 0)
+	}()
+
+	srv := httptest.NewServer(http.HandlerFunc(handleProgressStream))
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Fatalf("Content-Type = %q", ct)
+	}
+
+	scanner := bufio.NewScanner(resp.Body)
+	nextFrame := func() ProgressResponse {
+		t.Helper()
+		for scanner.Scan() {
+			line := scanner.Text()
+			if !strings.HasPrefix(line, "data: ") {
+				continue
+			}
+			var frame ProgressResponse
+			if err := json.Unmarshal([]byte(strings.TrimPrefix(line, "data: ")), &frame); err != nil {
+				t.Fatalf("bad SSE frame %q: %v", line, err)
+			}
+			return frame
+		}
+		t.Fatalf("stream ended early: %v", scanner.Err())
+		return ProgressResponse{}
+	}
+
+	// Frame 1 arrives immediately, before anything moved.
+	if frame := nextFrame(); frame.TransferState != "running" || frame.BytesDone != 0 {
+		t.Fatalf("first frame = %+v", frame)
+	}
+
+	// Move the counters: a new frame shows up on its own.
+	pfte.GlobalMonitor.AddBytes(50)
+	if frame := nextFrame(); frame.BytesDone != 50 {
+		t.Fatalf("progress frame = %+v", frame)
+	}
+
+	// Finish the transfer: one final frame, then the stream closes.
+	transferMu.Lock()
+	runningTransfer, lastTransferID = "", "transfer-sse"
+	transferMu.Unlock()
+	if frame := nextFrame(); frame.TransferState != "done" {
+		t.Fatalf("final frame = %+v", frame)
+	}
+	deadline := time.After(5 * time.Second)
+	closed := make(chan bool)
+	go func() {
+		// Only frame separators may remain before EOF.
+		for scanner.Scan() {
+			if strings.HasPrefix(scanner.Text(), "data: ") {
+				closed <- false
+				return
+			}
+		}
+		closed <- true
+	}()
+	select {
+	case ok := <-closed:
+		if !ok {
+			t.Error("stream kept going after the final frame")
+		}
+	case <-deadline:
+		t.Error("stream did not close after the transfer finished")
+	}
+}
+
+func TestSessionRegistryServesTwoServers(t *testing.T) {
+	t.Setenv("HOME", t.TempDir()) // isolate ~/.fileripper/known_hosts.json
+
+	rootA, rootB := t.TempDir(), t.TempDir()
+	if err := os.WriteFile(filepath.Join(rootA, "on-a.txt"), []byte("a"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(rootB, "on-b.txt"), []byte("b"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	srvA, err := sftptest.Start(rootA)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer srvA.Close()
+	srvB, err := sftptest.Start(rootB)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer srvB.Close()
+
+	sessionMu.Lock()
+	prev, prevState, prevRegistry := activeSession, connState, sessionRegistry
+	activeSession, pendingTrust, sessionRegistry = nil, nil, map[string]*registeredSession{}
+	sessionMu.Unlock()
+	defer func() {
+		sessionMu.Lock()
+		for _, entry := range sessionRegistry {
+			entry.session.Close()
+		}
+		activeSession, connState, pendingTrust, sessionRegistry = prev, prevState, nil, prevRegistry
+		sessionMu.Unlock()
+	}()
+
+	do := func(method, path, body string, handler http.HandlerFunc) ApiResponse {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		rec := httptest.NewRecorder()
+		handler(rec, req)
+		var resp ApiResponse
+		if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("bad response from %s: %v", path, err)
+		}
+		return resp
+	}
+	connect := func(srv *sftptest.Server) string {
+		t.Helper()
+		body := fmt.Sprintf(`{"host":%q,"port":%d,"user":%q,"password":%q}`,
+			srv.Host, srv.Port, sftptest.User, sftptest.Password)
+		resp := do("POST", "/api/connect", body, handleConnect)
+		if !resp.Success {
+			// First contact parks on the host key; trust it and go on.
+			if resp = do("POST", "/api/trust-host", `{"decision":"once"}`, handleTrustHost); !resp.Success {
+				t.Fatalf("trust-host: %+v", resp)
+			}
+		}
+		data, _ := resp.Data.(map[string]any)
+		id, _ := data["session_id"].(string)
+		if id == "" {
+			t.Fatalf("connect returned no session_id: %+v", resp)
+		}
+		return id
+	}
+
+	idA := connect(srvA)
+	idB := connect(srvB)
+	if idA == idB {
+		t.Fatalf("both servers got session %q", idA)
+	}
+
+	// Both stay browsable, each under its own ID.
+	listNames := func(sessionID string) string {
+		resp := do("GET", "/api/files?session_id="+sessionID, "", handleListFiles)
+		if !resp.Success {
+			t.Fatalf("list %s: %+v", sessionID, resp)
+		}
+		out, _ := json.Marshal(resp.Data)
+		return string(out)
+	}
+	if got := listNames(idA); !strings.Contains(got, "on-a.txt") {
+		t.Errorf("session %s should see server A: %s", idA, got)
+	}
+	if got := listNames(idB); !strings.Contains(got, "on-b.txt") {
+		t.Errorf("session %s should see server B: %s", idB, got)
+	}
+
+	// The registry lists both, newest as the default.
+	resp := do("GET", "/api/sessions", "", handleSessions)
+	rows, _ := resp.Data.([]any)
+	if len(rows) != 2 {
+		t.Fatalf("sessions = %v, want 2 rows", resp.Data)
+	}
+	for _, row := range rows {
+		info := row.(map[string]any)
+		if wantDefault := info["id"] == idB; info["default"] != wantDefault {
+			t.Errorf("session %v default = %v, want %v", info["id"], info["default"], wantDefault)
+		}
+	}
+
+	// Disconnect one by ID; the other keeps working.
+	if resp := do("POST", "/api/disconnect", fmt.Sprintf(`{"session_id":%q}`, idA), handleDisconnect); !resp.Success {
+		t.Fatalf("disconnect %s: %+v", idA, resp)
+	}
+	if resp := do("GET", "/api/files?session_id="+idA, "", handleListFiles); resp.Success {
+		t.Error("listing a disconnected session should fail")
+	}
+	if got := listNames(idB); !strings.Contains(got, "on-b.txt") {
+		t.Errorf("session %s should survive A's disconnect: %s", idB, got)
+	}
+	resp = do("GET", "/api/sessions", "", handleSessions)
+	if rows, _ := resp.Data.([]any); len(rows) != 1 {
+		t.Errorf("sessions after disconnect = %v, want 1 row", resp.Data)
+	}
+}
@@ -0,0 +1,190 @@
+/*
+ * Copyright 2026 The FileRipper Team
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+
+	"fileripper/internal/network"
+)
+
+// Host-key trust for the daemon: the standard SSH "authenticity of host ...
+// can't be established" flow, split across two API calls so a UI can put a
+// dialog in the middle. /api/connect against an unknown host parks the
+// request and answers with the fingerprint; /api/trust-host records the
+// user's decision (once, permanent, reject) and finishes the connection.
+//
+// We don't literally hold the half-open SSH handshake between the calls —
+// blocking inside the ssh library's callback across an arbitrary user
+// pause is asking for trouble. Instead the pending request is kept and the
+// connect is redone pinned to the exact fingerprint the user approved,
+// which is the same guarantee with none of the fragility.
+
+// errHostKeyUnknown marks "we need the user's decision" apart from a real
+// verification failure.
+var errHostKeyUnknown = fmt.Errorf("host_key_unknown")
+
+// pendingConnect is a connect request waiting on a trust decision.
+type pendingConnect struct {
+	req         ConnectRequest
+	fingerprint string
+}
+
+// pendingTrust is guarded by sessionMu like the rest of the session state.
+var pendingTrust *pendingConnect
+
+// trustStorePath is where permanent decisions live:
+// ~/.fileripper/known_hosts.json, a host:port -> fingerprint map.
+func trustStorePath() (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("cannot locate home directory: %v", err)
+	}
+	return filepath.Join(home, ".fileripper", "known_hosts.json"), nil
+}
+
+func loadTrustStore(path string) (map[string]string, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return map[string]string{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	store := map[string]string{}
+	if err := json.Unmarshal(data, &store); err != nil {
+		return nil, fmt.Errorf("invalid trust store %s: %v", path, err)
+	}
+	return store, nil
+}
+
+func saveTrustStore(path string, store map[string]string) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(store, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0600)
+}
+
+func trustKey(host string, port int) string {
+	return fmt.Sprintf("%s:%d", host, port)
+}
+
+// checkedConnect runs the SSH handshake with host-key verification against
+// the trust store. pinned, when non-empty, is a fingerprint the user just
+// approved and overrides the store for this one connect. The fingerprint
+// the server presented comes back either way, so an unknown host can be
+// parked for /api/trust-host. Callers hold sessionMu.
+func checkedConnect(session *network.SftpSession, req ConnectRequest, pinned string) (string, error) {
+	known := ""
+	if path, err := trustStorePath(); err == nil {
+		if store, err := loadTrustStore(path); err == nil {
+			known = store[trustKey(req.Host, req.Port)]
+		}
+	}
+
+	var seen string
+	session.HostKeyCheck = func(hostname, fingerprint string) error {
+		seen = fingerprint
+		if pinned != "" && fingerprint == pinned {
+			return nil
+		}
+		if known != "" {
+			if fingerprint == known {
+				return nil
+			}
+			// A changed key on a known host is the one case that must
+			// never turn into a dialog with an "accept" button.
+			return fmt.Errorf("host key mismatch for %s: known %s, server presented %s",
+				hostname, known, fingerprint)
+		}
+		return errHostKeyUnknown
+	}
+
+	err := session.Connect()
+	if err == errHostKeyUnknown {
+		pendingTrust = &pendingConnect{req: req, fingerprint: seen}
+	}
+	return seen, err
+}
+
+// TrustRequest is the body of /api/trust-host.
+type TrustRequest struct {
+	// Decision is "once", "permanent" or "reject".
+	Decision string `json:"decision"`
+}
+
+// handleTrustHost completes (or abandons) a connect that stopped at an
+// unknown host key.
+func handleTrustHost(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req TrustRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		sendJSON(w, false, "Invalid JSON body", nil)
+		return
+	}
+
+	sessionMu.Lock()
+	pending := pendingTrust
+	pendingTrust = nil
+	sessionMu.Unlock()
+
+	if pending == nil {
+		sendJSON(w, false, "No host key decision is pending", nil)
+		return
+	}
+
+	switch req.Decision {
+	case "reject":
+		sendJSON(w, true, "Host rejected; nothing was connected", nil)
+		return
+	case "permanent":
+		path, err := trustStorePath()
+		if err != nil {
+			sendJSON(w, false, err.Error(), nil)
+			return
+		}
+		store, err := loadTrustStore(path)
+		if err != nil {
+			sendJSON(w, false, err.Error(), nil)
+			return
+		}
+		store[trustKey(pending.req.Host, pending.req.Port)] = pending.fingerprint
+		if err := saveTrustStore(path, store); err != nil {
+			sendJSON(w, false, "Could not persist trust decision: "+err.Error(), nil)
+			return
+		}
+	case "once":
+		// Nothing to persist; the pinned fingerprint below covers this dial.
+	default:
+		sendJSON(w, false, fmt.Sprintf("Unknown decision %q (want once, permanent or reject)", req.Decision), nil)
+		return
+	}
+
+	finishConnect(w, pending.req, pending.fingerprint)
+}
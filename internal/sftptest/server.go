@@ -0,0 +1,205 @@
+/*
+ * Copyright 2026 The FileRipper Team
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package sftptest runs a throwaway in-process SSH+SFTP server so the engine
+// and transfer code can be exercised end to end without a real host.
+// Relative remote paths resolve under the server's root directory.
+package sftptest
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+)
+
+// Default credentials the test server accepts.
+const (
+	User     = "test"
+	Password = "test"
+)
+
+// Server is a minimal SSH server exposing only the SFTP subsystem.
+type Server struct {
+	Host string
+	Port int
+	Root string // directory relative remote paths resolve against
+
+	// HostKeyFingerprint is the SHA-256 fingerprint of the throwaway host
+	// key, for tests exercising host key verification.
+	HostKeyFingerprint string
+
+	listener net.Listener
+	config   *ssh.ServerConfig
+
+	mu     sync.Mutex
+	closed bool
+}
+
+// Start launches the server on a random localhost port.
+// Callers must Close() it when done.
+func Start(root string) (*Server, error) {
+	config := &ssh.ServerConfig{
+		PasswordCallback: func(conn ssh.ConnMetadata, pass []byte) (*ssh.Permissions, error) {
+			if conn.User() == User && string(pass) == Password {
+				return nil, nil
+			}
+			return nil, fmt.Errorf("wrong credentials")
+		},
+	}
+
+	// Fresh throwaway host key per server; nobody verifies it anyway.
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	signer, err := ssh.NewSignerFromKey(priv)
+	if err != nil {
+		return nil, err
+	}
+	config.AddHostKey(signer)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+
+	srv := &Server{
+		Host:               "127.0.0.1",
+		Port:               listener.Addr().(*net.TCPAddr).Port,
+		Root:               root,
+		HostKeyFingerprint: ssh.FingerprintSHA256(signer.PublicKey()),
+		listener:           listener,
+		config:             config,
+	}
+
+	go srv.acceptLoop()
+	return srv, nil
+}
+
+// Close stops accepting connections. In-flight sessions are torn down by
+// their own connection teardown.
+func (s *Server) Close() {
+	s.mu.Lock()
+	s.closed = true
+	s.mu.Unlock()
+	s.listener.Close()
+}
+
+func (s *Server) acceptLoop() {
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			s.mu.Lock()
+			done := s.closed
+			s.mu.Unlock()
+			if done {
+				return
+			}
+			continue
+		}
+		go s.handleConn(conn)
+	}
+}
+
+func (s *Server) handleConn(conn net.Conn) {
+	sshConn, chans, reqs, err := ssh.NewServerConn(conn, s.config)
+	if err != nil {
+		conn.Close()
+		return
+	}
+	defer sshConn.Close()
+	go ssh.DiscardRequests(reqs)
+
+	for newChan := range chans {
+		switch newChan.ChannelType() {
+		case "session":
+			channel, requests, err := newChan.Accept()
+			if err != nil {
+				continue
+			}
+			go s.handleSession(channel, requests)
+		case "direct-tcpip":
+			// Port forwarding, so the server can play bastion in jump
+			// host tests.
+			go s.handleDirectTCPIP(newChan)
+		default:
+			newChan.Reject(ssh.UnknownChannelType, "only sessions here")
+		}
+	}
+}
+
+// handleDirectTCPIP dials the requested target and pipes bytes both ways,
+// like sshd does for -L / ProxyJump.
+func (s *Server) handleDirectTCPIP(newChan ssh.NewChannel) {
+	var req struct {
+		DestAddr   string
+		DestPort   uint32
+		OriginAddr string
+		OriginPort uint32
+	}
+	if err := ssh.Unmarshal(newChan.ExtraData(), &req); err != nil {
+		newChan.Reject(ssh.ConnectionFailed, "bad direct-tcpip payload")
+		return
+	}
+	target, err := net.Dial("tcp", net.JoinHostPort(req.DestAddr, fmt.Sprintf("%d", req.DestPort)))
+	if err != nil {
+		newChan.Reject(ssh.ConnectionFailed, err.Error())
+		return
+	}
+	channel, requests, err := newChan.Accept()
+	if err != nil {
+		target.Close()
+		return
+	}
+	go ssh.DiscardRequests(requests)
+
+	go func() {
+		io.Copy(target, channel)
+		target.Close()
+	}()
+	io.Copy(channel, target)
+	channel.Close()
+}
+
+func (s *Server) handleSession(channel ssh.Channel, requests <-chan *ssh.Request) {
+	defer channel.Close()
+
+	for req := range requests {
+		// Only "subsystem sftp" gets a yes; everything else is refused.
+		ok := req.Type == "subsystem" && len(req.Payload) > 4 && string(req.Payload[4:]) == "sftp"
+		if req.WantReply {
+			req.Reply(ok, nil)
+		}
+		if !ok {
+			continue
+		}
+
+		server, err := sftp.NewServer(channel, sftp.WithServerWorkingDirectory(s.Root))
+		if err != nil {
+			return
+		}
+		if err := server.Serve(); err != nil && err != io.EOF {
+			server.Close()
+		}
+		return
+	}
+}